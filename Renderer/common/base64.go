@@ -3,46 +3,48 @@ package common
 import (
 	"compress/gzip"
 	"io/ioutil"
-	"log"
 	"os"
 )
 
-func WriteB64(filename, value string) {
+func WriteB64(filename, value string) error {
 	file, err := os.OpenFile(
 		filename,
 		os.O_WRONLY|os.O_TRUNC|os.O_CREATE,
 		0666,
 	)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer file.Close()
 
 	w, err := gzip.NewWriterLevel(file, gzip.BestCompression)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	w.Write([]byte(value))
-	w.Close()
+	if _, err := w.Write([]byte(value)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
 }
 
-func ReadB64(filename string) string {
+func ReadB64(filename string) (string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer file.Close()
 
 	fz, err := gzip.NewReader(file)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer fz.Close()
 
 	s, err := ioutil.ReadAll(fz)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return string(s)
+	return string(s), nil
 }
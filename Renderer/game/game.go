@@ -12,6 +12,7 @@ var angle = 0.0
 var walkSpeed float64 = 5
 var runSpeed float64 = 5
 var lightSpeed float32 = 0.3
+var nextSceneHeld = false
 
 //var lightToMove *geometry.PointLight
 
@@ -115,6 +116,12 @@ func Update(state *geometry.State, deltaTime float64) {
 
 	}
 
+	//N cycles through the scenes in the statefile
+	if state.Keys[glfw.KeyN] && !nextSceneHeld && len(state.Scenes) > 1 {
+		state.SwitchSceneIndex((state.CurrentScene + 1) % len(state.Scenes))
+	}
+	nextSceneHeld = state.Keys[glfw.KeyN]
+
 	angle += 0.5 * deltaTime
 
 }
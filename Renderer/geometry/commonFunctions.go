@@ -1,7 +1,9 @@
 package geometry
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -42,6 +44,8 @@ type SceneObject struct {
 	Position        []float32 `json:"position"`
 	Scale           []float32 `json:"scale"`
 	Rotation        []float32 `json:"rotation"`
+	Quaternion      []float32 `json:"quaternion"` //x, y, z, w, used instead of rotation when given
+	Euler           []float32 `json:"euler"`      //pitch, yaw, roll in degrees, used instead of rotation when given
 	DiffuseTexture  string    `json:"diffuseTexture"`
 	NormalTexture   string    `json:"normalTexture"`
 	Parent          string    `json:"parent"`
@@ -49,20 +53,28 @@ type SceneObject struct {
 	Collide         bool      `json:"collide"`
 	Reflective      int       `json:"reflective"`
 	RefractionIndex float32   `json:"refractionIndex"`
+
+	Instances []SceneInstance `json:"instances"` //meshes only, loads a copy for each instead of the object, see instancing.go
 }
 
 // Settings - WIP
 type Settings struct {
-	Cam             Camera    `json:"camera"`
-	BackgroundColor []float32 `json:"backgroundColor"`
-	Skybox          Skybox    `json:"skybox"`
+	Cam             Camera       `json:"camera"`
+	BackgroundColor []float32    `json:"backgroundColor"`
+	Skybox          Skybox       `json:"skybox"`
+	ToneMapping     ToneMapping  `json:"toneMapping"`
+	PostProcess     []PostEffect `json:"postProcess"` //applied in order, see postProcess.go
+	Renderer        string       `json:"renderer"`    //ForwardRendering or DeferredRendering
+	SSAO            SSAO         `json:"ssao"`
 }
 
 // Scene - Struct for holding allthe info about the current scene
 type Scene struct {
+	Name              string             `json:"name"`
 	Objects           []SceneObject      `json:"objects"`
 	PointLights       []PointLight       `json:"pointLights"`
 	DirectionalLights []DirectionalLight `json:"directionalLights"`
+	ReflectionProbes  []ReflectionProbe  `json:"reflectionProbes"`
 	Settings          Settings           `json:"settings"`
 }
 
@@ -126,10 +138,23 @@ func ScaleM4(a mgl32.Mat4, v mgl32.Vec3) mgl32.Mat4 {
 	return out
 }
 
-func addObjectToState(object Geometry, state *State, sceneObj SceneObject) {
+// sceneRotation - rotation matrix of a scene object from whichever of quaternion, euler or rotation it was saved with
+func sceneRotation(sceneObj SceneObject) mgl32.Mat4 {
+	if len(sceneObj.Quaternion) == 4 {
+		q := sceneObj.Quaternion
+		return mgl32.Quat{W: q[3], V: mgl32.Vec3{q[0], q[1], q[2]}}.Normalize().Mat4()
+	}
+	if len(sceneObj.Euler) == 3 {
+		e := sceneObj.Euler
+		return EulerToQuat(mgl32.DegToRad(e[0]), mgl32.DegToRad(e[1]), mgl32.DegToRad(e[2])).Mat4()
+	}
+	return CreateMat4FromArray(sceneObj.Rotation)
+}
+
+func addObjectToState(object Geometry, state *State, sceneObj SceneObject) error {
 
 	//get rotation
-	rot := CreateMat4FromArray(sceneObj.Rotation)
+	rot := sceneRotation(sceneObj)
 
 	//create model
 	tempModel := Model{
@@ -145,7 +170,11 @@ func addObjectToState(object Geometry, state *State, sceneObj SceneObject) {
 		sceneObj.Material.NormalTexture = sceneObj.NormalTexture
 	}
 
-	object.Setup(
+	if sceneObj.Material.Mirror != nil {
+		sceneObj.Material.Mirror.setDefaults()
+	}
+
+	err := object.Setup(
 		sceneObj.Material,
 		tempModel,
 		sceneObj.Name,
@@ -153,8 +182,13 @@ func addObjectToState(object Geometry, state *State, sceneObj SceneObject) {
 		sceneObj.Reflective,
 		sceneObj.RefractionIndex,
 	)
+	if err != nil {
+		return err
+	}
 	object.Translate(mgl32.Vec3{sceneObj.Position[0], sceneObj.Position[1], sceneObj.Position[2]})
 	state.Objects = append(state.Objects, object)
+	state.LoadedObjects++
+	return nil
 }
 
 // GetBoundingBox - Given a set of vertices, returns a bounding box object that contains the min & max of the box
@@ -240,189 +274,301 @@ func Intersect(a, b BoundingBox) bool {
 		(a.Min[2] <= b.Max[2] && a.Max[2] >= b.Min[2])
 }
 
-// ParseJSONFile - Given a json file that contains scene information, load it and put into global state
-func ParseJSONFile(filePath string, state *State) {
+// ParseJSONFile - Given a json file that contains scene information, load it and put into global state.
+// Older scene files are migrated and the file is validated before anything is loaded. Every scene in the
+// file is kept in state.Scenes and the one named by opts.Scene, or the first, is loaded
+func ParseJSONFile(filePath string, state *State, opts LoadOptions) error {
 	fmt.Printf("Opening scene file: %s\n", filePath)
 
-	ex, err := os.Executable()
+	byteValue, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return &LoadError{File: filePath, Err: err}
+	}
+
+	fmt.Println("Starting scene file read.....")
+	sceneFile, err := DecodeSceneFile(filePath, byteValue)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	fmt.Println("Reading scene file complete.....")
 
-	exPath := filepath.Dir(ex)
+	state.Scenes = sceneFile.Scenes
+	state.ScenePath = filePath
 
-	jsonFile, err := os.Open(filePath)
+	index := 0
+	if opts.Scene != "" {
+		index = state.SceneIndex(opts.Scene)
+		if index < 0 {
+			return &LoadError{File: filePath, Err: fmt.Errorf("no scene named %q", opts.Scene)}
+		}
+	}
 
+	return state.LoadScene(index, opts)
+}
+
+// jsonErrorLine - returns the line of a json syntax or type error, 0 if the error has no offset
+func jsonErrorLine(data []byte, err error) int {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	} else {
+		return 0
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// loadSceneObject - creates the object(s) described by a scene object and adds them to the state
+func loadSceneObject(sceneObj SceneObject, sceneObjects []SceneObject, state *State, exPath string) error {
+	switch sceneObj.ObjectType {
+	case "cube":
+		return addObjectToState(&Cube{}, state, sceneObj)
+	case "plane":
+		return addObjectToState(&Plane{}, state, sceneObj)
+	case "mesh":
+		if len(sceneObj.Instances) > 0 {
+			return loadMeshInstances(sceneObj, sceneObjects, state, exPath)
+		}
+		return loadMeshObject(sceneObj, sceneObjects, state, exPath)
+	}
+
+	return fmt.Errorf("unknown object type %q", sceneObj.ObjectType)
+}
+
+// addPlaceholderToState - adds a stand in for an object that failed to load, cubes and planes keep their
+// shape with the default material while meshes and unknown types become a cube
+func addPlaceholderToState(state *State, sceneObj SceneObject) error {
+	sceneObj.DiffuseTexture = placeholderDiffuseTexture
+	sceneObj.NormalTexture = placeholderNormalTexture
+	if sceneObj.Material.ShaderType == PBRShaderType {
+		sceneObj.Material = sceneObj.Material.blinnFallback()
+	} else if sceneObj.Material.ShaderType != 4 {
+		sceneObj.Material.ShaderType = 3
+	}
+
+	if sceneObj.ObjectType == "plane" {
+		return addObjectToState(&Plane{}, state, sceneObj)
+	}
+	return addObjectToState(&Cube{}, state, sceneObj)
+}
+
+// loadMeshFile - reads a mesh from the cache if it has been parsed before, otherwise parses the obj and caches it
+func loadMeshFile(model, meshPath string) ([]parser.OBJObject, error) {
+	cachePath := "./game/.cache/" + model + ".dat"
+
+	//check here if a cached version of the mesh already exists
+	if _, err := os.Stat(cachePath); err == nil {
+		val, err := common.ReadB64(cachePath)
+		if err == nil {
+			objects, err := parser.DeserializeOBJ(val)
+			if err == nil {
+				return objects, nil
+			}
+		}
+		fmt.Printf("Warning: ignoring unreadable mesh cache %s: %v\n", cachePath, err)
+	}
+
+	objects, err := parser.Parse(meshPath)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
-	byteValue, _ := ioutil.ReadAll(jsonFile)
+	//failing to cache only costs the next load a re-parse
+	b64Objects, err := parser.SerializeOBJ(objects)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(cachePath), 0755)
+	}
+	if err == nil {
+		err = common.WriteB64(cachePath, b64Objects)
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not cache mesh %s: %v\n", model, err)
+	}
 
-	var scene []Scene
+	return objects, nil
+}
 
-	fmt.Println("Starting scene file read.....")
-	err = json.Unmarshal(byteValue, &scene)
-	fmt.Println("Reading scene file complete.....")
+// loadMeshInstances - loads a copy of a mesh for each entry of its instances list, named by instanceName. The
+// copies only differ in their transforms, so they share one set of resources and are drawn as an instance group
+func loadMeshInstances(sceneObj SceneObject, sceneObjects []SceneObject, state *State, exPath string) error {
+	for i, instance := range sceneObj.Instances {
+		err := loadMeshObject(instance.sceneObject(sceneObj, i), sceneObjects, state, exPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// loadMeshObject - loads an obj mesh, adding one ModelObject per material. Nothing is added to the state
+// unless every part loads, and the parts already set up are freed when one doesn't. Parts loaded like a part of an
+// earlier object share its resources
+func loadMeshObject(sceneObj SceneObject, sceneObjects []SceneObject, state *State, exPath string) error {
+	meshPath := exPath + "/../Editor/models/" + sceneObj.Model
+	objects, err := state.meshFile(sceneObj.Model, meshPath)
 	if err != nil {
-		fmt.Println(err)
-		panic(err)
-	}
-
-	state.Settings = scene[0].Settings
-
-	for i := 0; i < len(scene[0].Objects); i++ {
-		if scene[0].Objects[i].ObjectType == "cube" {
-			fmt.Println(scene[0].Objects[i].Name, " loading....")
-			tempCube := Cube{}
-			addObjectToState(&tempCube, state, scene[0].Objects[i])
-			state.LoadedObjects++
-			fmt.Println(scene[0].Objects[i].Name, " loaded successfully!")
-
-		} else if scene[0].Objects[i].ObjectType == "plane" {
-			fmt.Println(scene[0].Objects[i].Name, " loading....")
-			tempPlane := Plane{}
-			addObjectToState(&tempPlane, state, scene[0].Objects[i])
-			state.LoadedObjects++
-			fmt.Println(scene[0].Objects[i].Name, " loaded successfully!")
-
-		} else if scene[0].Objects[i].ObjectType == "mesh" {
-			fmt.Println(scene[0].Objects[i].Name, " loading....")
-			//check here if a cached version of the mesh already exists
-			fmt.Println("CHECK THIS FILE ", scene[0].Objects[i].Model+".dat")
-
-			var objects []parser.OBJObject
-
-			//if there is no cached value
-			if _, err := os.Stat("./game/.cache/" + scene[0].Objects[i].Model + ".dat"); os.IsNotExist(err) {
-				meshPath := exPath + "/../Editor/models/" + scene[0].Objects[i].Model
-				objects = parser.Parse(meshPath)
-				b64Objects := parser.SerializeOBJ(objects)
-				common.WriteB64("./game/.cache/"+scene[0].Objects[i].Model+".dat", b64Objects)
+		return newLoadError(sceneObj.Name, meshPath, err)
+	}
+
+	var parts []Geometry
+	var keys []string
+
+	//frees the parts set up so far, none of them reach the state
+	fail := func(err error) error {
+		for _, part := range parts {
+			part.Destroy()
+		}
+		return err
+	}
+
+	for x := 0; x < len(objects); x++ {
+		for j := 0; j < len(objects[x].Materials); j++ {
+			tempModelObject := ModelObject{
+				MTLPresent: true,
+			}
+			var parsedMaterial parser.ParsedMaterial
+
+			//check for regular texture first
+			if sceneObj.DiffuseTexture != "" || objects[x].Materials[j].MTLLib == "" {
+				tempModelObject.MTLPresent = sceneObj.DiffuseTexture == ""
+				parsedMaterial = sceneParsedMaterial(sceneObj)
+
+			} else {
+				tempMaterial, err := parser.ParseMTLFile(objects[x].Materials[j].MTLLib, objects[x].Materials[j].Name)
+				if err == nil {
+					parsedMaterial = tempMaterial
+				} else if os.IsNotExist(err) {
+					parsedMaterial = sceneParsedMaterial(sceneObj)
+				} else {
+					return fail(newLoadError(sceneObj.Name, objects[x].Materials[j].MTLLib, err))
+				}
+			}
+
+			start := objects[x].Materials[j].Start
+			end := objects[x].Materials[j].End
+			geom := objects[x].Geometry
+			if start < 0 || start > end || len(geom.Vertices) < end*3 || len(geom.Normals) < end*3 {
+				return fail(&LoadError{Object: sceneObj.Name, File: meshPath, Err: fmt.Errorf("material %q has no vertex normals for faces %d-%d", objects[x].Materials[j].Name, start, end)})
+			}
+
+			if len(geom.UVs) >= end*2 && len(geom.UVs) > 0 {
+				tempModelObject.SetVertexValues(geom.Vertices[start*3:end*3],
+					geom.Normals[start*3:end*3],
+					geom.UVs[start*2:end*2], nil)
 			} else {
-				val := common.ReadB64("./game/.cache/" + scene[0].Objects[i].Model + ".dat")
-				objects = parser.DeserializeOBJ(val)
+				tempModelObject.SetVertexValues(geom.Vertices[start*3:end*3],
+					geom.Normals[start*3:end*3],
+					nil, nil)
 			}
-			for x := 0; x < len(objects); x++ {
-				for j := 0; j < len(objects[x].Materials); j++ {
-					tempModelObject := ModelObject{
-						MTLPresent: true,
-					}
-					var parsedMaterial parser.ParsedMaterial
-
-					//check for regular texture first
-					if scene[0].Objects[i].DiffuseTexture != "" {
-						tempModelObject.MTLPresent = false
-						parsedMaterial.Kd = scene[0].Objects[i].Material.Diffuse
-						parsedMaterial.Ka = scene[0].Objects[i].Material.Ambient
-						parsedMaterial.Ks = scene[0].Objects[i].Material.Specular
-						parsedMaterial.Ns = scene[0].Objects[i].Material.N
-						parsedMaterial.D = scene[0].Objects[i].Material.Alpha
-						parsedMaterial.MapKD = scene[0].Objects[i].DiffuseTexture
-
-					} else {
-						tempMaterial, err := parser.ParseMTLFile(objects[x].Materials[j].MTLLib, objects[x].Materials[j].Name)
-						if err == nil {
-							parsedMaterial = tempMaterial
-						} else {
-							parsedMaterial.Kd = scene[0].Objects[i].Material.Diffuse
-							parsedMaterial.Ka = scene[0].Objects[i].Material.Ambient
-							parsedMaterial.Ks = scene[0].Objects[i].Material.Specular
-							parsedMaterial.Ns = scene[0].Objects[i].Material.N
-							parsedMaterial.D = scene[0].Objects[i].Material.Alpha
-							parsedMaterial.MapKD = scene[0].Objects[i].DiffuseTexture
-						}
-					}
-
-					if len(objects[x].Geometry.UVs) > 0 {
-						tempModelObject.SetVertexValues(objects[x].Geometry.Vertices[objects[x].Materials[j].Start*3:objects[x].Materials[j].End*3],
-							objects[x].Geometry.Normals[objects[x].Materials[j].Start*3:objects[x].Materials[j].End*3],
-							objects[x].Geometry.UVs[objects[x].Materials[j].Start*2:objects[x].Materials[j].End*2], nil)
-					} else {
-						tempModelObject.SetVertexValues(objects[x].Geometry.Vertices[objects[x].Materials[j].Start*3:objects[x].Materials[j].End*3],
-							objects[x].Geometry.Normals[objects[x].Materials[j].Start*3:objects[x].Materials[j].End*3],
-							nil, nil)
-					}
-
-					tempName := scene[0].Objects[i].Name
-					rot := CreateMat4FromArray(scene[0].Objects[i].Rotation)
-					tempModel := Model{
-						Position: mgl32.Vec3{scene[0].Objects[i].Position[0], scene[0].Objects[i].Position[1], scene[0].Objects[i].Position[2]},
-						Scale:    mgl32.Vec3{scene[0].Objects[i].Scale[0], scene[0].Objects[i].Scale[1], scene[0].Objects[i].Scale[2]},
-						Rotation: mgl32.Ident4(),
-					}
-
-					if x > 1 {
-						tempName = strings.Join([]string{tempName, strconv.Itoa(j)}, "")
-						tempModelObject.SetParent(scene[0].Objects[j].Name)
-						// newObject.name = object.name + i;
-						//     newObject.parent = object.name;
-						//     newObject.parentTransform = object.position;
-					}
-
-					if j > 0 {
-						tempName = strings.Join([]string{tempName, strconv.Itoa(j)}, "")
-						tempModelObject.SetParent(scene[0].Objects[i].Name)
-						tempModel.Position = mgl32.Vec3{0, 0, 0}
-						tempModel.Scale = mgl32.Vec3{1, 1, 1}
-					} else {
-						tempModel.Rotation = rot
-					}
-
-					tempMaterial := Material{
-						Diffuse:  parsedMaterial.Kd,
-						Ambient:  parsedMaterial.Ka,
-						Specular: parsedMaterial.Ks,
-						Alpha:    parsedMaterial.D,
-						N:        parsedMaterial.Ns,
-					}
-
-					//create temp material, checking for values
-					if parsedMaterial.MapKD != "" && parsedMaterial.MapBump != "" {
-						tempMaterial.DiffuseTexture = parsedMaterial.MapKD
-						tempMaterial.NormalTexture = parsedMaterial.MapBump
-						tempMaterial.ShaderType = 4
-					} else if parsedMaterial.MapKD != "" && parsedMaterial.MapBump == "" {
-						tempMaterial.DiffuseTexture = parsedMaterial.MapKD
-						tempMaterial.ShaderType = 3
-					} else {
-						tempMaterial.ShaderType = 1
-					}
-
-					tempModelObject.Setup(
-						tempMaterial,
-						tempModel,
-						tempName,
-						scene[0].Objects[i].Collide,
-						scene[0].Objects[i].Reflective,
-						scene[0].Objects[i].RefractionIndex,
-					)
-
-					if scene[0].Objects[i].Parent != "" {
-						tempModelObject.SetParent(scene[0].Objects[i].Parent)
-					}
-
-					state.Objects = append(state.Objects, &tempModelObject)
-					state.LoadedObjects++
-					fmt.Println(tempModelObject.name, " loaded successfully!")
+
+			tempName := sceneObj.Name
+			rot := sceneRotation(sceneObj)
+			tempModel := Model{
+				Position: mgl32.Vec3{sceneObj.Position[0], sceneObj.Position[1], sceneObj.Position[2]},
+				Scale:    mgl32.Vec3{sceneObj.Scale[0], sceneObj.Scale[1], sceneObj.Scale[2]},
+				Rotation: mgl32.Ident4(),
+			}
+
+			if x > 1 && j < len(sceneObjects) {
+				tempName = strings.Join([]string{tempName, strconv.Itoa(j)}, "")
+				tempModelObject.SetParent(sceneObjects[j].Name)
+				// newObject.name = object.name + i;
+				//     newObject.parent = object.name;
+				//     newObject.parentTransform = object.position;
+			}
+
+			if j > 0 {
+				tempName = strings.Join([]string{tempName, strconv.Itoa(j)}, "")
+				tempModelObject.SetParent(sceneObj.Name)
+				tempModel.Position = mgl32.Vec3{0, 0, 0}
+				tempModel.Scale = mgl32.Vec3{1, 1, 1}
+			} else {
+				tempModel.Rotation = rot
+			}
+
+			tempMaterial := Material{
+				Diffuse:  parsedMaterial.Kd,
+				Ambient:  parsedMaterial.Ka,
+				Specular: parsedMaterial.Ks,
+				Alpha:    parsedMaterial.D,
+				N:        parsedMaterial.Ns,
+			}
+
+			//create temp material, checking for values
+			if parsedMaterial.MapKD != "" && parsedMaterial.MapBump != "" {
+				tempMaterial.DiffuseTexture = parsedMaterial.MapKD
+				tempMaterial.NormalTexture = parsedMaterial.MapBump
+				tempMaterial.ShaderType = 4
+			} else if parsedMaterial.MapKD != "" && parsedMaterial.MapBump == "" {
+				tempMaterial.DiffuseTexture = parsedMaterial.MapKD
+				tempMaterial.ShaderType = 3
+			} else {
+				tempMaterial.ShaderType = 1
+			}
+
+			//a PBR material comes from the scene file, the mtl file only fills in its colour and maps
+			if sceneObj.Material.ShaderType == PBRShaderType {
+				pbrMaterial := sceneObj.Material
+				pbrMaterial.Diffuse = parsedMaterial.Kd
+				pbrMaterial.Alpha = parsedMaterial.D
+				pbrMaterial.DiffuseTexture = parsedMaterial.MapKD
+				pbrMaterial.NormalTexture = parsedMaterial.MapBump
+				if !tempModelObject.MTLPresent && sceneObj.NormalTexture != "" {
+					pbrMaterial.NormalTexture = sceneObj.NormalTexture
 				}
+				tempMaterial = pbrMaterial
+			}
+
+			key := meshKey(sceneObj, x, j, tempModelObject.MTLPresent, tempMaterial)
+			tempModelObject.shared = state.sharedMesh(key)
+			err := tempModelObject.Setup(
+				tempMaterial,
+				tempModel,
+				tempName,
+				sceneObj.Collide,
+				sceneObj.Reflective,
+				sceneObj.RefractionIndex,
+			)
+			if err != nil {
+				//the part that failed may have made its program or a texture before it did
+				tempModelObject.Destroy()
+				return fail(newLoadError(sceneObj.Name, meshPath, err))
+			}
+
+			if sceneObj.Parent != "" {
+				tempModelObject.SetParent(sceneObj.Parent)
 			}
+
+			parts = append(parts, &tempModelObject)
+			keys = append(keys, key)
 		}
 	}
 
-	for j := 0; j < len(scene[0].PointLights); j++ {
-		state.PointLights = append(state.PointLights, scene[0].PointLights[j])
+	for i, part := range parts {
+		state.addSharedMesh(keys[i], part.(*ModelObject))
 	}
+	state.Objects = append(state.Objects, parts...)
+	state.LoadedObjects += len(parts)
+	return nil
+}
 
-	for l := 0; l < len(scene[0].DirectionalLights); l++ {
-		tempLight := DirectionalLight{
-			Colour:    scene[0].DirectionalLights[l].Colour,
-			Strength:  scene[0].DirectionalLights[l].Strength,
-			Direction: scene[0].DirectionalLights[l].Direction,
-			Position:  scene[0].DirectionalLights[l].Position,
-		}
-		state.DirectionalLights = append(state.DirectionalLights, tempLight)
+// sceneParsedMaterial - material for a mesh taken from its scene file entry instead of an mtl file
+func sceneParsedMaterial(sceneObj SceneObject) parser.ParsedMaterial {
+	return parser.ParsedMaterial{
+		Kd:    sceneObj.Material.Diffuse,
+		Ka:    sceneObj.Material.Ambient,
+		Ks:    sceneObj.Material.Specular,
+		Ns:    sceneObj.Material.N,
+		D:     sceneObj.Material.Alpha,
+		MapKD: sceneObj.DiffuseTexture,
 	}
 }
 
@@ -5,7 +5,6 @@ import (
 
 	"../shader"
 	"../texture"
-	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -29,6 +28,7 @@ type Cube struct {
 	shaderVal         shader.Shader
 	diffuseTexture    *texture.Texture
 	normalTexture     *texture.Texture
+	pbrTextures       PBRTextures
 	onCollide         collisionFunction
 	velocity          mgl32.Vec3
 	shadowProgramInfo ProgramInfo
@@ -142,6 +142,10 @@ func (c Cube) GetNormalTexture() *texture.Texture {
 	return c.normalTexture
 }
 
+func (c Cube) GetPBRTextures() PBRTextures {
+	return c.pbrTextures
+}
+
 // GetBuffers : getter for buffers
 func (c Cube) GetBuffers() ObjectBuffers {
 	return c.buffers
@@ -160,10 +164,49 @@ func (c *Cube) SetRotation(rot mgl32.Mat4) {
 	c.model.Rotation = rot
 }
 
+// GetQuat : getter for the rotation of the cube as a quaternion
+func (c Cube) GetQuat() mgl32.Quat {
+	return mgl32.Mat4ToQuat(c.model.Rotation)
+}
+
+// SetQuat : sets the rotation of the cube from a quaternion
+func (c *Cube) SetQuat(q mgl32.Quat) {
+	c.model.Rotation = q.Normalize().Mat4()
+}
+
+// Rotate : turns the cube by angle radians about a world space axis, on top of its current rotation
+func (c *Cube) Rotate(axis mgl32.Vec3, angle float32) {
+	c.model.Rotation = rotateQuat(c.model.Rotation, axis, angle).Mat4()
+}
+
+// SetEuler : sets the rotation of the cube from pitch, yaw and roll in radians, see EulerToQuat
+func (c *Cube) SetEuler(pitch, yaw, roll float32) {
+	c.model.Rotation = EulerToQuat(pitch, yaw, roll).Mat4()
+}
+
+// LookAt : turns the cube so its -Z axis faces target
+func (c *Cube) LookAt(target mgl32.Vec3) {
+	c.model.Rotation = lookAtQuat(c, target).Mat4()
+}
+
+// Slerp : moves the rotation of the cube a fraction t of the way towards target
+func (c *Cube) Slerp(target mgl32.Quat, t float32) {
+	c.model.Rotation = slerpQuat(c.model.Rotation, target, t).Mat4()
+}
+
 func (c *Cube) SetParent(parent string) {
 	c.parent = parent
 }
 
+// Destroy : frees the program, buffers and textures created in Setup
+func (c *Cube) Destroy() {
+	destroyObjectResources(&c.programInfo, &c.buffers, c.diffuseTexture, c.normalTexture,
+		c.pbrTextures.MetallicRoughness, c.pbrTextures.Occlusion, c.pbrTextures.Emissive)
+	c.diffuseTexture = nil
+	c.normalTexture = nil
+	c.pbrTextures = PBRTextures{}
+}
+
 // GetModel : getter for model values
 func (c Cube) GetModel() (Model, error) {
 	if (c.model != Model{}) {
@@ -383,11 +426,10 @@ func (c *Cube) Setup(mat Material, mod Model, name string, collide bool, reflect
 			normal:   1,
 			uv:       2,
 		}
-		texture0, err := texture.NewTextureFromFile("../Editor/materials/"+c.material.DiffuseTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture0, err := loadTexture(name, "../Editor/materials/"+c.material.DiffuseTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 		c.diffuseTexture = texture0
 
@@ -426,18 +468,16 @@ func (c *Cube) Setup(mat Material, mod Model, name string, collide bool, reflect
 		}
 
 		//load diffuse texture
-		texture0, err := texture.NewTextureFromFile("../Editor/materials/"+c.material.DiffuseTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture0, err := loadTexture(name, "../Editor/materials/"+c.material.DiffuseTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 		//load normal texture
-		texture1, err := texture.NewTextureFromFile("../Editor/materials/"+c.material.NormalTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture1, err := loadTexture(name, "../Editor/materials/"+c.material.NormalTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		c.diffuseTexture = texture0
@@ -446,6 +486,18 @@ func (c *Cube) Setup(mat Material, mod Model, name string, collide bool, reflect
 		SetupAttributesMap(&c.programInfo, shaderVals)
 		c.buffers.Vao = CreateTriangleVAO(&c.programInfo, c.vertexValues.Vertices, c.vertexValues.Normals, c.vertexValues.Uvs, tangents, bitangents, c.vertexValues.Faces)
 
+	} else if mat.ShaderType == PBRShaderType {
+		pbr, err := setupPBR(name, "../Editor/materials/", &c.material, c.vertexValues)
+		if err != nil {
+			return err
+		}
+
+		c.shaderVal = pbr.shaderVal
+		c.programInfo = pbr.programInfo
+		c.buffers.Vao = pbr.vao
+		c.diffuseTexture = pbr.diffuseTexture
+		c.normalTexture = pbr.normalTexture
+		c.pbrTextures = pbr.maps
 	}
 
 	c.boundingBox = GetBoundingBox(c.vertexValues.Vertices)
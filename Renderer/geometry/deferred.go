@@ -0,0 +1,420 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// ForwardRendering - Settings.Renderer of scenes whose objects are lit as they are drawn, the default
+	ForwardRendering = "forward"
+	// DeferredRendering - Settings.Renderer of scenes lit in screen space from a G-buffer, see DeferredRenderer
+	DeferredRendering = "deferred"
+)
+
+// shading models of the G-buffer, matching the SHADING_ defines in shader/deferred.go
+const (
+	shadingBlinn = 1
+	shadingPBR   = 2
+)
+
+// gBufferFormats - internal format of each G-buffer target, in the order shader/deferred.go writes them: position,
+// normals, albedo, material, ambient and emission
+var gBufferFormats = []int32{gl.RGBA32F, gl.RGBA16F, gl.RGBA16F, gl.RGBA16F, gl.RGBA16F, gl.RGBA16F}
+
+// gBufferSamplers - sampler uniforms of the lighting passes, the ith one on gBufferUnits+i
+var gBufferSamplers = [...]string{"gPosition", "gNormal", "gAlbedo", "gMaterial", "gAmbient", "gEmission"}
+
+const (
+	volumeSegments = 16 //around the light volume sphere
+	volumeRings    = 8  //from pole to pole
+)
+
+// DeferredRenderer - draws the opaque lit objects of a scene into a G-buffer and lights them in screen space: the
+// emission and directional lights in one fullscreen pass, then each point light over the sphere it reaches, so a
+// light costs the pixels it covers and there is no limit on point lights. Transparent objects are left to the
+// TransparencyPass and the unlit shader types to the forward renderer, see Handles. Lighting reads single pixels so
+// the frame isn't multisampled
+type DeferredRenderer struct {
+	width   int32
+	height  int32
+	fbo     uint32
+	targets []uint32
+	depthRB uint32
+
+	gBuffer       ProgramInfo
+	directional   postProgram
+	point         postProgram
+	vao           uint32 //empty, for the fullscreen triangle
+	volume        uint32 //unit sphere the point lights are drawn as
+	volumeIndices int32
+}
+
+// NewDeferredRenderer - the programs and targets are made by Begin, the first time a scene asks for deferred
+// rendering
+func NewDeferredRenderer() *DeferredRenderer {
+	return &DeferredRenderer{}
+}
+
+// Handles - whether an object is drawn into the G-buffer rather than by the forward renderer. Mirrors are drawn
+// forward, the G-buffer has no room for their reflection
+func (d *DeferredRenderer) Handles(object Geometry) bool {
+	mat := object.GetMaterial()
+	return mat.Alpha >= 1.0 && litShaderType(mat.ShaderType) && MirrorOf(object) == nil
+}
+
+// litShaderType - whether a shader type is one of the lit ones, Blinn-Phong or PBR, which share the lighting,
+// transparency and ambient occlusion code
+func litShaderType(shaderType int) bool {
+	switch shaderType {
+	case 1, 3, 4, PBRShaderType:
+		return true
+	}
+	return false
+}
+
+// Begin - binds and clears the G-buffer for the objects to be drawn into, remaking it first if the frame size changed
+func (d *DeferredRenderer) Begin(width, height int32) error {
+	if d.gBuffer.Program == 0 {
+		d.setup()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if d.fbo == 0 || width != d.width || height != d.height {
+		if err := d.createTargets(width, height); err != nil {
+			return err
+		}
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, d.fbo)
+	gl.Viewport(0, 0, width, height)
+	//the shading model in the albedo alpha is cleared to none
+	zero := []float32{0, 0, 0, 0}
+	for i := range d.targets {
+		gl.ClearBufferfv(gl.COLOR, int32(i), &zero[0])
+	}
+	one := float32(1)
+	gl.ClearBufferfv(gl.DEPTH, 0, &one)
+
+	gl.Enable(gl.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.DepthFunc(gl.LEQUAL)
+	gl.Disable(gl.BLEND)
+	return nil
+}
+
+// setup - builds the programs and the light volume
+func (d *DeferredRenderer) setup() {
+	s := &shader.GBufferShader{}
+	s.Setup()
+	d.gBuffer.Program = InitOpenGL(s.GetVertShader(), s.GetFragShader(), s.GetGeometryShader())
+	cacheUniformLocations(&d.gBuffer)
+
+	d.directional = newPostProgram(&shader.DeferredDirectionalShader{})
+	bindLightsBlock(d.directional.program)
+	d.point = newPostProgram(&shader.DeferredPointLightShader{})
+	bindSamplerUnits(d.point.program)
+
+	gl.GenVertexArrays(1, &d.vao)
+	d.volume, d.volumeIndices = newLightVolume()
+}
+
+// createTargets - makes the G-buffer textures and the depth buffer they share
+func (d *DeferredRenderer) createTargets(width, height int32) error {
+	d.deleteTargets()
+	d.width = width
+	d.height = height
+
+	gl.GenFramebuffers(1, &d.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, d.fbo)
+	drawBuffers := make([]uint32, len(gBufferFormats))
+	for i, format := range gBufferFormats {
+		texture := newColorTexture(format, gl.RGBA, width, height, gl.NEAREST)
+		d.targets = append(d.targets, texture)
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0+uint32(i), gl.TEXTURE_2D, texture, 0)
+		drawBuffers[i] = gl.COLOR_ATTACHMENT0 + uint32(i)
+	}
+	gl.DrawBuffers(int32(len(drawBuffers)), &drawBuffers[0])
+
+	//the same format as the HDR target's depth so it can be copied there for the light volumes
+	gl.GenRenderbuffers(1, &d.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, d.depthRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, d.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		return fmt.Errorf("G-buffer framebuffer incomplete: 0x%x", status)
+	}
+	return nil
+}
+
+// newLightVolume - vertex array of a sphere around the origin, made a little bigger than the unit sphere so its flat
+// faces don't cut into it
+func newLightVolume() (uint32, int32) {
+	scale := 1 / (math.Cos(math.Pi/volumeSegments) * math.Cos(math.Pi/(2*volumeRings)))
+	var vertices []float32
+	for ring := 0; ring <= volumeRings; ring++ {
+		phi := math.Pi * float64(ring) / volumeRings
+		for segment := 0; segment < volumeSegments; segment++ {
+			theta := 2 * math.Pi * float64(segment) / volumeSegments
+			vertices = append(vertices,
+				float32(scale*math.Sin(phi)*math.Cos(theta)),
+				float32(scale*math.Cos(phi)),
+				float32(scale*math.Sin(phi)*math.Sin(theta)))
+		}
+	}
+
+	//counter clockwise seen from outside
+	var indices []uint32
+	for ring := 0; ring < volumeRings; ring++ {
+		for segment := 0; segment < volumeSegments; segment++ {
+			a := uint32(ring*volumeSegments + segment)
+			b := uint32(ring*volumeSegments + (segment+1)%volumeSegments)
+			c := a + volumeSegments
+			e := b + volumeSegments
+			indices = append(indices, a, b, c, b, e, c)
+		}
+	}
+
+	var vao, vbo, ebo uint32
+	gl.GenVertexArrays(1, &vao)
+	gl.BindVertexArray(vao)
+	gl.GenBuffers(1, &vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertices)*4, gl.Ptr(vertices), gl.STATIC_DRAW)
+	gl.EnableVertexAttribArray(0)
+	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, 0, nil)
+	gl.GenBuffers(1, &ebo)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	return vao, int32(len(indices))
+}
+
+// DrawObject - draws copies of an object the renderer handles, see State.DrawCopies, into the G-buffer, after Begin
+func (d *DeferredRenderer) DrawObject(state *State, copies []Geometry, view, projection mgl32.Mat4) {
+	object := copies[0]
+	program := d.gBuffer
+	uniforms := program.UniformLocations
+	gl.UseProgram(program.Program)
+
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
+	}
+	normalMatrix := NormalMatrix(modelMatrix)
+	gl.UniformMatrix4fv(uniforms.Projection, 1, false, &projection[0])
+	gl.UniformMatrix4fv(uniforms.View, 1, false, &view[0])
+	gl.UniformMatrix4fv(uniforms.Model, 1, false, &modelMatrix[0])
+	gl.UniformMatrix3fv(uniforms.NormalMatrix, 1, false, &normalMatrix[0])
+	gl.Uniform3fv(uniforms.CameraPosition, 1, &state.Camera.Position[0])
+	if state.Settings.SSAO.Enabled {
+		gl.Uniform1i(uniforms.SSAOEnabled, 1)
+	} else {
+		gl.Uniform1i(uniforms.SSAOEnabled, 0)
+	}
+
+	mat := object.GetMaterial()
+	if mat.ShaderType == PBRShaderType {
+		gl.Uniform1i(uniforms.ShadingModel, shadingPBR)
+		BindPBRMaterial(program, object)
+	} else {
+		gl.Uniform1i(uniforms.ShadingModel, shadingBlinn)
+		bindBlinnMaterial(program, object)
+	}
+
+	if state.Settings.Skybox.Path != "" {
+		state.Settings.Skybox.Bind()
+		gl.Uniform1i(uniforms.SkyboxPresent, 1)
+	} else {
+		gl.Uniform1i(uniforms.SkyboxPresent, 0)
+	}
+	reflect, refract := object.GetReflectionValues()
+	gl.Uniform1i(uniforms.Reflective, int32(reflect))
+	gl.Uniform1f(uniforms.RefractiveIndex, refract)
+	BindReflectionProbe(uniforms, state.NearestProbe(object))
+
+	state.DrawCopies(uniforms, copies)
+
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	gl.BindVertexArray(0)
+}
+
+// bindBlinnMaterial - uploads the values of an object's Blinn-Phong material and binds the maps its shader type
+// reads, after the G-buffer program is in use
+func bindBlinnMaterial(programInfo ProgramInfo, object Geometry) {
+	mat := object.GetMaterial()
+	uniforms := programInfo.UniformLocations
+
+	gl.Uniform3fv(uniforms.DiffuseVal, 1, &mat.Diffuse[0])
+	gl.Uniform3fv(uniforms.AmbientVal, 1, &mat.Ambient[0])
+	gl.Uniform3fv(uniforms.SpecularVal, 1, &mat.Specular[0])
+	gl.Uniform1f(uniforms.NVal, mat.N)
+
+	diffuseTexture, normalTexture := object.GetDiffuseTexture(), object.GetNormalTexture()
+	if mat.ShaderType < 3 {
+		diffuseTexture = nil
+	}
+	if mat.ShaderType != 4 {
+		normalTexture = nil
+	}
+	textureMaps := bindMaterialMaps([]materialMap{
+		{diffuseTexture, baseColorUnit, baseColorMap},
+		{normalTexture, normalMapUnit, normalMap},
+	})
+	gl.Uniform1i(uniforms.TextureMaps, textureMaps)
+}
+
+// Light - lights the G-buffer into the framebuffer bound for drawing, which must be single sampled and the size
+// given to Begin. The G-buffer's depth is copied into it first, so the light volumes and whatever is drawn after are
+// hidden behind the scene
+func (d *DeferredRenderer) Light(state *State, view, projection mgl32.Mat4) {
+	var target int32
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &target)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, d.fbo)
+	gl.BlitFramebuffer(0, 0, d.width, d.height, 0, 0, d.width, d.height, gl.DEPTH_BUFFER_BIT, gl.NEAREST)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(target))
+	gl.Viewport(0, 0, d.width, d.height)
+
+	gl.DepthMask(false)
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.BLEND)
+	gl.Disable(gl.CULL_FACE)
+
+	//emission and directional lights, everywhere an object was drawn
+	//both passes read the G-buffer from the same units
+	d.bindGBuffer()
+	gl.UseProgram(d.directional.program)
+	gl.Uniform3fv(d.directional.location("cameraPosition"), 1, &state.Camera.Position[0])
+	state.bindDirShadowMaps()
+	gl.BindVertexArray(d.vao)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+
+	//point lights are added on top, each drawn as the back of its sphere where the sphere is behind the scene
+	gl.UseProgram(d.point.program)
+	viewProjection := projection.Mul4(view)
+	gl.UniformMatrix4fv(d.point.location("uViewProjection"), 1, false, &viewProjection[0])
+	gl.Uniform3fv(d.point.location("cameraPosition"), 1, &state.Camera.Position[0])
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.ONE, gl.ONE)
+	gl.CullFace(gl.FRONT)
+	gl.DepthFunc(gl.GEQUAL)
+	for i := range state.PointLights {
+		light := &state.PointLights[i]
+		lightRange := light.Range()
+		if lightRange == 0 {
+			continue
+		}
+		d.setPointLight(light)
+
+		if math.IsInf(float64(lightRange), 1) {
+			gl.Uniform1f(d.point.location("lightRange"), math.MaxFloat32)
+			gl.Uniform1i(d.point.location("fullscreen"), 1)
+			gl.Disable(gl.DEPTH_TEST)
+			gl.Disable(gl.CULL_FACE)
+			gl.BindVertexArray(d.vao)
+			gl.DrawArrays(gl.TRIANGLES, 0, 3)
+			continue
+		}
+		gl.Uniform1f(d.point.location("lightRange"), lightRange)
+		gl.Uniform1i(d.point.location("fullscreen"), 0)
+		gl.Uniform3fv(d.point.location("volumeCenter"), 1, &light.Position[0])
+		gl.Uniform1f(d.point.location("volumeRadius"), lightRange)
+		gl.Enable(gl.DEPTH_TEST)
+		gl.Enable(gl.CULL_FACE)
+		gl.BindVertexArray(d.volume)
+		gl.DrawElements(gl.TRIANGLES, d.volumeIndices, gl.UNSIGNED_INT, gl.Ptr(nil))
+	}
+
+	gl.CullFace(gl.BACK)
+	gl.Enable(gl.CULL_FACE)
+	gl.DepthFunc(gl.LESS)
+	gl.DepthMask(true)
+	gl.Enable(gl.DEPTH_TEST)
+	gl.Disable(gl.BLEND)
+	gl.BindVertexArray(0)
+	for unit := dirShadowUnits; unit < gBufferUnits+len(gBufferSamplers); unit++ {
+		gl.ActiveTexture(gl.TEXTURE0 + uint32(unit))
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+		gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	}
+	//the point light pass's shadow map
+	gl.ActiveTexture(gl.TEXTURE0 + uint32(pointShadowUnits))
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+// bindGBuffer - binds the G-buffer targets to the units of their samplers
+func (d *DeferredRenderer) bindGBuffer() {
+	for i := range gBufferSamplers {
+		bindUnit(gBufferUnits+i, gl.TEXTURE_2D, d.targets[i])
+	}
+}
+
+// setPointLight - uploads a point light and binds its shadow map for the point light pass
+func (d *DeferredRenderer) setPointLight(light *PointLight) {
+	p := d.point
+	gl.Uniform3fv(p.location("light.position"), 1, &light.Position[0])
+	gl.Uniform1f(p.location("light.strength"), light.Strength)
+	gl.Uniform3fv(p.location("light.color"), 1, &light.Colour[0])
+	gl.Uniform1f(p.location("light.farPlane"), light.FarPlane)
+	gl.Uniform1f(p.location("light.constant"), light.Constant)
+	gl.Uniform1f(p.location("light.linear"), light.Linear)
+	gl.Uniform1f(p.location("light.quadratic"), light.Quadratic)
+	gl.Uniform1i(p.location("light.shadow"), light.Shadow)
+	gl.Uniform1f(p.location("light.shadowSettings.bias"), *light.Bias)
+	gl.Uniform1f(p.location("light.shadowSettings.normalBias"), light.NormalBias)
+	gl.Uniform1i(p.location("light.shadowSettings.filterMode"), shadowFilters[light.Filter])
+	gl.Uniform1i(p.location("light.shadowSettings.filterSize"), light.FilterSize)
+	gl.Uniform1f(p.location("light.shadowSettings.lightSize"), light.LightSize)
+
+	if light.Shadow == 1 {
+		bindUnit(pointShadowUnits, gl.TEXTURE_CUBE_MAP, light.DepthMap)
+	}
+}
+
+// deleteTargets - frees the G-buffer
+func (d *DeferredRenderer) deleteTargets() {
+	if len(d.targets) > 0 {
+		gl.DeleteTextures(int32(len(d.targets)), &d.targets[0])
+		d.targets = nil
+	}
+	if d.depthRB != 0 {
+		gl.DeleteRenderbuffers(1, &d.depthRB)
+		d.depthRB = 0
+	}
+	if d.fbo != 0 {
+		gl.DeleteFramebuffers(1, &d.fbo)
+		d.fbo = 0
+	}
+}
+
+// Delete - frees the G-buffer, programs and vertex arrays
+func (d *DeferredRenderer) Delete() {
+	d.deleteTargets()
+	for _, program := range []uint32{d.gBuffer.Program, d.directional.program, d.point.program} {
+		if program != 0 {
+			gl.DeleteProgram(program)
+		}
+	}
+	d.gBuffer.Program, d.directional.program, d.point.program = 0, 0, 0
+	deleteVAO(d.volume)
+	if d.vao != 0 {
+		gl.DeleteVertexArrays(1, &d.vao)
+	}
+	d.volume, d.vao = 0, 0
+}
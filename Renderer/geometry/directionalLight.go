@@ -1,118 +1,203 @@
 package geometry
 
 import (
-	"fmt"
+	"encoding/json"
+	"math"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+const (
+	// MaxCascades - most shadow cascades a directional light can have, the size of the cascade arrays in the shaders
+	MaxCascades = 4
+	// DefaultCascades - cascades of a directional light that doesn't set cascades
+	DefaultCascades = 3
+	// DefaultShadowDistance - how far from the camera directional light shadows reach when shadowDistance isn't set
+	DefaultShadowDistance = 50.0
+	// DefaultSplitLambda - blend between uniform (0) and logarithmic (1) splits for the practical split scheme
+	DefaultSplitLambda = 0.5
+	// DefaultSunSize - how far a directional light's pcss penumbra spreads per unit between caster and receiver
+	DefaultSunSize = 0.05
+)
+
+// DirectionalLight - light shining from Position towards the point Direction. Its shadow map is a texture array with
+// one layer per cascade, each cascade covering a slice of the camera frustum that gets further away and bigger
 type DirectionalLight struct {
-	Name            string    `json:"name"`
-	Parent          string    `json:"parent"`
-	Colour          []float32 `json:"colour"`
-	Strength        float32   `json:"strength"`
-	Direction       []float32 `json:"direction"`
-	Position        []float32 `json:"position"`
-	DepthMap        uint32
-	LightViewMatrix mgl32.Mat4
+	Name           string    `json:"name"`
+	Parent         string    `json:"parent"`
+	Colour         []float32 `json:"colour"`
+	Strength       float32   `json:"strength"`
+	Direction      []float32 `json:"direction"`
+	Position       []float32 `json:"position"`
+	Cascades       int32     `json:"cascades"`
+	SplitScheme    string    `json:"splitScheme"`
+	SplitLambda    float32   `json:"splitLambda"`
+	ShadowDistance float32   `json:"shadowDistance"`
+	ShadowSettings
+	DepthMap         uint32
+	CascadeMatrices  []mgl32.Mat4
+	CascadeSplits    []float32
+	staticMap        uint32
+	staticGeneration int
+	staticMatrices   []mgl32.Mat4 //cascades the static casters were last drawn with
 }
 
-func (light *DirectionalLight) CreateDirectionalDepthMap(width, height int32) {
-	var depthMap uint32
-	gl.GenTextures(1, &depthMap)
-	gl.BindTexture(gl.TEXTURE_2D, depthMap)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	light.DepthMap = depthMap
+// UnmarshalJSON - decodes a directional light from a scene file. A light without a strength has a strength of 1,
+// the Editor never writes one
+func (light *DirectionalLight) UnmarshalJSON(data []byte) error {
+	//a type without this method, so decoding it doesn't recurse
+	type sceneLight DirectionalLight
+	decoded := sceneLight{Strength: 1}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*light = DirectionalLight(decoded)
+	return nil
 }
 
-func (light *DirectionalLight) BindDepthMap(state *State) {
-	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, 0, 0)
-	gl.BindFramebuffer(gl.FRAMEBUFFER, state.DepthFBO)
-	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, light.DepthMap, 0)
-	gl.DrawBuffer(gl.NONE)
-	gl.ReadBuffer(gl.NONE)
+// SetShadowDefaults - fills in the shadow settings the scene file left out
+func (light *DirectionalLight) SetShadowDefaults() {
+	if light.Cascades <= 0 {
+		light.Cascades = DefaultCascades
+	}
+	if light.Cascades > MaxCascades {
+		light.Cascades = MaxCascades
+	}
+	if light.SplitScheme == "" {
+		light.SplitScheme = "practical"
+	}
+	if light.SplitLambda == 0 {
+		light.SplitLambda = DefaultSplitLambda
+	}
+	if light.ShadowDistance <= 0 {
+		light.ShadowDistance = DefaultShadowDistance
+	}
+	light.ShadowSettings.setDefaults(light.Name, DefaultSunSize)
+}
 
-	//error check the framebuffer
-	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+// CreateDirectionalDepthMap - allocates the shadow map, one ShadowResolution sized layer per cascade
+func (light *DirectionalLight) CreateDirectionalDepthMap() {
+	light.DepthMap = newDepthArray(light.ShadowResolution, light.Cascades)
+}
 
-	if status != gl.FRAMEBUFFER_COMPLETE {
-		fmt.Println("ERROR WITH FRAMEBUFFER ", status)
-		panic(status)
+// newDepthArray - texture array of layers size by size depth textures
+func newDepthArray(size, layers int32) uint32 {
+	var depthMap uint32
+	gl.GenTextures(1, &depthMap)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, depthMap)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage3D(gl.TEXTURE_2D_ARRAY, 0, gl.DEPTH_COMPONENT32F, size, size, layers, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+	return depthMap
+}
+
+// TravelDirection - normalized direction the light shines in. Direction is the point the light is aimed at from
+// Position, the same way the shadow map is rendered
+func (light *DirectionalLight) TravelDirection() mgl32.Vec3 {
+	position := mgl32.Vec3{light.Position[0], light.Position[1], light.Position[2]}
+	target := mgl32.Vec3{light.Direction[0], light.Direction[1], light.Direction[2]}
+	direction := target.Sub(position)
+	if direction.Len() == 0 {
+		return mgl32.Vec3{0, -1, 0}
 	}
-	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	return direction.Normalize()
 }
 
-func (light *DirectionalLight) CreateLightSpaceTransforms(near, far float32) {
-	lightProj := mgl32.Ortho(-10.0, 10.0, -10.0, 10.0, near, far)
-	lightView := mgl32.LookAtV(
-		mgl32.Vec3{light.Position[0], light.Position[1], light.Position[2]},
-		mgl32.Vec3{light.Direction[0], light.Direction[1], light.Direction[2]},
-		mgl32.Vec3{0.0, 1.0, 0.0})
-	lightSpace := lightProj.Mul4(lightView)
-	light.LightViewMatrix = lightSpace
+// splitDistances - distance from the camera to the far end of each cascade, between near and far
+func (light *DirectionalLight) splitDistances(near, far float32) []float32 {
+	splits := make([]float32, light.Cascades)
+	for i := range splits {
+		p := float32(i+1) / float32(light.Cascades)
+		uniform := near + (far-near)*p
+		logarithmic := near * float32(math.Pow(float64(far/near), float64(p)))
+
+		switch light.SplitScheme {
+		case "uniform":
+			splits[i] = uniform
+		case "logarithmic":
+			splits[i] = logarithmic
+		default:
+			splits[i] = light.SplitLambda*logarithmic + (1-light.SplitLambda)*uniform
+		}
+	}
+	return splits
 }
 
-func (light *DirectionalLight) ShadowRender(state *State, object Geometry, shadowProgramInfo *ProgramInfo) {
-	gl.UseProgram(shadowProgramInfo.Program)
-	currentModel, err := object.GetModel()
+// UpdateCascades - fits every cascade to its slice of the camera frustum, called each frame before the shadow pass.
+// view is the camera's view matrix and fovy, aspect, near and far its perspective projection
+func (light *DirectionalLight) UpdateCascades(view mgl32.Mat4, fovy, aspect, near, far float32) {
+	distance := far
+	if light.ShadowDistance < distance {
+		distance = light.ShadowDistance
+	}
+	light.CascadeSplits = light.splitDistances(near, distance)
+	light.CascadeMatrices = make([]mgl32.Mat4, len(light.CascadeSplits))
 
-	if err != nil {
-		//throw an error
-		fmt.Printf("ERROR getting model!")
+	direction := light.TravelDirection()
+	up := mgl32.Vec3{0, 1, 0}
+	if math.Abs(float64(direction.Y())) > 0.99 {
+		up = mgl32.Vec3{0, 0, 1}
 	}
-	_, _, parent := object.GetDetails()
-	currentCentroid := object.GetCentroid()
-	currentVertices := object.GetVertices()
-	currentBuffers := object.GetBuffers()
-	modelMatrix := mgl32.Ident4()
-
-	//move to centroid
-	centroidMat := mgl32.Translate3D(currentCentroid[0], currentCentroid[1], currentCentroid[2])
-	modelMatrix = modelMatrix.Mul4(centroidMat)
-
-	//rotation
-	modelMatrix = modelMatrix.Mul4(currentModel.Rotation)
-
-	//position
-	positionMat := mgl32.Translate3D(currentModel.Position[0], currentModel.Position[1], currentModel.Position[2])
-	modelMatrix = modelMatrix.Mul4(positionMat)
-
-	//negative centroid
-	negCent := mgl32.Translate3D(-currentCentroid[0], -currentCentroid[1], -currentCentroid[2])
-	modelMatrix = modelMatrix.Mul4(negCent)
-
-	//scale
-	modelMatrix = ScaleM4(modelMatrix, currentModel.Scale)
-
-	if parent != "" {
-		parentObj := GetSceneObject(parent, (*state))
-		if parentObj != nil {
-			parentMMatrix, err := parentObj.GetModelMatrix()
-			if err == nil {
-				modelMatrix = modelMatrix.Mul4(parentMMatrix)
+	lightRotation := mgl32.LookAtV(mgl32.Vec3{}, direction, up)
+	inverseRotation := lightRotation.Inv()
+	inverseView := view.Inv()
+
+	tanY := float32(math.Tan(float64(fovy / 2)))
+	tanX := tanY * aspect
+	start := near
+	for i, end := range light.CascadeSplits {
+		var corners []mgl32.Vec3
+		var center mgl32.Vec3
+		for _, depth := range []float32{start, end} {
+			for _, corner := range [][2]float32{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+				viewCorner := mgl32.Vec3{corner[0] * depth * tanX, corner[1] * depth * tanY, -depth}
+				worldCorner := mgl32.TransformCoordinate(viewCorner, inverseView)
+				corners = append(corners, worldCorner)
+				center = center.Add(worldCorner)
+			}
+		}
+		center = center.Mul(1 / float32(len(corners)))
+
+		//a bounding sphere keeps the cascade the same size however the camera turns
+		var radius float32
+		for _, corner := range corners {
+			if d := corner.Sub(center).Len(); d > radius {
+				radius = d
 			}
-		} else {
-			fmt.Println("ERROR GETTING PARENT OBJECT")
 		}
+		radius = float32(math.Ceil(float64(radius*16))) / 16
+
+		//move the centre in whole shadow map texels so shadow edges don't shimmer as the camera moves
+		texel := 2 * radius / float32(light.ShadowResolution)
+		lightCenter := mgl32.TransformCoordinate(center, lightRotation)
+		lightCenter[0] = float32(math.Floor(float64(lightCenter[0]/texel))) * texel
+		lightCenter[1] = float32(math.Floor(float64(lightCenter[1]/texel))) * texel
+		center = mgl32.TransformCoordinate(lightCenter, inverseRotation)
+
+		//casters between the light and the sphere are clamped onto the near plane by the shadow pass
+		lightView := mgl32.LookAtV(center.Sub(direction.Mul(radius)), center, up)
+		lightProj := mgl32.Ortho(-radius, radius, -radius, radius, 0, 2*radius)
+		light.CascadeMatrices[i] = lightProj.Mul4(lightView)
+		start = end
 	}
-	// if light.Move {
-	// 	light.CreateLightSpaceTransforms(0.5, 25, 1024, 1024)
-	// }
-
-	light.CreateLightSpaceTransforms(0.5, 25.0)
-	gl.UniformMatrix4fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str("uModelMatrix\x00")), 1, false, &modelMatrix[0])
-	gl.UniformMatrix4fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str("lightSpaceMatrix\x00")), 1, false, &light.LightViewMatrix[0])
-	gl.BindVertexArray(currentBuffers.Vao)
-
-	if object.GetType() != "mesh" {
-		gl.DrawElements(gl.TRIANGLES, int32(len(currentVertices.Vertices)), gl.UNSIGNED_INT, gl.Ptr(nil))
-	} else {
-		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(currentVertices.Vertices)))
+}
+
+// ShadowRender - draws copies of an object, see State.DrawCopies, into the shadow map layer of cascade, which has to
+// be bound already
+func (light *DirectionalLight) ShadowRender(state *State, copies []Geometry, shadowProgramInfo *ProgramInfo, cascade int) {
+	gl.UseProgram(shadowProgramInfo.Program)
+	object := copies[0]
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
 	}
+
+	gl.UniformMatrix4fv(shadowProgramInfo.UniformLocations.Model, 1, false, &modelMatrix[0])
+	gl.UniformMatrix4fv(shadowProgramInfo.UniformLocations.LightSpaceMatrix, 1, false, &light.CascadeMatrices[cascade][0])
+	state.DrawCopies(shadowProgramInfo.UniformLocations, copies)
 	gl.BindVertexArray(0)
 }
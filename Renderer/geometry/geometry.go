@@ -25,6 +25,7 @@ type Geometry interface {
 	GetShaderVal() shader.Shader
 	GetDiffuseTexture() *texture.Texture
 	GetNormalTexture() *texture.Texture
+	GetPBRTextures() PBRTextures
 	GetMaterial() Material
 	GetBuffers() ObjectBuffers
 	GetShadowBuffers() ObjectBuffers
@@ -32,6 +33,12 @@ type Geometry interface {
 	GetModelMatrix() (mgl32.Mat4, error)
 	GetReflectionValues() (int, float32)
 	SetRotation(mgl32.Mat4)
+	GetQuat() mgl32.Quat
+	SetQuat(mgl32.Quat)
+	Rotate(mgl32.Vec3, float32)
+	SetEuler(float32, float32, float32)
+	LookAt(mgl32.Vec3)
+	Slerp(mgl32.Quat, float32)
 	SetModelMatrix(mgl32.Mat4)
 	SetParent(string)
 	Scale(mgl32.Vec3)
@@ -44,6 +51,7 @@ type Geometry interface {
 	AddForce(mgl32.Vec3)
 	GetForce() mgl32.Vec3
 	SetForce(mgl32.Vec3)
+	Destroy()
 }
 
 // Attributes : struct for holding vertex attribute locations
@@ -132,6 +140,42 @@ type Uniforms struct {
 	DepthMap       int32
 	ShadowMatrices int32
 	LightPos       int32
+
+	NormalTexture    int32
+	FarPlane         int32
+	LightSpaceMatrix int32
+	PointShadowMaps  int32
+	DirShadowMaps    int32
+	Skybox           int32
+	SkyboxPresent    int32
+	Reflective       int32
+	RefractiveIndex  int32
+
+	BaseColorVal             int32
+	MetallicVal              int32
+	RoughnessVal             int32
+	AOVal                    int32
+	EmissiveVal              int32
+	TextureMaps              int32
+	MetallicRoughnessTexture int32
+	OcclusionTexture         int32
+	EmissiveTexture          int32
+	ShadingModel             int32
+	TransparentPass          int32
+	SSAOEnabled              int32
+
+	ProbePresent       int32
+	ProbePosition      int32
+	ProbeBoxProjection int32
+	ProbeBoxMin        int32
+	ProbeBoxMax        int32
+
+	MirrorPresent    int32
+	MirrorPixel      int32
+	MirrorStrength   int32
+	MirrorDistortion int32
+
+	Instanced int32
 }
 
 // ProgramInfo : struct for holding program info (program, uniforms, attributes)
@@ -156,6 +200,19 @@ type Material struct {
 	Alpha          float32
 	DiffuseTexture string
 	NormalTexture  string
+
+	//metallic-roughness values used by PBRShaderType, see pbrMaterial.go
+	BaseColor                []float32 `json:"baseColor"`
+	Metallic                 float32   `json:"metallic"`
+	Roughness                float32   `json:"roughness"`
+	AO                       float32   `json:"ao"`
+	Emissive                 []float32 `json:"emissive"`
+	MetallicRoughnessTexture string    `json:"metallicRoughnessTexture"`
+	OcclusionTexture         string    `json:"occlusionTexture"`
+	EmissiveTexture          string    `json:"emissiveTexture"`
+
+	//makes a Plane reflect the scene like a mirror or still water, see planarMirror.go
+	Mirror *PlanarMirror `json:"mirror"`
 }
 
 // Model : struct for holding model info
@@ -0,0 +1,416 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// WindowSamples - MSAA samples of the HDR target in windowed mode, the same number the window asks for
+const WindowSamples = 8
+
+// luminanceSize - width and height of the log luminance texture auto exposure averages, a power of two so its mip
+// chain ends in one texel
+const luminanceSize = 256
+
+// postProgram - a post processing program and the locations of the uniforms it has been given so far
+type postProgram struct {
+	program   uint32
+	locations map[string]int32
+}
+
+// newPostProgram - builds a fullscreen program
+func newPostProgram(s shader.Shader) postProgram {
+	s.Setup()
+	return postProgram{
+		program:   InitOpenGL(s.GetVertShader(), s.GetFragShader(), s.GetGeometryShader()),
+		locations: make(map[string]int32),
+	}
+}
+
+// location - location of a uniform, looked up the first time it is asked for. -1 for uniforms the program doesn't
+// use, which gl.Uniform ignores
+func (p postProgram) location(name string) int32 {
+	loc, found := p.locations[name]
+	if !found {
+		loc = gl.GetUniformLocation(p.program, gl.Str(name+"\x00"))
+		p.locations[name] = loc
+	}
+	return loc
+}
+
+// bindTexture - binds a texture and points a sampler uniform at it. Post passes number their own units from 0, see
+// textureUnits.go
+func (p postProgram) bindTexture(name string, unit, target, texture uint32) {
+	gl.ActiveTexture(gl.TEXTURE0 + unit)
+	gl.BindTexture(target, texture)
+	gl.Uniform1i(p.location(name), int32(unit))
+}
+
+// colorTarget - a texture and the framebuffer drawing into it
+type colorTarget struct {
+	fbo     uint32
+	texture uint32
+}
+
+// newColorTarget - creates an empty texture to render into and its framebuffer
+func newColorTarget(internalFormat int32, format uint32, width, height int32, minFilter int32) (colorTarget, error) {
+	target := colorTarget{texture: newColorTexture(internalFormat, format, width, height, minFilter)}
+	gl.GenFramebuffers(1, &target.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, target.texture, 0)
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		return target, fmt.Errorf("post processing framebuffer incomplete: 0x%x", status)
+	}
+	return target, nil
+}
+
+// newColorTexture - creates an empty texture to render into
+func newColorTexture(internalFormat int32, format uint32, width, height int32, minFilter int32) uint32 {
+	var texture uint32
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, width, height, 0, format, gl.FLOAT, nil)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return texture
+}
+
+// delete - frees the texture and framebuffer
+func (t *colorTarget) delete() {
+	gl.DeleteFramebuffers(1, &t.fbo)
+	gl.DeleteTextures(1, &t.texture)
+	t.fbo, t.texture = 0, 0
+}
+
+// HDRPipeline - the floating point target the scene is drawn into and the passes that turn it into the final
+// frame: the HDR post effects, tone mapping and the display post effects, see postProcess.go. With auto exposure
+// the average luminance of each frame is found on the GPU, by rendering the log luminance into a small texture and
+// reading its last mip level, and the adapted luminance is kept in a pair of one texel textures that are written in
+// turn, so nothing is read back
+type HDRPipeline struct {
+	samples int32
+	width   int32
+	height  int32
+
+	sceneFBO     uint32 //what the scene is drawn into, multisampled when samples > 0
+	resolved     bool   //the frame was drawn straight into hdr[0], see BeginResolved
+	colorRB      uint32
+	depthRB      uint32
+	hdr          [2]colorTarget //RGBA16F, hdr[0] also has depthTexture attached and holds the resolved scene
+	depthTexture uint32
+	ldr          [2]colorTarget //RGBA8 targets the display effects take turns drawing into
+	bloom        [2]colorTarget //half size RGBA16F targets the bloom is blurred in
+
+	luminance colorTarget
+	adapted   [2]colorTarget
+	current   int  //adapted target written last
+	exposed   bool //false until auto exposure has seen a frame, the first one isn't eased into
+
+	time     float64 //seconds of frames resolved so far
+	warned   map[string]bool
+	vao      uint32
+	toneMap  postProgram
+	logLum   postProgram
+	adaptLum postProgram
+	effects  map[string]postProgram //post effect programs by shader name, built the first time they are used
+}
+
+// NewHDRPipeline - builds the tone mapping programs and the auto exposure textures. The HDR target itself is made
+// by Begin once the frame size is known
+func NewHDRPipeline(samples int32) (*HDRPipeline, error) {
+	p := HDRPipeline{
+		samples: samples,
+		warned:  make(map[string]bool),
+		effects: make(map[string]postProgram),
+	}
+
+	p.toneMap = newPostProgram(&shader.ToneMapShader{})
+	p.logLum = newPostProgram(&shader.LuminanceShader{})
+	p.adaptLum = newPostProgram(&shader.AdaptationShader{})
+
+	//the fullscreen triangle comes from gl_VertexID but a core context still needs a vertex array bound
+	gl.GenVertexArrays(1, &p.vao)
+
+	var err error
+	p.luminance, err = newColorTarget(gl.R16F, gl.RED, luminanceSize, luminanceSize, gl.LINEAR_MIPMAP_LINEAR)
+	if err != nil {
+		p.Delete()
+		return nil, err
+	}
+	gl.BindTexture(gl.TEXTURE_2D, p.luminance.texture)
+	gl.GenerateMipmap(gl.TEXTURE_2D)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	for i := range p.adapted {
+		p.adapted[i], err = newColorTarget(gl.R32F, gl.RED, 1, 1, gl.NEAREST)
+		if err != nil {
+			p.Delete()
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// Begin - binds the HDR target for the scene to be drawn into, remaking it first if the frame size changed
+func (p *HDRPipeline) Begin(width, height int32) error {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if p.sceneFBO == 0 || width != p.width || height != p.height {
+		if err := p.createTargets(width, height); err != nil {
+			return err
+		}
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.sceneFBO)
+	gl.Viewport(0, 0, width, height)
+	p.resolved = false
+	return nil
+}
+
+// BeginResolved - like Begin but binds the single sampled target Resolve reads, for frames whose lighting passes
+// read per pixel buffers and can't be multisampled, see DeferredRenderer
+func (p *HDRPipeline) BeginResolved(width, height int32) error {
+	if err := p.Begin(width, height); err != nil {
+		return err
+	}
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.hdr[0].fbo)
+	p.resolved = true
+	return nil
+}
+
+// createTargets - makes the RGBA16F colour and 24 bit depth buffers the scene is drawn into and the targets the
+// post effects draw into
+func (p *HDRPipeline) createTargets(width, height int32) error {
+	p.deleteTargets()
+	p.width = width
+	p.height = height
+
+	var err error
+	for i := range p.hdr {
+		if p.hdr[i], err = newColorTarget(gl.RGBA16F, gl.RGBA, width, height, gl.LINEAR); err != nil {
+			return err
+		}
+	}
+	for i := range p.ldr {
+		if p.ldr[i], err = newColorTarget(gl.RGBA8, gl.RGBA, width, height, gl.LINEAR); err != nil {
+			return err
+		}
+	}
+	for i := range p.bloom {
+		if p.bloom[i], err = newColorTarget(gl.RGBA16F, gl.RGBA, halfSize(width), halfSize(height), gl.LINEAR); err != nil {
+			return err
+		}
+	}
+
+	//depth is a texture so effects like depth of field can read it
+	gl.GenTextures(1, &p.depthTexture)
+	gl.BindTexture(gl.TEXTURE_2D, p.depthTexture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.DEPTH_COMPONENT24, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.hdr[0].fbo)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, p.depthTexture, 0)
+
+	if p.samples == 0 {
+		p.sceneFBO = p.hdr[0].fbo
+	} else {
+		gl.GenFramebuffers(1, &p.sceneFBO)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, p.sceneFBO)
+		gl.GenRenderbuffers(1, &p.colorRB)
+		gl.BindRenderbuffer(gl.RENDERBUFFER, p.colorRB)
+		gl.RenderbufferStorageMultisample(gl.RENDERBUFFER, p.samples, gl.RGBA16F, width, height)
+		gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, p.colorRB)
+		gl.GenRenderbuffers(1, &p.depthRB)
+		gl.BindRenderbuffer(gl.RENDERBUFFER, p.depthRB)
+		gl.RenderbufferStorageMultisample(gl.RENDERBUFFER, p.samples, gl.DEPTH_COMPONENT24, width, height)
+		gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, p.depthRB)
+		gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+	}
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		return fmt.Errorf("HDR framebuffer incomplete: 0x%x", status)
+	}
+	return nil
+}
+
+// halfSize - size of a half resolution target, at least one pixel
+func halfSize(size int32) int32 {
+	if size < 2 {
+		return 1
+	}
+	return size / 2
+}
+
+// PostFrame - what the post passes need to know about the frame being resolved
+type PostFrame struct {
+	Target    uint32  //framebuffer the final image goes to, 0 is the window
+	DeltaTime float64 //seconds since the last frame, auto exposure adapts and film grain moves over it
+	Near      float32 //clip planes the depth buffer was drawn with
+	Far       float32
+}
+
+// Resolve - turns the frame drawn since Begin into the final image: runs the HDR post effects, tone maps and runs
+// the display post effects, in the order settings.PostProcess lists them
+func (p *HDRPipeline) Resolve(settings *Settings, frame PostFrame) {
+	p.time += frame.DeltaTime
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.BLEND)
+	gl.Disable(gl.CULL_FACE)
+	gl.BindVertexArray(p.vao)
+
+	if p.sceneFBO != p.hdr[0].fbo && !p.resolved {
+		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, p.sceneFBO)
+		gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, p.hdr[0].fbo)
+		gl.BlitFramebuffer(0, 0, p.width, p.height, 0, 0, p.width, p.height, gl.COLOR_BUFFER_BIT|gl.DEPTH_BUFFER_BIT, gl.NEAREST)
+	}
+
+	toneMapping := settings.ToneMapping
+	if toneMapping.AutoExposure {
+		p.adaptExposure(toneMapping, frame.DeltaTime)
+	} else {
+		p.exposed = false
+	}
+
+	hdrEffects, displayEffects := p.activeEffects(settings.PostProcess)
+
+	//each pass reads the last one's output and draws into the other target of the pair
+	source := 0
+	for _, effect := range hdrEffects {
+		p.runEffect(effect, p.hdr[source].texture, p.hdr[1-source].fbo, frame)
+		source = 1 - source
+	}
+
+	target := frame.Target
+	if len(displayEffects) > 0 {
+		target = p.ldr[0].fbo
+	}
+	p.toneMapPass(toneMapping, p.hdr[source].texture, target)
+
+	source = 0
+	for i, effect := range displayEffects {
+		target = p.ldr[1-source].fbo
+		if i == len(displayEffects)-1 {
+			target = frame.Target
+		}
+		p.runEffect(effect, p.ldr[source].texture, target, frame)
+		source = 1 - source
+	}
+
+	for unit := uint32(0); unit < 4; unit++ {
+		gl.ActiveTexture(gl.TEXTURE0 + unit)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		gl.BindTexture(gl.TEXTURE_3D, 0)
+	}
+	gl.BindVertexArray(0)
+}
+
+// Reset - forgets the exposure the last frames adapted to and restarts the effect clock, for a render that must
+// not depend on what was drawn before it
+func (p *HDRPipeline) Reset() {
+	p.exposed = false
+	p.time = 0
+}
+
+// toneMapPass - applies the exposure, the operator and the output encoding
+func (p *HDRPipeline) toneMapPass(settings ToneMapping, source, target uint32) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target)
+	gl.Viewport(0, 0, p.width, p.height)
+	gl.UseProgram(p.toneMap.program)
+	p.toneMap.bindTexture("hdrTexture", 0, gl.TEXTURE_2D, source)
+	autoExposure := int32(0)
+	if settings.AutoExposure {
+		autoExposure = 1
+		p.toneMap.bindTexture("adaptedLuminance", 1, gl.TEXTURE_2D, p.adapted[p.current].texture)
+	}
+	gl.Uniform1i(p.toneMap.location("autoExposure"), autoExposure)
+	gl.Uniform1i(p.toneMap.location("toneMapOperator"), toneMapOperators[settings.Operator])
+	gl.Uniform1i(p.toneMap.location("outputMode"), toneMapOutputs[settings.Output])
+	gl.Uniform1f(p.toneMap.location("exposure"), settings.Exposure)
+	gl.Uniform1f(p.toneMap.location("keyValue"), settings.KeyValue)
+	gl.Uniform1f(p.toneMap.location("gamma"), settings.Gamma)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+}
+
+// adaptExposure - averages the luminance of the frame and eases the adapted luminance towards it
+func (p *HDRPipeline) adaptExposure(settings ToneMapping, deltaTime float64) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.luminance.fbo)
+	gl.Viewport(0, 0, luminanceSize, luminanceSize)
+	gl.UseProgram(p.logLum.program)
+	p.logLum.bindTexture("hdrTexture", 0, gl.TEXTURE_2D, p.hdr[0].texture)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+	gl.BindTexture(gl.TEXTURE_2D, p.luminance.texture)
+	gl.GenerateMipmap(gl.TEXTURE_2D)
+
+	rate := float32(1)
+	if p.exposed {
+		rate = float32(1 - math.Exp(-deltaTime*float64(settings.AdaptationSpeed)))
+	}
+	p.exposed = true
+
+	next := 1 - p.current
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.adapted[next].fbo)
+	gl.Viewport(0, 0, 1, 1)
+	gl.UseProgram(p.adaptLum.program)
+	p.adaptLum.bindTexture("logLuminance", 0, gl.TEXTURE_2D, p.luminance.texture)
+	p.adaptLum.bindTexture("previousLuminance", 1, gl.TEXTURE_2D, p.adapted[p.current].texture)
+	gl.Uniform1f(p.adaptLum.location("lastLevel"), float32(math.Log2(luminanceSize)))
+	gl.Uniform1f(p.adaptLum.location("rate"), rate)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+	p.current = next
+}
+
+// deleteTargets - frees the HDR colour and depth buffers and the post effect targets
+func (p *HDRPipeline) deleteTargets() {
+	if p.sceneFBO != p.hdr[0].fbo {
+		gl.DeleteFramebuffers(1, &p.sceneFBO)
+	}
+	p.sceneFBO = 0
+	gl.DeleteRenderbuffers(1, &p.colorRB)
+	gl.DeleteRenderbuffers(1, &p.depthRB)
+	gl.DeleteTextures(1, &p.depthTexture)
+	p.colorRB, p.depthRB, p.depthTexture = 0, 0, 0
+	for i := 0; i < 2; i++ {
+		p.hdr[i].delete()
+		p.ldr[i].delete()
+		p.bloom[i].delete()
+	}
+}
+
+// Delete - frees the targets, the auto exposure textures and the programs
+func (p *HDRPipeline) Delete() {
+	p.deleteTargets()
+	p.luminance.delete()
+	p.adapted[0].delete()
+	p.adapted[1].delete()
+	gl.DeleteVertexArrays(1, &p.vao)
+	programs := []postProgram{p.toneMap, p.logLum, p.adaptLum}
+	for _, program := range p.effects {
+		programs = append(programs, program)
+	}
+	for _, program := range programs {
+		if program.program != 0 {
+			gl.DeleteProgram(program.program)
+		}
+	}
+	p.effects = make(map[string]postProgram)
+}
@@ -0,0 +1,167 @@
+package geometry
+
+import (
+	"fmt"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+const (
+	irradianceSize  = 16
+	prefilterSize   = 128
+	prefilterLevels = 5 //PREFILTER_LEVELS in shader/imageBasedLighting.go, roughness 0 to 1 in even steps
+	brdfLUTSize     = 128
+)
+
+// environmentSamplers - samplers the lit shaders read the skybox's light from, the ith one on environmentUnits+i
+var environmentSamplers = [...]string{"irradianceMap", "prefilteredMap", "brdfLUT"}
+
+// precomputeEnvironment - convolves the skybox into the maps image based lighting reads: the irradiance map, the
+// sky's light on a surface facing each direction, the prefiltered map, whose mip levels hold the sky as surfaces of
+// growing roughness reflect it, and the BRDF LUT the prefiltered colour is scaled by
+func (s *Skybox) precomputeEnvironment() error {
+	//blurred lookups cross the edges of the faces, which would show as seams
+	gl.Enable(gl.TEXTURE_CUBE_MAP_SEAMLESS)
+	pass := beginOffscreenPass()
+
+	s.irradiance = newCubeTexture(irradianceSize, 1)
+	s.prefiltered = newCubeTexture(prefilterSize, prefilterLevels)
+	s.brdfLUT = newColorTexture(gl.RG16F, gl.RG, brdfLUTSize, brdfLUTSize, gl.LINEAR)
+
+	irradiance := newPostProgram(&shader.IrradianceShader{})
+	gl.UseProgram(irradiance.program)
+	irradiance.bindTexture("environment", 0, gl.TEXTURE_CUBE_MAP, s.CubeMap)
+	err := renderCubeFaces(irradiance, s.irradiance, 0, irradianceSize)
+
+	prefilter := newPostProgram(&shader.PrefilterShader{})
+	gl.UseProgram(prefilter.program)
+	gl.Uniform1i(prefilter.location("environment"), 0)
+	for level := int32(0); level < prefilterLevels && err == nil; level++ {
+		gl.Uniform1f(prefilter.location("roughness"), float32(level)/(prefilterLevels-1))
+		err = renderCubeFaces(prefilter, s.prefiltered, level, prefilterSize>>uint(level))
+	}
+
+	lut := newPostProgram(&shader.BRDFLUTShader{})
+	if err == nil {
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, s.brdfLUT, 0)
+		if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+			err = fmt.Errorf("BRDF LUT framebuffer incomplete: 0x%x", status)
+		} else {
+			gl.UseProgram(lut.program)
+			gl.Viewport(0, 0, brdfLUTSize, brdfLUTSize)
+			gl.DrawArrays(gl.TRIANGLES, 0, 3)
+		}
+	}
+
+	for _, program := range []uint32{irradiance.program, prefilter.program, lut.program} {
+		gl.DeleteProgram(program)
+	}
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	pass.end()
+
+	if err != nil {
+		s.deleteEnvironment()
+	}
+	return err
+}
+
+// offscreenPass - a framebuffer and an empty vertex array for drawing fullscreen passes into textures while a scene
+// loads, and the framebuffer and viewport to go back to afterwards
+type offscreenPass struct {
+	fbo      uint32
+	vao      uint32
+	target   int32
+	viewport [4]int32
+}
+
+// beginOffscreenPass - remembers the bound framebuffer and viewport and binds a new framebuffer to draw into, with
+// depth testing, culling and blending off
+func beginOffscreenPass() offscreenPass {
+	var pass offscreenPass
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &pass.target)
+	gl.GetIntegerv(gl.VIEWPORT, &pass.viewport[0])
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.CULL_FACE)
+	gl.Disable(gl.BLEND)
+
+	gl.GenFramebuffers(1, &pass.fbo)
+	gl.GenVertexArrays(1, &pass.vao)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, pass.fbo)
+	gl.BindVertexArray(pass.vao)
+	return pass
+}
+
+// end - frees the pass and binds the framebuffer and viewport it started from again
+func (pass offscreenPass) end() {
+	gl.BindVertexArray(0)
+	gl.DeleteVertexArrays(1, &pass.vao)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(pass.target))
+	gl.DeleteFramebuffers(1, &pass.fbo)
+	gl.Viewport(pass.viewport[0], pass.viewport[1], pass.viewport[2], pass.viewport[3])
+	gl.Enable(gl.DEPTH_TEST)
+	gl.Enable(gl.CULL_FACE)
+}
+
+// newCubeTexture - creates an empty floating point cube map with the given number of mip levels to render into
+func newCubeTexture(size, levels int32) uint32 {
+	var texture uint32
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, texture)
+	for level := int32(0); level < levels; level++ {
+		levelSize := size >> uint(level)
+		for face := uint32(0); face < 6; face++ {
+			gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X+face, level, gl.RGB16F, levelSize, levelSize, 0, gl.RGB, gl.FLOAT, nil)
+		}
+	}
+	if levels > 1 {
+		gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	} else {
+		gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	}
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAX_LEVEL, levels-1)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	return texture
+}
+
+// renderCubeFaces - draws the program, which is in use, into the six faces of a mip level of a cube map
+func renderCubeFaces(program postProgram, texture uint32, level, size int32) error {
+	gl.Viewport(0, 0, size, size)
+	for face := uint32(0); face < 6; face++ {
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_CUBE_MAP_POSITIVE_X+face, texture, level)
+		if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+			return fmt.Errorf("environment map framebuffer incomplete: 0x%x", status)
+		}
+		gl.Uniform1i(program.location("face"), int32(face))
+		gl.DrawArrays(gl.TRIANGLES, 0, 3)
+	}
+	return nil
+}
+
+// BindEnvironment - binds the maps the lit shaders take the skybox's light from to their units, once per frame
+// before anything is drawn with them. Does nothing without a skybox
+func (s *Skybox) BindEnvironment() {
+	if s.irradiance == 0 {
+		return
+	}
+	targets := []uint32{gl.TEXTURE_CUBE_MAP, gl.TEXTURE_CUBE_MAP, gl.TEXTURE_2D}
+	textures := []uint32{s.irradiance, s.prefiltered, s.brdfLUT}
+	for i := range textures {
+		bindFrameUnit(environmentUnits+i, targets[i], textures[i])
+	}
+}
+
+// deleteEnvironment - frees the environment maps
+func (s *Skybox) deleteEnvironment() {
+	for _, texture := range []*uint32{&s.irradiance, &s.prefiltered, &s.brdfLUT} {
+		if *texture != 0 {
+			gl.DeleteTextures(1, texture)
+			*texture = 0
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package geometry
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"../parser"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// instance attribute locations, see shader/instancing.go
+const (
+	instanceModelLocation  = 5 //a mat4 takes 5 to 8
+	instanceNormalLocation = 9 //a mat3 takes 9 to 11
+)
+
+// instanceFloats - floats each copy takes in an instance buffer, its model matrix then its normal matrix
+const instanceFloats = 16 + 9
+
+// SceneInstance - one copy of a mesh with an instances list, which is loaded as a copy for each entry instead of
+// the object itself. Scale and rotation are the object's when left out
+type SceneInstance struct {
+	Position   []float32 `json:"position"`
+	Scale      []float32 `json:"scale"`
+	Rotation   []float32 `json:"rotation"`
+	Quaternion []float32 `json:"quaternion"`
+	Euler      []float32 `json:"euler"`
+}
+
+// instanceName - name of the i'th copy of an object with an instances list
+func instanceName(name string, i int) string {
+	return fmt.Sprintf("%s[%d]", name, i)
+}
+
+// sceneObject - the scene object the i'th copy of sceneObj is loaded from
+func (instance SceneInstance) sceneObject(sceneObj SceneObject, i int) SceneObject {
+	loaded := sceneObj
+	loaded.Name = instanceName(sceneObj.Name, i)
+	loaded.Instances = nil
+	loaded.Position = instance.Position
+	if len(instance.Scale) == 3 {
+		loaded.Scale = instance.Scale
+	}
+	if instance.Rotation != nil || instance.Quaternion != nil || instance.Euler != nil {
+		loaded.Rotation, loaded.Quaternion, loaded.Euler = instance.Rotation, instance.Quaternion, instance.Euler
+	}
+	return loaded
+}
+
+// instancing - what the objects of the current scene share. A part of a mesh loaded like one loaded before it shares
+// that one's program, vertex array and textures, and the parts that share them and don't reflect are drawn together
+// as an instance group
+type instancing struct {
+	meshFiles map[string][]parser.OBJObject //parsed obj files by model
+	meshes    map[string]*ModelObject       //first part loaded for each meshKey
+	groups    map[Geometry]*instanceGroup   //group of each member
+	list      []*instanceGroup
+}
+
+// instanceGroup - ModelObjects drawn with one instanced call. The matrices of the copies drawn go into buffer, which
+// is attached to the vertex array they share
+type instanceGroup struct {
+	members []Geometry //the members still in the scene, in the order of State.Objects
+	vao     uint32
+	buffer  uint32
+	size    int //bytes buffer has room for
+	data    []float32
+}
+
+// meshKey - what a part of a mesh is loaded from, parts with the same key look the same and can share everything
+func meshKey(sceneObj SceneObject, object, part int, mtl bool, mat Material) string {
+	material, _ := json.Marshal(mat)
+	return fmt.Sprintf("%s|%d|%d|%t|%d|%g|%s", sceneObj.Model, object, part, mtl, sceneObj.Reflective, sceneObj.RefractionIndex, material)
+}
+
+// meshFile - loadMeshFile, parsing each model once per scene however many objects load it
+func (s *State) meshFile(model, meshPath string) ([]parser.OBJObject, error) {
+	if objects, found := s.instances.meshFiles[model]; found {
+		return objects, nil
+	}
+	objects, err := loadMeshFile(model, meshPath)
+	if err != nil {
+		return nil, err
+	}
+	if s.instances.meshFiles == nil {
+		s.instances.meshFiles = make(map[string][]parser.OBJObject)
+	}
+	s.instances.meshFiles[model] = objects
+	return objects, nil
+}
+
+// sharedMesh - the part loaded with key that later parts like it share, nil if there isn't one yet
+func (s *State) sharedMesh(key string) *ModelObject {
+	return s.instances.meshes[key]
+}
+
+// addSharedMesh - lets later parts loaded with key share the resources of part, if none loaded before it
+func (s *State) addSharedMesh(key string, part *ModelObject) {
+	if s.instances.meshes == nil {
+		s.instances.meshes = make(map[string]*ModelObject)
+	}
+	if s.instances.meshes[key] == nil {
+		s.instances.meshes[key] = part
+	}
+}
+
+// groupInstances - puts the objects that share another's resources into a group with it, once the scene's objects
+// are loaded. Reflective objects each see their nearest reflection probe, so they are drawn on their own
+func (s *State) groupInstances() {
+	s.instances.groups = make(map[Geometry]*instanceGroup)
+	for _, object := range s.Objects {
+		mesh, ok := object.(*ModelObject)
+		if !ok || mesh.shared == nil || mesh.reflective != 0 {
+			continue
+		}
+		group := s.instances.groups[mesh.shared]
+		if group == nil {
+			group = &instanceGroup{members: []Geometry{mesh.shared}, vao: mesh.shared.buffers.Vao}
+			s.instances.groups[mesh.shared] = group
+			s.instances.list = append(s.instances.list, group)
+		}
+		group.members = append(group.members, object)
+		s.instances.groups[object] = group
+	}
+
+	for _, group := range s.instances.list {
+		group.attach()
+	}
+}
+
+// UpdateInstances - drops the members of instance groups that were taken out of the scene since the last frame.
+// Call it once per frame before anything is drawn
+func (s *State) UpdateInstances() {
+	if len(s.instances.list) == 0 {
+		return
+	}
+	for _, group := range s.instances.list {
+		group.members = group.members[:0]
+	}
+	for _, object := range s.Objects {
+		if group := s.instances.groups[object]; group != nil {
+			group.members = append(group.members, object)
+		}
+	}
+}
+
+// Copies - what drawing object draws: object itself, or every member of its instance group when object is the first
+// of them. The other members are drawn with the first and get nil
+func (s *State) Copies(object Geometry) []Geometry {
+	group := s.instances.groups[object]
+	if group == nil {
+		return []Geometry{object}
+	}
+	if len(group.members) == 0 || group.members[0] != object {
+		return nil
+	}
+	return group.members
+}
+
+// instanceBatches - objects split into what each draw draws, one object on its own or the members of an instance
+// group in objects together
+func (s *State) instanceBatches(objects []Geometry) [][]Geometry {
+	var batches [][]Geometry
+	index := make(map[*instanceGroup]int)
+	for _, object := range objects {
+		group := s.instances.groups[object]
+		if group == nil {
+			batches = append(batches, []Geometry{object})
+			continue
+		}
+		if i, found := index[group]; found {
+			batches[i] = append(batches[i], object)
+			continue
+		}
+		index[group] = len(batches)
+		batches = append(batches, []Geometry{object})
+	}
+	return batches
+}
+
+// DrawCopies - draws some of the copies Copies gave, with the program in use once its other uniforms are set. An
+// object on its own is drawn with the model matrix already set, the members of an instance group with one call that
+// reads each member's matrices from the group's buffer. The vertex array is left bound
+func (s *State) DrawCopies(uniforms Uniforms, copies []Geometry) {
+	if len(copies) == 0 {
+		return
+	}
+	object := copies[0]
+	gl.BindVertexArray(object.GetBuffers().Vao)
+
+	count := int32(len(object.GetVertices().Vertices))
+	group := s.instances.groups[object]
+	if group == nil {
+		gl.Uniform1i(uniforms.Instanced, 0)
+		if object.GetType() != "mesh" {
+			gl.DrawElements(gl.TRIANGLES, count, gl.UNSIGNED_INT, gl.Ptr(nil))
+		} else {
+			gl.DrawArrays(gl.TRIANGLES, 0, count)
+		}
+		return
+	}
+
+	group.upload(copies)
+	gl.Uniform1i(uniforms.Instanced, 1)
+	if object.GetType() != "mesh" {
+		gl.DrawElementsInstanced(gl.TRIANGLES, count, gl.UNSIGNED_INT, gl.Ptr(nil), int32(len(copies)))
+	} else {
+		gl.DrawArraysInstanced(gl.TRIANGLES, 0, count, int32(len(copies)))
+	}
+}
+
+// attach - makes the group's buffer, filled with every member, and points the instance attributes of the shared
+// vertex array at it, a copy per instance
+func (g *instanceGroup) attach() {
+	gl.GenBuffers(1, &g.buffer)
+	g.upload(g.members)
+
+	gl.BindVertexArray(g.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, g.buffer)
+	stride := int32(instanceFloats * 4)
+	for i := 0; i < 4; i++ {
+		location := uint32(instanceModelLocation + i)
+		gl.VertexAttribPointer(location, 4, gl.FLOAT, false, stride, gl.PtrOffset(i*4*4))
+		gl.VertexAttribDivisor(location, 1)
+		gl.EnableVertexAttribArray(location)
+	}
+	for i := 0; i < 3; i++ {
+		location := uint32(instanceNormalLocation + i)
+		gl.VertexAttribPointer(location, 3, gl.FLOAT, false, stride, gl.PtrOffset((16+i*3)*4))
+		gl.VertexAttribDivisor(location, 1)
+		gl.EnableVertexAttribArray(location)
+	}
+	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// upload - fills the group's buffer with the matrices of copies, growing it if they don't fit
+func (g *instanceGroup) upload(copies []Geometry) {
+	g.data = g.data[:0]
+	for _, object := range copies {
+		modelMatrix, err := object.GetModelMatrix()
+		if err != nil {
+			modelMatrix = ObjectTransform(object).Matrix()
+		}
+		normalMatrix := NormalMatrix(modelMatrix)
+		g.data = append(g.data, modelMatrix[:]...)
+		g.data = append(g.data, normalMatrix[:]...)
+	}
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, g.buffer)
+	size := len(g.data) * 4
+	if size > g.size {
+		gl.BufferData(gl.ARRAY_BUFFER, size, gl.Ptr(g.data), gl.STREAM_DRAW)
+		g.size = size
+	} else if size > 0 {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, size, gl.Ptr(g.data))
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// deleteInstances - frees the instance buffers and forgets what the scene's objects shared
+func (s *State) deleteInstances() {
+	for _, group := range s.instances.list {
+		gl.DeleteBuffers(1, &group.buffer)
+	}
+	s.instances = instancing{}
+}
@@ -0,0 +1,168 @@
+package geometry
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// MaxPointShadows - point lights whose shadows the lit shaders draw, shadow casters past it light without one. Set by
+// SetupTextureUnits from the samplers the OpenGL context allows a fragment shader
+var MaxPointShadows int
+
+const (
+	// MaxDirectionalLights - size of the directional light array in the lit shaders
+	MaxDirectionalLights = 4
+	// LightsBinding - uniform buffer binding point of the Lights block
+	LightsBinding = 0
+)
+
+// std140 offsets of the Lights block in shader/lights.go, in bytes
+const (
+	dirLightStride               = 48 + MaxCascades*64 + 32
+	clusterGridOffset            = MaxDirectionalLights * dirLightStride
+	clusterScaleOffset           = clusterGridOffset + 16
+	numPointLightsOffset         = clusterScaleOffset + 16
+	numDirLightsOffset           = numPointLightsOffset + 4
+	numShadowedPointLightsOffset = numDirLightsOffset + 4
+	lightsBlockSize              = (numShadowedPointLightsOffset + 4 + 15) / 16 * 16
+	lightsBlockFloatCount        = lightsBlockSize / 4
+)
+
+// lightBuffer - uniform buffer holding the Lights block and the data written into it each frame, and the point
+// lights sorted into clusters
+type lightBuffer struct {
+	ubo        uint32
+	data       []float32
+	clusters   lightClusters
+	order      []int    //indices into State.PointLights in pointLightData order
+	shadowMaps []uint32 //depth maps of the pointShadowMaps slots
+}
+
+// UploadLights - packs the lights of the current scene into the Lights uniform buffer and the point lights into
+// clusters of the view frustum, once per frame before anything is drawn with the lit shaders. Width and height are
+// the size of the frame being drawn
+func (s *State) UploadLights(view, projection mgl32.Mat4, near, far float32, width, height int32) {
+	buffer := &s.lights
+	if buffer.ubo == 0 {
+		gl.GenBuffers(1, &buffer.ubo)
+		gl.BindBuffer(gl.UNIFORM_BUFFER, buffer.ubo)
+		gl.BufferData(gl.UNIFORM_BUFFER, lightsBlockSize, nil, gl.DYNAMIC_DRAW)
+		buffer.data = make([]float32, lightsBlockFloatCount)
+	}
+
+	for i := range buffer.data {
+		buffer.data[i] = 0
+	}
+
+	//the first shadow casters take the shadow map slots and the rest of the lights are clustered
+	buffer.order = buffer.order[:0]
+	buffer.shadowMaps = buffer.shadowMaps[:0]
+	for i := range s.PointLights {
+		if s.PointLights[i].Shadow == 1 && len(buffer.shadowMaps) < MaxPointShadows {
+			buffer.order = append(buffer.order, i)
+			buffer.shadowMaps = append(buffer.shadowMaps, s.PointLights[i].DepthMap)
+		}
+	}
+	numShadowed := len(buffer.order)
+	slotted := 0
+	for i := range s.PointLights {
+		if s.PointLights[i].Shadow == 1 && slotted < MaxPointShadows {
+			slotted++
+			continue
+		}
+		buffer.order = append(buffer.order, i)
+	}
+	buffer.clusters.build(s.PointLights, buffer.order, numShadowed, view, clusterView{
+		projection: projection,
+		near:       near,
+		far:        far,
+		width:      width,
+		height:     height,
+	})
+
+	numDirLights := len(s.DirectionalLights)
+	if numDirLights > MaxDirectionalLights {
+		numDirLights = MaxDirectionalLights
+	}
+	for i := 0; i < numDirLights; i++ {
+		light := s.DirectionalLights[i]
+		offset := i * dirLightStride
+		direction := light.TravelDirection()
+		buffer.putVec3(offset, direction[:])
+		buffer.putFloat(offset+12, light.Strength)
+		buffer.putVec3(offset+16, light.Colour)
+		buffer.putInt(offset+28, int32(len(light.CascadeMatrices)))
+		for c := range light.CascadeMatrices {
+			buffer.putFloat(offset+32+c*4, light.CascadeSplits[c])
+			buffer.putMat4(offset+48+c*64, light.CascadeMatrices[c])
+		}
+		buffer.putShadowSettings(offset+48+MaxCascades*64, light.ShadowSettings)
+	}
+
+	clusters := &buffer.clusters
+	buffer.putInt(clusterGridOffset, ClusterTilesX)
+	buffer.putInt(clusterGridOffset+4, ClusterTilesY)
+	buffer.putInt(clusterGridOffset+8, ClusterSlices)
+	buffer.putFloat(clusterScaleOffset, clusters.tileWidth)
+	buffer.putFloat(clusterScaleOffset+4, clusters.tileHeight)
+	buffer.putFloat(clusterScaleOffset+8, clusters.sliceScale)
+	buffer.putFloat(clusterScaleOffset+12, clusters.sliceBias)
+	buffer.putInt(numPointLightsOffset, int32(len(s.PointLights)))
+	buffer.putInt(numDirLightsOffset, int32(numDirLights))
+	buffer.putInt(numShadowedPointLightsOffset, int32(numShadowed))
+
+	gl.BindBuffer(gl.UNIFORM_BUFFER, buffer.ubo)
+	gl.BufferSubData(gl.UNIFORM_BUFFER, 0, lightsBlockSize, gl.Ptr(buffer.data))
+	gl.BindBuffer(gl.UNIFORM_BUFFER, 0)
+	gl.BindBufferBase(gl.UNIFORM_BUFFER, LightsBinding, buffer.ubo)
+}
+
+// PointShadowMaps - depth maps of the point lights the lit shaders draw shadows for, in pointShadowMaps slot order.
+// Set by UploadLights
+func (s *State) PointShadowMaps() []uint32 {
+	return s.lights.shadowMaps
+}
+
+// BindShadowMaps - binds the shadow maps of the point lights that have one in the lit shaders and of the directional
+// lights to the units of their slots
+func (s *State) BindShadowMaps() {
+	for i, depthMap := range s.lights.shadowMaps {
+		bindUnit(pointShadowUnits+i, gl.TEXTURE_CUBE_MAP, depthMap)
+	}
+	s.bindDirShadowMaps()
+}
+
+// bindDirShadowMaps - binds the shadow maps of the directional lights that are drawn to the units of their slots
+func (s *State) bindDirShadowMaps() {
+	for i := 0; i < len(s.DirectionalLights) && i < MaxDirectionalLights; i++ {
+		bindUnit(dirShadowUnits+i, gl.TEXTURE_2D_ARRAY, s.DirectionalLights[i].DepthMap)
+	}
+}
+
+func (b *lightBuffer) putFloat(offset int, v float32) {
+	b.data[offset/4] = v
+}
+
+func (b *lightBuffer) putInt(offset int, v int32) {
+	b.data[offset/4] = math.Float32frombits(uint32(v))
+}
+
+func (b *lightBuffer) putVec3(offset int, v []float32) {
+	if len(v) >= 3 {
+		copy(b.data[offset/4:offset/4+3], v[:3])
+	}
+}
+
+func (b *lightBuffer) putShadowSettings(offset int, s ShadowSettings) {
+	b.putFloat(offset, *s.Bias)
+	b.putFloat(offset+4, s.NormalBias)
+	b.putInt(offset+8, shadowFilters[s.Filter])
+	b.putInt(offset+12, s.FilterSize)
+	b.putFloat(offset+16, s.LightSize)
+}
+
+func (b *lightBuffer) putMat4(offset int, m mgl32.Mat4) {
+	copy(b.data[offset/4:offset/4+16], m[:])
+}
@@ -0,0 +1,288 @@
+package geometry
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// ClusterTilesX - clusters across the screen
+	ClusterTilesX = 16
+	// ClusterTilesY - clusters down the screen
+	ClusterTilesY = 9
+	// ClusterSlices - clusters from the near plane to the far plane
+	ClusterSlices = 24
+
+	clusterCount = ClusterTilesX * ClusterTilesY * ClusterSlices
+)
+
+// clusterSamplers - the texture buffer samplers of the lit shaders, in the order of lightClusters.buffers, the ith
+// one on clusterUnits+i
+var clusterSamplers = [...]string{"pointLightData", "lightClusters"}
+
+// clusterFormats - internal format of each texture buffer
+var clusterFormats = []uint32{gl.RGBA32F, gl.R32UI}
+
+// clusterBounds - view space box around a cluster
+type clusterBounds struct {
+	min mgl32.Vec3
+	max mgl32.Vec3
+}
+
+// clusterView - what the cluster bounds were worked out for
+type clusterView struct {
+	projection mgl32.Mat4
+	near, far  float32
+	width      int32
+	height     int32
+}
+
+// lightClusters - the view frustum cut into ClusterTilesX by ClusterTilesY tiles across the screen and ClusterSlices
+// slices in depth, spaced evenly in log depth so the near slices are thin, with the point lights that reach each one.
+// It is built on the CPU each frame and read by the lit shaders from two texture buffers: the point lights, and the
+// offset and count of each cluster's lights followed by the light indices the offsets point into. Sharing a buffer
+// keeps the PBR shader within 32 samplers
+type lightClusters struct {
+	buffers  [2]uint32
+	textures [2]uint32
+	lights   []float32
+	grid     []uint32
+	lists    [clusterCount][]uint32
+
+	view       clusterView
+	bounds     []clusterBounds
+	tileWidth  float32
+	tileHeight float32
+	sliceScale float32 //turn log depth into a slice
+	sliceBias  float32
+}
+
+// build - packs the point lights in order into pointLightData, the first shadowed of them with their shadows on, and
+// puts the others in the clusters they reach
+func (c *lightClusters) build(lights []PointLight, order []int, shadowed int, view mgl32.Mat4, frame clusterView) {
+	c.lights = c.lights[:0]
+	for i, index := range order {
+		light := lights[index]
+		var shadow float32
+		if i < shadowed {
+			shadow = 1
+		}
+		lightRange := light.Range()
+		if math.IsInf(float64(lightRange), 1) {
+			lightRange = math.MaxFloat32
+		}
+		c.lights = append(c.lights,
+			light.Position[0], light.Position[1], light.Position[2], light.Strength,
+			light.Colour[0], light.Colour[1], light.Colour[2], light.FarPlane,
+			light.Constant, light.Linear, light.Quadratic, shadow,
+			*light.Bias, light.NormalBias, float32(shadowFilters[light.Filter]), float32(light.FilterSize),
+			light.LightSize, lightRange, 0, 0)
+	}
+
+	if c.bounds == nil || frame != c.view {
+		c.computeBounds(frame)
+	}
+
+	for i := range c.lists {
+		c.lists[i] = c.lists[i][:0]
+	}
+	for i := shadowed; i < len(order); i++ {
+		light := lights[order[i]]
+		radius := light.Range()
+		if radius == 0 {
+			continue
+		}
+		center := view.Mul4x1(mgl32.Vec4{light.Position[0], light.Position[1], light.Position[2], 1}).Vec3()
+		c.assign(uint32(i), center, radius)
+	}
+
+	if cap(c.grid) < clusterCount*2 {
+		c.grid = make([]uint32, clusterCount*2)
+	}
+	c.grid = c.grid[:clusterCount*2]
+	for i, list := range c.lists {
+		c.grid[i*2], c.grid[i*2+1] = uint32(len(c.grid)), uint32(len(list))
+		c.grid = append(c.grid, list...)
+	}
+	c.upload()
+}
+
+// computeBounds - works out the tile size, the slice spacing and the view space box of every cluster
+func (c *lightClusters) computeBounds(frame clusterView) {
+	c.view = frame
+	c.tileWidth = float32(math.Ceil(float64(frame.width) / ClusterTilesX))
+	c.tileHeight = float32(math.Ceil(float64(frame.height) / ClusterTilesY))
+	logRange := math.Log(float64(frame.far / frame.near))
+	c.sliceScale = float32(ClusterSlices / logRange)
+	c.sliceBias = float32(-ClusterSlices * math.Log(float64(frame.near)) / logRange)
+
+	p := frame.projection
+	c.bounds = make([]clusterBounds, clusterCount)
+	for s := 0; s < ClusterSlices; s++ {
+		depths := [2]float32{c.sliceDepth(s), c.sliceDepth(s + 1)}
+		for y := 0; y < ClusterTilesY; y++ {
+			ndcY := [2]float32{c.tileNDC(y, c.tileHeight, frame.height), c.tileNDC(y+1, c.tileHeight, frame.height)}
+			for x := 0; x < ClusterTilesX; x++ {
+				ndcX := [2]float32{c.tileNDC(x, c.tileWidth, frame.width), c.tileNDC(x+1, c.tileWidth, frame.width)}
+				b := clusterBounds{
+					min: mgl32.Vec3{math.MaxFloat32, math.MaxFloat32, -depths[1]},
+					max: mgl32.Vec3{-math.MaxFloat32, -math.MaxFloat32, -depths[0]},
+				}
+				//invert ndc = (p[0] * x - p[8] * depth) / depth at each corner
+				for _, d := range depths {
+					for i := 0; i < 2; i++ {
+						vx := (ndcX[i] + p[8]) * d / p[0]
+						vy := (ndcY[i] + p[9]) * d / p[5]
+						b.min[0], b.max[0] = minFloat(b.min[0], vx), maxFloat(b.max[0], vx)
+						b.min[1], b.max[1] = minFloat(b.min[1], vy), maxFloat(b.max[1], vy)
+					}
+				}
+				c.bounds[(s*ClusterTilesY+y)*ClusterTilesX+x] = b
+			}
+		}
+	}
+}
+
+// sliceDepth - view depth the slice starts at
+func (c *lightClusters) sliceDepth(slice int) float32 {
+	return c.view.near * float32(math.Pow(float64(c.view.far/c.view.near), float64(slice)/ClusterSlices))
+}
+
+// slice - the slice a view depth is in
+func (c *lightClusters) slice(depth float32) int {
+	s := int(float32(math.Log(float64(depth)))*c.sliceScale + c.sliceBias)
+	return clampInt(s, 0, ClusterSlices-1)
+}
+
+// tileNDC - normalized device coordinate of the edge before a tile, the screen's edge past the last one
+func (c *lightClusters) tileNDC(tile int, tileSize float32, size int32) float32 {
+	return minFloat(float32(tile)*tileSize/float32(size), 1)*2 - 1
+}
+
+// tile - the tile a normalized device coordinate is in
+func (c *lightClusters) tile(ndc, tileSize float32, size int32, count int) int {
+	pixel := (ndc*0.5 + 0.5) * float32(size)
+	return clampInt(int(math.Floor(float64(pixel/tileSize))), 0, count-1)
+}
+
+// assign - adds a light to every cluster its sphere touches
+func (c *lightClusters) assign(index uint32, center mgl32.Vec3, radius float32) {
+	depth := -center.Z()
+	if depth+radius < c.view.near || depth-radius > c.view.far {
+		return
+	}
+	s0 := c.slice(maxFloat(depth-radius, c.view.near))
+	s1 := c.slice(minFloat(depth+radius, c.view.far))
+
+	//tiles under the sphere's box, all of them when it reaches behind the near plane
+	x0, x1, y0, y1 := 0, ClusterTilesX-1, 0, ClusterTilesY-1
+	if depth-radius > c.view.near {
+		p := c.view.projection
+		minX, maxX, minY, maxY := float32(math.MaxFloat32), float32(-math.MaxFloat32), float32(math.MaxFloat32), float32(-math.MaxFloat32)
+		for _, d := range []float32{depth - radius, depth + radius} {
+			for _, offset := range []float32{-radius, radius} {
+				ndcX := p[0]*(center.X()+offset)/d - p[8]
+				ndcY := p[5]*(center.Y()+offset)/d - p[9]
+				minX, maxX = minFloat(minX, ndcX), maxFloat(maxX, ndcX)
+				minY, maxY = minFloat(minY, ndcY), maxFloat(maxY, ndcY)
+			}
+		}
+		if maxX < -1 || minX > 1 || maxY < -1 || minY > 1 {
+			return
+		}
+		x0 = c.tile(minX, c.tileWidth, c.view.width, ClusterTilesX)
+		x1 = c.tile(maxX, c.tileWidth, c.view.width, ClusterTilesX)
+		y0 = c.tile(minY, c.tileHeight, c.view.height, ClusterTilesY)
+		y1 = c.tile(maxY, c.tileHeight, c.view.height, ClusterTilesY)
+	}
+
+	radiusSqr := radius * radius
+	for s := s0; s <= s1; s++ {
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				cluster := (s*ClusterTilesY+y)*ClusterTilesX + x
+				if c.bounds[cluster].distanceSqr(center) <= radiusSqr {
+					c.lists[cluster] = append(c.lists[cluster], index)
+				}
+			}
+		}
+	}
+}
+
+// distanceSqr - squared distance from a point to the box, 0 inside it
+func (b clusterBounds) distanceSqr(point mgl32.Vec3) float32 {
+	var sum float32
+	for i := 0; i < 3; i++ {
+		if point[i] < b.min[i] {
+			sum += (b.min[i] - point[i]) * (b.min[i] - point[i])
+		} else if point[i] > b.max[i] {
+			sum += (point[i] - b.max[i]) * (point[i] - b.max[i])
+		}
+	}
+	return sum
+}
+
+// upload - writes the lights and clusters into their texture buffers and binds them to their units
+func (c *lightClusters) upload() {
+	if c.buffers[0] == 0 {
+		gl.GenBuffers(int32(len(c.buffers)), &c.buffers[0])
+		gl.GenTextures(int32(len(c.textures)), &c.textures[0])
+		for i := range c.buffers {
+			//a buffer needs a data store before a texture can use it
+			gl.BindBuffer(gl.TEXTURE_BUFFER, c.buffers[i])
+			gl.BufferData(gl.TEXTURE_BUFFER, 16, nil, gl.STREAM_DRAW)
+			gl.BindTexture(gl.TEXTURE_BUFFER, c.textures[i])
+			gl.TexBuffer(gl.TEXTURE_BUFFER, clusterFormats[i], c.buffers[i])
+		}
+	}
+
+	data := []interface{}{c.lights, c.grid}
+	sizes := []int{len(c.lights), len(c.grid)}
+	for i := range c.buffers {
+		gl.BindBuffer(gl.TEXTURE_BUFFER, c.buffers[i])
+		if sizes[i] == 0 {
+			gl.BufferData(gl.TEXTURE_BUFFER, 16, nil, gl.STREAM_DRAW)
+		} else {
+			gl.BufferData(gl.TEXTURE_BUFFER, sizes[i]*4, gl.Ptr(data[i]), gl.STREAM_DRAW)
+		}
+		bindFrameUnit(clusterUnits+i, gl.TEXTURE_BUFFER, c.textures[i])
+	}
+	gl.BindBuffer(gl.TEXTURE_BUFFER, 0)
+}
+
+// delete - frees the texture buffers, upload makes them again
+func (c *lightClusters) delete() {
+	if c.buffers[0] != 0 {
+		gl.DeleteTextures(int32(len(c.textures)), &c.textures[0])
+		gl.DeleteBuffers(int32(len(c.buffers)), &c.buffers[0])
+		c.buffers = [2]uint32{}
+		c.textures = [2]uint32{}
+	}
+}
+
+// clampInt - v limited to lo..hi
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func minFloat(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,97 @@
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"../parser"
+)
+
+// LoadPolicy - what ParseJSONFile does when an object in the scene fails to load
+type LoadPolicy int
+
+const (
+	// LoadAbort - stop loading and return the error
+	LoadAbort LoadPolicy = iota
+	// LoadSkip - leave the object out of the scene and print a warning
+	LoadSkip
+	// LoadPlaceholder - print a warning and load the object with the default material instead,
+	// meshes that can't be read are replaced with a cube
+	LoadPlaceholder
+)
+
+// placeholder textures from the Editor materials folder
+const (
+	placeholderDiffuseTexture = "default.png"
+	placeholderNormalTexture  = "defaultNorm.png"
+)
+
+// LoadOptions - options for loading a scene file
+type LoadOptions struct {
+	Policy LoadPolicy
+	Scene  string //name of the scene to start in, empty for the first scene in the file
+}
+
+// ParseLoadPolicy - converts "abort", "skip" or "placeholder" into a LoadPolicy
+func ParseLoadPolicy(name string) (LoadPolicy, error) {
+	switch name {
+	case "abort":
+		return LoadAbort, nil
+	case "skip":
+		return LoadSkip, nil
+	case "placeholder":
+		return LoadPlaceholder, nil
+	}
+	return LoadAbort, fmt.Errorf("unknown load policy %q, expected abort, skip or placeholder", name)
+}
+
+// LoadError - error for an asset that failed to load. Object is empty for errors in the scene file
+// itself and Line is 0 when the position in the file is unknown
+type LoadError struct {
+	Object string
+	File   string
+	Line   int
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+
+	if e.Object != "" {
+		return fmt.Sprintf("object %q: %s: %v", e.Object, location, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", location, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// newLoadError - wraps err for the given object and file, taking the file and line from parser and os errors
+// and filling in the object name of errors that already are LoadErrors
+func newLoadError(object, file string, err error) *LoadError {
+	var loadErr *LoadError
+	if errors.As(err, &loadErr) {
+		if loadErr.Object == "" {
+			loadErr.Object = object
+		}
+		return loadErr
+	}
+
+	var parseErr *parser.ParseError
+	if errors.As(err, &parseErr) {
+		return &LoadError{Object: object, File: parseErr.File, Line: parseErr.Line, Err: parseErr.Err}
+	}
+
+	//the path is already part of the LoadError
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return &LoadError{Object: object, File: pathErr.Path, Err: pathErr.Err}
+	}
+
+	return &LoadError{Object: object, File: file, Err: err}
+}
@@ -5,7 +5,6 @@ import (
 
 	"../shader"
 	"../texture"
-	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -30,11 +29,13 @@ type ModelObject struct {
 	shaderVal         shader.Shader
 	diffuseTexture    *texture.Texture
 	normalTexture     *texture.Texture
+	pbrTextures       PBRTextures
 	onCollide         collisionFunction
 	velocity          mgl32.Vec3
 	shadowProgramInfo ProgramInfo
 	shadowShaderVal   shader.Shader
 	shadowBuffers     ObjectBuffers
+	shared            *ModelObject //loaded before with the same mesh and material, its resources are used instead
 }
 
 func (m *ModelObject) GetReflectionValues() (int, float32) {
@@ -148,6 +149,10 @@ func (m ModelObject) GetNormalTexture() *texture.Texture {
 	return m.normalTexture
 }
 
+func (m ModelObject) GetPBRTextures() PBRTextures {
+	return m.pbrTextures
+}
+
 func (m ModelObject) GetShaderVal() shader.Shader {
 	return m.shaderVal
 }
@@ -161,10 +166,58 @@ func (m *ModelObject) SetRotation(rot mgl32.Mat4) {
 	m.Model.Rotation = rot
 }
 
+// GetQuat : getter for the rotation of the ModelObject as a quaternion
+func (m ModelObject) GetQuat() mgl32.Quat {
+	return mgl32.Mat4ToQuat(m.Model.Rotation)
+}
+
+// SetQuat : sets the rotation of the ModelObject from a quaternion
+func (m *ModelObject) SetQuat(q mgl32.Quat) {
+	m.Model.Rotation = q.Normalize().Mat4()
+}
+
+// Rotate : turns the ModelObject by angle radians about a world space axis, on top of its current rotation
+func (m *ModelObject) Rotate(axis mgl32.Vec3, angle float32) {
+	m.Model.Rotation = rotateQuat(m.Model.Rotation, axis, angle).Mat4()
+}
+
+// SetEuler : sets the rotation of the ModelObject from pitch, yaw and roll in radians, see EulerToQuat
+func (m *ModelObject) SetEuler(pitch, yaw, roll float32) {
+	m.Model.Rotation = EulerToQuat(pitch, yaw, roll).Mat4()
+}
+
+// LookAt : turns the ModelObject so its -Z axis faces target
+func (m *ModelObject) LookAt(target mgl32.Vec3) {
+	m.Model.Rotation = lookAtQuat(m, target).Mat4()
+}
+
+// Slerp : moves the rotation of the ModelObject a fraction t of the way towards target
+func (m *ModelObject) Slerp(target mgl32.Quat, t float32) {
+	m.Model.Rotation = slerpQuat(m.Model.Rotation, target, t).Mat4()
+}
+
 func (m *ModelObject) SetParent(parent string) {
 	m.parent = parent
 }
 
+// Destroy : frees the program, buffers and textures created in Setup. A ModelObject sharing another's leaves them
+// to that one
+func (m *ModelObject) Destroy() {
+	if m.shared != nil {
+		m.programInfo = ProgramInfo{}
+		m.buffers = ObjectBuffers{}
+		m.diffuseTexture = nil
+		m.normalTexture = nil
+		m.pbrTextures = PBRTextures{}
+		return
+	}
+	destroyObjectResources(&m.programInfo, &m.buffers, m.diffuseTexture, m.normalTexture,
+		m.pbrTextures.MetallicRoughness, m.pbrTextures.Occlusion, m.pbrTextures.Emissive)
+	m.diffuseTexture = nil
+	m.normalTexture = nil
+	m.pbrTextures = PBRTextures{}
+}
+
 // GetModel : getter for ModelObject values
 func (m ModelObject) GetModel() (Model, error) {
 	if (m.Model != Model{}) {
@@ -202,7 +255,16 @@ func (m *ModelObject) Setup(mat Material, mod Model, name string, collide bool,
 	var shaderVals map[string]bool
 	shaderVals = make(map[string]bool)
 
-	if mat.ShaderType == 0 {
+	if m.shared != nil {
+		//the shared part was set up from the same material, which PBR setup may have filled in
+		m.material = m.shared.material
+		m.shaderVal = m.shared.shaderVal
+		m.programInfo = m.shared.programInfo
+		m.buffers = m.shared.buffers
+		m.diffuseTexture = m.shared.diffuseTexture
+		m.normalTexture = m.shared.normalTexture
+		m.pbrTextures = m.shared.pbrTextures
+	} else if mat.ShaderType == 0 {
 		shaderVals["aPosition"] = true
 		bS := &shader.BasicShader{}
 		bS.Setup()
@@ -271,17 +333,15 @@ func (m *ModelObject) Setup(mat Material, mod Model, name string, collide bool,
 
 			//check if its an mtl file or just a regular texture
 			if m.MTLPresent {
-				texture0, err := texture.NewTextureFromFile("../Editor/models/"+m.material.DiffuseTexture,
-					gl.REPEAT, gl.REPEAT)
+				texture0, err := loadTexture(name, "../Editor/models/"+m.material.DiffuseTexture)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				m.diffuseTexture = texture0
 			} else {
-				texture0, err := texture.NewTextureFromFile("../Editor/materials/"+m.material.DiffuseTexture,
-					gl.REPEAT, gl.REPEAT)
+				texture0, err := loadTexture(name, "../Editor/materials/"+m.material.DiffuseTexture)
 				if err != nil {
-					panic(err)
+					return err
 				}
 				m.diffuseTexture = texture0
 			}
@@ -340,36 +400,32 @@ func (m *ModelObject) Setup(mat Material, mod Model, name string, collide bool,
 
 		if m.MTLPresent {
 			//load diffuse texture
-			texture0, err := texture.NewTextureFromFile("../Editor/models/"+m.material.DiffuseTexture,
-				gl.REPEAT, gl.REPEAT)
+			texture0, err := loadTexture(name, "../Editor/models/"+m.material.DiffuseTexture)
 
 			if err != nil {
-				panic(err)
+				return err
 			}
 			//load normal texture
-			texture1, err := texture.NewTextureFromFile("../Editor/models/"+m.material.NormalTexture,
-				gl.REPEAT, gl.REPEAT)
+			texture1, err := loadTexture(name, "../Editor/models/"+m.material.NormalTexture)
 
 			if err != nil {
-				panic(err)
+				return err
 			}
 
 			m.diffuseTexture = texture0
 			m.normalTexture = texture1
 		} else {
 			//load diffuse texture
-			texture0, err := texture.NewTextureFromFile("../Editor/materials/"+m.material.DiffuseTexture,
-				gl.REPEAT, gl.REPEAT)
+			texture0, err := loadTexture(name, "../Editor/materials/"+m.material.DiffuseTexture)
 
 			if err != nil {
-				panic(err)
+				return err
 			}
 			//load normal texture
-			texture1, err := texture.NewTextureFromFile("../Editor/materials/"+m.material.NormalTexture,
-				gl.REPEAT, gl.REPEAT)
+			texture1, err := loadTexture(name, "../Editor/materials/"+m.material.NormalTexture)
 
 			if err != nil {
-				panic(err)
+				return err
 			}
 
 			m.diffuseTexture = texture0
@@ -378,6 +434,24 @@ func (m *ModelObject) Setup(mat Material, mod Model, name string, collide bool,
 
 		SetupAttributesMap(&m.programInfo, shaderVals)
 		m.buffers.Vao = CreateTriangleVAO(&m.programInfo, m.vertexValues.Vertices, m.vertexValues.Normals, m.vertexValues.Uvs, tangents, bitangents, m.vertexValues.Faces)
+	} else if mat.ShaderType == PBRShaderType {
+		//maps named by an mtl file sit next to the model
+		mapDir := "../Editor/materials/"
+		if m.MTLPresent {
+			mapDir = "../Editor/models/"
+		}
+
+		pbr, err := setupPBR(name, mapDir, &m.material, m.vertexValues)
+		if err != nil {
+			return err
+		}
+
+		m.shaderVal = pbr.shaderVal
+		m.programInfo = pbr.programInfo
+		m.buffers.Vao = pbr.vao
+		m.diffuseTexture = pbr.diffuseTexture
+		m.normalTexture = pbr.normalTexture
+		m.pbrTextures = pbr.maps
 	}
 
 	m.centroid = CalculateCentroid(m.vertexValues.Vertices, m.Model.Scale)
@@ -0,0 +1,200 @@
+package geometry
+
+import (
+	"fmt"
+
+	"../shader"
+	"../texture"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// PBRShaderType - Material.ShaderType of the metallic-roughness PBR shader
+const PBRShaderType = 5
+
+// DefaultPBRAmbient - ambient colour of PBR materials that don't give one
+const DefaultPBRAmbient = 0.03
+
+// bits of the textureMaps uniform, matching the defines in the PBR shader
+const (
+	baseColorMap = 1 << iota
+	normalMap
+	metallicRoughnessMap
+	occlusionMap
+	emissiveMap
+)
+
+// PBRTextures - texture maps of a PBR material besides the base colour and normal maps, which are the object's
+// diffuse and normal textures
+type PBRTextures struct {
+	MetallicRoughness *texture.Texture
+	Occlusion         *texture.Texture
+	Emissive          *texture.Texture
+}
+
+// pbrObject - the shader, program, vertex array and textures setupPBR creates for an object
+type pbrObject struct {
+	shaderVal      shader.Shader
+	programInfo    ProgramInfo
+	vao            uint32
+	diffuseTexture *texture.Texture
+	normalTexture  *texture.Texture
+	maps           PBRTextures
+}
+
+// setPBRDefaults - fills in the PBR values the scene file left out. The base colour falls back to the diffuse
+// colour so a Blinn material can be switched over by changing its shaderType
+func (mat *Material) setPBRDefaults() {
+	if len(mat.BaseColor) < 3 {
+		mat.BaseColor = []float32{1, 1, 1}
+		if len(mat.Diffuse) >= 3 {
+			mat.BaseColor = mat.Diffuse[:3]
+		}
+	}
+	if len(mat.Emissive) < 3 {
+		mat.Emissive = []float32{0, 0, 0}
+	}
+	if len(mat.Ambient) < 3 {
+		mat.Ambient = []float32{DefaultPBRAmbient, DefaultPBRAmbient, DefaultPBRAmbient}
+	}
+	if mat.AO == 0 {
+		mat.AO = 1
+	}
+}
+
+// blinnFallback - textured Blinn-Phong material with the colours of a PBR one, for a placeholder to be drawn with
+func (mat Material) blinnFallback() Material {
+	mat.setPBRDefaults()
+	mat.ShaderType = 3
+	if len(mat.Diffuse) < 3 {
+		mat.Diffuse = mat.BaseColor
+	}
+	if len(mat.Specular) < 3 {
+		mat.Specular = []float32{0.5, 0.5, 0.5}
+	}
+	if mat.N == 0 {
+		mat.N = 10
+	}
+	return mat
+}
+
+// setupPBR - builds the PBR program and vertex array of an object and loads its maps. The base colour and normal
+// maps are looked up in mapDir, the others are only named by the scene file so they are in the Editor's materials
+func setupPBR(name, mapDir string, mat *Material, values VertexValues) (pbrObject, error) {
+	mat.setPBRDefaults()
+
+	bS := &shader.PBR{}
+	bS.Setup()
+	obj := pbrObject{shaderVal: bS}
+	obj.programInfo.Program = InitOpenGL(bS.GetVertShader(), bS.GetFragShader(), bS.GetGeometryShader())
+	obj.programInfo.attributes = Attributes{
+		position: 0,
+		normal:   1,
+		uv:       2,
+	}
+
+	shaderVals := map[string]bool{
+		"aPosition": true,
+		"aNormal":   true,
+	}
+
+	maps := []struct {
+		file   string
+		dir    string
+		linear bool
+		target **texture.Texture
+	}{
+		{mat.DiffuseTexture, mapDir, false, &obj.diffuseTexture},
+		{mat.NormalTexture, mapDir, true, &obj.normalTexture},
+		{mat.MetallicRoughnessTexture, "../Editor/materials/", true, &obj.maps.MetallicRoughness},
+		{mat.OcclusionTexture, "../Editor/materials/", true, &obj.maps.Occlusion},
+		{mat.EmissiveTexture, "../Editor/materials/", false, &obj.maps.Emissive},
+	}
+
+	var uvs []float32
+	if len(values.Uvs) > 0 {
+		uvs = values.Uvs
+		shaderVals["aUV"] = true
+
+		for _, m := range maps {
+			if m.file == "" {
+				continue
+			}
+			load := loadTexture
+			if m.linear {
+				load = loadLinearTexture
+			}
+			tex, err := load(name, m.dir+m.file)
+			if err != nil {
+				destroyObjectResources(&obj.programInfo, &ObjectBuffers{}, obj.diffuseTexture, obj.normalTexture,
+					obj.maps.MetallicRoughness, obj.maps.Occlusion, obj.maps.Emissive)
+				return pbrObject{}, err
+			}
+			*m.target = tex
+		}
+	} else {
+		for _, m := range maps {
+			if m.file != "" {
+				fmt.Printf("Warning: object %q has no texture coordinates, ignoring %s\n", name, m.file)
+			}
+		}
+	}
+
+	SetupAttributesMap(&obj.programInfo, shaderVals)
+	obj.vao = CreateTriangleVAO(&obj.programInfo, values.Vertices, values.Normals, uvs, nil, nil, values.Faces)
+	return obj, nil
+}
+
+// BindPBRMaterial - uploads the values of an object's PBR material and binds its texture maps, after the object's
+// program is in use
+func BindPBRMaterial(programInfo ProgramInfo, object Geometry) {
+	mat := object.GetMaterial()
+	uniforms := programInfo.UniformLocations
+
+	gl.Uniform3fv(uniforms.BaseColorVal, 1, &mat.BaseColor[0])
+	gl.Uniform1f(uniforms.MetallicVal, mat.Metallic)
+	gl.Uniform1f(uniforms.RoughnessVal, mat.Roughness)
+	gl.Uniform1f(uniforms.AOVal, mat.AO)
+	gl.Uniform3fv(uniforms.EmissiveVal, 1, &mat.Emissive[0])
+	gl.Uniform3fv(uniforms.AmbientVal, 1, &mat.Ambient[0])
+	gl.Uniform1f(uniforms.Alpha, mat.Alpha)
+
+	pbrTextures := object.GetPBRTextures()
+	textureMaps := bindMaterialMaps([]materialMap{
+		{object.GetDiffuseTexture(), baseColorUnit, baseColorMap},
+		{object.GetNormalTexture(), normalMapUnit, normalMap},
+		{pbrTextures.MetallicRoughness, metallicRoughnessUnit, metallicRoughnessMap},
+		{pbrTextures.Occlusion, occlusionMapUnit, occlusionMap},
+		{pbrTextures.Emissive, emissiveMapUnit, emissiveMap},
+	})
+	gl.Uniform1i(uniforms.TextureMaps, textureMaps)
+}
+
+// materialMap - a texture map of a material, the unit of the sampler it is read through and its textureMaps bit
+type materialMap struct {
+	tex  *texture.Texture
+	unit int
+	bit  int32
+}
+
+// bindMaterialMaps - binds each map that is there to its unit, returning the textureMaps bits of those maps. The
+// shaders don't sample the others
+func bindMaterialMaps(maps []materialMap) int32 {
+	var textureMaps int32
+	for _, m := range maps {
+		if m.tex == nil {
+			continue
+		}
+		bindUnit(m.unit, gl.TEXTURE_2D, m.tex.GetHandle())
+		textureMaps |= m.bit
+	}
+	return textureMaps
+}
+
+// BindBlinnTextures - binds an object's diffuse and normal textures, the ones it has, to the units the Blinn-Phong
+// shaders read them from
+func BindBlinnTextures(object Geometry) {
+	bindMaterialMaps([]materialMap{
+		{object.GetDiffuseTexture(), baseColorUnit, baseColorMap},
+		{object.GetNormalTexture(), normalMapUnit, normalMap},
+	})
+}
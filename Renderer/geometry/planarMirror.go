@@ -0,0 +1,267 @@
+package geometry
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// DefaultMirrorStrength - how much of a mirror's surface colour its reflection replaces
+	DefaultMirrorStrength = 1
+	// DefaultMirrorResolution - size of a mirror's reflection as a fraction of the frame
+	DefaultMirrorResolution = 1
+)
+
+// PlanarMirror - material settings of a Plane that reflects the scene like a mirror or still water. Each frame the
+// mirror is seen, the scene is drawn from the camera reflected about the plane into a texture, which the plane then
+// shows over its own colour. Distortion bends the reflection by the plane's normal map, for ripples
+type PlanarMirror struct {
+	Strength   float32 `json:"strength"`   //0 to 1, 1 shows only the reflection
+	Distortion float32 `json:"distortion"` //how far the normal map moves the reflection, as a fraction of the frame
+	Resolution float32 `json:"resolution"` //0 to 1, smaller is cheaper and blurrier
+}
+
+// setDefaults - fills in the values the scene file left out
+func (m *PlanarMirror) setDefaults() {
+	if m.Strength <= 0 {
+		m.Strength = DefaultMirrorStrength
+	}
+	if m.Resolution <= 0 || m.Resolution > 1 {
+		m.Resolution = DefaultMirrorResolution
+	}
+}
+
+// MirrorOf - the mirror settings of a Plane with a lit mirror material, nil for every other object
+func MirrorOf(object Geometry) *PlanarMirror {
+	mat := object.GetMaterial()
+	if mat.Mirror == nil || object.GetType() != "plane" || !litShaderType(mat.ShaderType) {
+		return nil
+	}
+	return mat.Mirror
+}
+
+// MirrorView - what a mirror's reflection is drawn with
+type MirrorView struct {
+	View       mgl32.Mat4 //the camera's view reflected about the mirror
+	Projection mgl32.Mat4 //the camera's projection with its near plane on the mirror
+	Position   mgl32.Vec3 //the camera's position reflected about the mirror
+	Width      int32
+	Height     int32
+}
+
+// mirrorTarget - the texture a mirror's reflection is drawn into and its framebuffer
+type mirrorTarget struct {
+	fbo         uint32
+	color       uint32 //RGBA16F, linear like the HDR target
+	depthRB     uint32
+	width       int32
+	height      int32
+	frameWidth  int32 //size of the frame the reflection lines up with
+	frameHeight int32
+	drawn       bool //drawn this frame, a mirror that wasn't seen keeps last frame's reflection unbound
+}
+
+// MirrorPass - draws the reflections of the mirrors in view, one target each, and binds them for the mirrors to be
+// drawn with. Targets of objects that are gone or no longer mirrors are freed by Prune
+type MirrorPass struct {
+	targets map[Geometry]*mirrorTarget
+	target  uint32 //framebuffer the frame is in, remembered by Begin
+	view    [4]int32
+}
+
+// NewMirrorPass - the targets are made by Begin, the first time each mirror is seen
+func NewMirrorPass() *MirrorPass {
+	return &MirrorPass{targets: make(map[Geometry]*mirrorTarget)}
+}
+
+// Prune - frees the targets of objects that aren't mirrors in objects any more, e.g. after a scene switch, and
+// forgets which reflections were drawn last frame
+func (m *MirrorPass) Prune(objects []Geometry) {
+	mirrors := make(map[Geometry]bool)
+	for _, object := range objects {
+		if MirrorOf(object) != nil {
+			mirrors[object] = true
+		}
+	}
+	for object, target := range m.targets {
+		if !mirrors[object] {
+			target.delete()
+			delete(m.targets, object)
+			continue
+		}
+		target.drawn = false
+	}
+}
+
+// Begin - binds and clears the target of a mirror seen by the camera with view and projection from position, in a
+// frame width by height, remaking it first if the size changed. The reflection is drawn with the returned view with
+// front faces wound clockwise, since reflecting turns the scene inside out, and End puts things back
+func (m *MirrorPass) Begin(object Geometry, view, projection mgl32.Mat4, position mgl32.Vec3, width, height int32) (MirrorView, error) {
+	mirror := MirrorOf(object)
+	if mirror == nil {
+		return MirrorView{}, fmt.Errorf("object is not a mirror")
+	}
+	frameWidth, frameHeight := width, height
+	width = int32(float32(width) * mirror.Resolution)
+	height = int32(float32(height) * mirror.Resolution)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	target := m.targets[object]
+	if target == nil || target.width != width || target.height != height {
+		if target != nil {
+			target.delete()
+		}
+		var err error
+		if target, err = newMirrorTarget(width, height); err != nil {
+			delete(m.targets, object)
+			return MirrorView{}, err
+		}
+		m.targets[object] = target
+	}
+	target.frameWidth, target.frameHeight = frameWidth, frameHeight
+	target.drawn = true
+
+	var framebuffer int32
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &framebuffer)
+	gl.GetIntegerv(gl.VIEWPORT, &m.view[0])
+	m.target = uint32(framebuffer)
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+	gl.Viewport(0, 0, width, height)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	gl.FrontFace(gl.CW)
+
+	plane := mirrorPlane(object, position)
+	reflection := reflectionMatrix(plane)
+	reflected := view.Mul4(reflection)
+	return MirrorView{
+		View:       reflected,
+		Projection: obliqueProjection(projection, reflected, plane),
+		Position:   reflection.Mul4x1(position.Vec4(1)).Vec3(),
+		Width:      width,
+		Height:     height,
+	}, nil
+}
+
+// End - binds the frame Begin found bound again
+func (m *MirrorPass) End() {
+	gl.FrontFace(gl.CCW)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, m.target)
+	gl.Viewport(m.view[0], m.view[1], m.view[2], m.view[3])
+}
+
+// Bind - binds the reflection of a mirror drawn this frame and tells the program in use how to read it. m is nil
+// in views that don't show mirrors, e.g. while a mirror or reflection probe is being drawn
+func (m *MirrorPass) Bind(uniforms Uniforms, object Geometry) {
+	mirror := MirrorOf(object)
+	var target *mirrorTarget
+	if m != nil && mirror != nil {
+		target = m.targets[object]
+	}
+	if target == nil || !target.drawn {
+		gl.Uniform1i(uniforms.MirrorPresent, 0)
+		return
+	}
+	bindUnit(mirrorUnit, gl.TEXTURE_2D, target.color)
+	gl.Uniform1i(uniforms.MirrorPresent, 1)
+	gl.Uniform2f(uniforms.MirrorPixel, 1/float32(target.frameWidth), 1/float32(target.frameHeight))
+	gl.Uniform1f(uniforms.MirrorStrength, mirror.Strength)
+	gl.Uniform1f(uniforms.MirrorDistortion, mirror.Distortion)
+}
+
+// Delete - frees every mirror's target
+func (m *MirrorPass) Delete() {
+	for object, target := range m.targets {
+		target.delete()
+		delete(m.targets, object)
+	}
+}
+
+// newMirrorTarget - makes a floating point texture and a depth buffer to draw a reflection into
+func newMirrorTarget(width, height int32) (*mirrorTarget, error) {
+	target := &mirrorTarget{width: width, height: height}
+	gl.GenFramebuffers(1, &target.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target.fbo)
+	target.color = newColorTexture(gl.RGBA16F, gl.RGBA, width, height, gl.LINEAR)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, target.color, 0)
+
+	gl.GenRenderbuffers(1, &target.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, target.depthRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, target.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		target.delete()
+		return nil, fmt.Errorf("mirror framebuffer incomplete: 0x%x", status)
+	}
+	return target, nil
+}
+
+// delete - frees the texture, depth buffer and framebuffer
+func (t *mirrorTarget) delete() {
+	gl.DeleteTextures(1, &t.color)
+	gl.DeleteRenderbuffers(1, &t.depthRB)
+	gl.DeleteFramebuffers(1, &t.fbo)
+	t.fbo, t.color, t.depthRB = 0, 0, 0
+}
+
+// mirrorPlane - the world space plane a Plane object lies in, as a normal and distance whose dot product with a
+// point is its signed distance from the plane, with the normal on the side of position
+func mirrorPlane(object Geometry, position mgl32.Vec3) mgl32.Vec4 {
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
+	}
+	//the plane's vertices lie at y = 0.5 in its own space
+	point := modelMatrix.Mul4x1(mgl32.Vec4{0, 0.5, 0, 1}).Vec3()
+	normal := NormalMatrix(modelMatrix).Mul3x1(mgl32.Vec3{0, 1, 0}).Normalize()
+	if normal.Dot(position.Sub(point)) < 0 {
+		normal = normal.Mul(-1)
+	}
+	return normal.Vec4(-normal.Dot(point))
+}
+
+// reflectionMatrix - mirrors points about a plane
+func reflectionMatrix(plane mgl32.Vec4) mgl32.Mat4 {
+	n, d := plane.Vec3(), plane[3]
+	return mgl32.Mat4FromRows(
+		mgl32.Vec4{1 - 2*n[0]*n[0], -2 * n[0] * n[1], -2 * n[0] * n[2], -2 * d * n[0]},
+		mgl32.Vec4{-2 * n[1] * n[0], 1 - 2*n[1]*n[1], -2 * n[1] * n[2], -2 * d * n[1]},
+		mgl32.Vec4{-2 * n[2] * n[0], -2 * n[2] * n[1], 1 - 2*n[2]*n[2], -2 * d * n[2]},
+		mgl32.Vec4{0, 0, 0, 1},
+	)
+}
+
+// obliqueProjection - projection with its near plane moved onto a world space plane, so nothing behind the mirror
+// shows in its reflection, after Lengyel's oblique view frustum clipping. The far plane tilts with it, which only
+// matters for depth precision
+func obliqueProjection(projection, view mgl32.Mat4, plane mgl32.Vec4) mgl32.Mat4 {
+	//the plane in view space, planes move by the inverse transpose
+	clip := view.Inv().Transpose().Mul4x1(plane)
+	//the corner of the frustum opposite the plane
+	corner := projection.Inv().Mul4x1(mgl32.Vec4{sign(clip[0]), sign(clip[1]), 1, 1})
+	scaled := clip.Mul(2 / clip.Dot(corner))
+	projection.SetRow(2, scaled.Sub(projection.Row(3)))
+	return projection
+}
+
+// sign - -1, 0 or 1 as x is negative, zero or positive
+func sign(x float32) float32 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
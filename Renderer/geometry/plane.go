@@ -5,7 +5,6 @@ import (
 
 	"../shader"
 	"../texture"
-	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -29,6 +28,7 @@ type Plane struct {
 	shaderVal         shader.Shader
 	diffuseTexture    *texture.Texture
 	normalTexture     *texture.Texture
+	pbrTextures       PBRTextures
 	onCollide         collisionFunction
 	velocity          mgl32.Vec3
 	shadowProgramInfo ProgramInfo
@@ -153,6 +153,10 @@ func (p Plane) GetNormalTexture() *texture.Texture {
 	return p.normalTexture
 }
 
+func (p Plane) GetPBRTextures() PBRTextures {
+	return p.pbrTextures
+}
+
 // Scale : function used to scale the cube and recalculate the centroid
 func (p *Plane) Scale(scaleVec mgl32.Vec3) {
 	p.model.Scale = scaleVec
@@ -170,10 +174,49 @@ func (p *Plane) SetRotation(rot mgl32.Mat4) {
 	p.model.Rotation = rot
 }
 
+// GetQuat : getter for the rotation of the plane as a quaternion
+func (p Plane) GetQuat() mgl32.Quat {
+	return mgl32.Mat4ToQuat(p.model.Rotation)
+}
+
+// SetQuat : sets the rotation of the plane from a quaternion
+func (p *Plane) SetQuat(q mgl32.Quat) {
+	p.model.Rotation = q.Normalize().Mat4()
+}
+
+// Rotate : turns the plane by angle radians about a world space axis, on top of its current rotation
+func (p *Plane) Rotate(axis mgl32.Vec3, angle float32) {
+	p.model.Rotation = rotateQuat(p.model.Rotation, axis, angle).Mat4()
+}
+
+// SetEuler : sets the rotation of the plane from pitch, yaw and roll in radians, see EulerToQuat
+func (p *Plane) SetEuler(pitch, yaw, roll float32) {
+	p.model.Rotation = EulerToQuat(pitch, yaw, roll).Mat4()
+}
+
+// LookAt : turns the plane so its -Z axis faces target
+func (p *Plane) LookAt(target mgl32.Vec3) {
+	p.model.Rotation = lookAtQuat(p, target).Mat4()
+}
+
+// Slerp : moves the rotation of the plane a fraction t of the way towards target
+func (p *Plane) Slerp(target mgl32.Quat, t float32) {
+	p.model.Rotation = slerpQuat(p.model.Rotation, target, t).Mat4()
+}
+
 func (p *Plane) SetParent(parent string) {
 	p.parent = parent
 }
 
+// Destroy : frees the program, buffers and textures created in Setup
+func (p *Plane) Destroy() {
+	destroyObjectResources(&p.programInfo, &p.buffers, p.diffuseTexture, p.normalTexture,
+		p.pbrTextures.MetallicRoughness, p.pbrTextures.Occlusion, p.pbrTextures.Emissive)
+	p.diffuseTexture = nil
+	p.normalTexture = nil
+	p.pbrTextures = PBRTextures{}
+}
+
 // GetModel : getter for model values
 func (p Plane) GetModel() (Model, error) {
 	if (p.model != Model{}) {
@@ -289,11 +332,10 @@ func (p *Plane) Setup(mat Material, mod Model, name string, collide bool, reflec
 			normal:   1,
 			uv:       2,
 		}
-		texture0, err := texture.NewTextureFromFile("../Editor/materials/"+p.material.DiffuseTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture0, err := loadTexture(name, "../Editor/materials/"+p.material.DiffuseTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 		p.diffuseTexture = texture0
 
@@ -330,18 +372,16 @@ func (p *Plane) Setup(mat Material, mod Model, name string, collide bool, reflec
 			bitangent: 4,
 		}
 		//load diffuse texture
-		texture0, err := texture.NewTextureFromFile("../Editor/materials/"+p.material.DiffuseTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture0, err := loadTexture(name, "../Editor/materials/"+p.material.DiffuseTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 		//load normal texture
-		texture1, err := texture.NewTextureFromFile("../Editor/materials/"+p.material.NormalTexture,
-			gl.REPEAT, gl.REPEAT)
+		texture1, err := loadTexture(name, "../Editor/materials/"+p.material.NormalTexture)
 
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		p.diffuseTexture = texture0
@@ -350,6 +390,18 @@ func (p *Plane) Setup(mat Material, mod Model, name string, collide bool, reflec
 		SetupAttributesMap(&p.programInfo, shaderVals)
 		p.buffers.Vao = CreateTriangleVAO(&p.programInfo, p.vertexValues.Vertices, p.vertexValues.Normals, p.vertexValues.Uvs, tangents, bitangents, p.vertexValues.Faces)
 
+	} else if mat.ShaderType == PBRShaderType {
+		pbr, err := setupPBR(name, "../Editor/materials/", &p.material, p.vertexValues)
+		if err != nil {
+			return err
+		}
+
+		p.shaderVal = pbr.shaderVal
+		p.programInfo = pbr.programInfo
+		p.buffers.Vao = pbr.vao
+		p.diffuseTexture = pbr.diffuseTexture
+		p.normalTexture = pbr.normalTexture
+		p.pbrTextures = pbr.maps
 	}
 
 	p.boundingBox = GetBoundingBox(p.vertexValues.Vertices)
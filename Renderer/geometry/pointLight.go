@@ -1,34 +1,77 @@
 package geometry
 
 import (
-	"fmt"
 	"math"
-	"strconv"
-	"strings"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+// DefaultBulbSize - radius in world units of a point light for pcss when lightSize isn't set
+const DefaultBulbSize = 0.5
+
+// LightCutoff - light a point light gives, its colour times its attenuation, below which it is treated as reaching
+// no further
+const LightCutoff = 1.0 / 256
+
 // PointLight - struct for a pointlight in the scene
 type PointLight struct {
-	Name              string    `json:"name"`
-	Position          []float32 `json:"position"`
-	Parent            string    `json:"parent"`
-	Colour            []float32 `json:"colour"`
-	Strength          float32   `json:"strength"`
-	Quadratic         float32   `json:"quadratic"`
-	Linear            float32   `json:"linear"`
-	Constant          float32   `json:"constant"`
-	FarPlane          float32   `json:"farPlane"`
-	NearPlane         float32   `json:"nearPlane"`
-	Shadow            int32     `json:"shadow"`
+	Name      string    `json:"name"`
+	Position  []float32 `json:"position"`
+	Parent    string    `json:"parent"`
+	Colour    []float32 `json:"colour"`
+	Strength  float32   `json:"strength"`
+	Quadratic float32   `json:"quadratic"`
+	Linear    float32   `json:"linear"`
+	Constant  float32   `json:"constant"`
+	FarPlane  float32   `json:"farPlane"`
+	NearPlane float32   `json:"nearPlane"`
+	Shadow    int32     `json:"shadow"`
+	ShadowSettings
 	DepthMap          uint32
 	LightViewMatrices []mgl32.Mat4
-	Move              bool
+	Move              bool //the light moved since its static shadow casters were last drawn
+	staticMap         uint32
+	staticGeneration  int
+}
+
+// SetShadowDefaults - fills in the shadow settings the scene file left out
+func (light *PointLight) SetShadowDefaults() {
+	light.ShadowSettings.setDefaults(light.Name, DefaultBulbSize)
+}
+
+// Range - distance from the light at which the light it gives falls to LightCutoff, +Inf for a light with no linear
+// or quadratic falloff and 0 for one that is dimmer than the cutoff everywhere
+func (light PointLight) Range() float32 {
+	//the Blinn ambient term isn't tinted by the light's colour, so a dim colour doesn't shorten the range
+	brightness := light.Strength
+	for _, c := range light.Colour {
+		if c*light.Strength > brightness {
+			brightness = c * light.Strength
+		}
+	}
+
+	//solve constant + linear * d + quadratic * d^2 = brightness / cutoff for d
+	c := float64(light.Constant - brightness/LightCutoff)
+	a, b := float64(light.Quadratic), float64(light.Linear)
+	if c >= 0 {
+		return 0
+	}
+	if a > 0 {
+		return float32((-b + math.Sqrt(b*b-4*a*c)) / (2 * a))
+	}
+	if b > 0 {
+		return float32(-c / b)
+	}
+	return float32(math.Inf(1))
 }
 
 func (light *PointLight) CreateCubeDepthMap(width, height int32) {
+	light.DepthMap = newCubeDepthMap(width, height)
+}
+
+// newCubeDepthMap - cube map with a width by height depth texture on each face
+func newCubeDepthMap(width, height int32) uint32 {
 	var depthCubeMap uint32
 	gl.GenTextures(1, &depthCubeMap)
 	gl.BindTexture(gl.TEXTURE_CUBE_MAP, depthCubeMap)
@@ -37,30 +80,13 @@ func (light *PointLight) CreateCubeDepthMap(width, height int32) {
 	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
 	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_X, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_Y, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_Y, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_Z, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_Z, 0, gl.DEPTH_COMPONENT, 1024, 1024, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
-	light.DepthMap = depthCubeMap
-}
-
-func (light *PointLight) BindDepthMap(state *State) {
-	gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, 0, 0)
-	gl.BindFramebuffer(gl.FRAMEBUFFER, state.DepthFBO)
-	gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, light.DepthMap, 0)
-	gl.DrawBuffer(gl.NONE)
-	gl.ReadBuffer(gl.NONE)
-
-	//error check the framebuffer
-	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
-
-	if status != gl.FRAMEBUFFER_COMPLETE {
-		fmt.Println("ERROR WITH FRAMEBUFFER ", status)
-		panic(status)
-	}
-	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_X, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_Y, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_Y, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_Z, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	gl.TexImage2D(gl.TEXTURE_CUBE_MAP_NEGATIVE_Z, 0, gl.DEPTH_COMPONENT, width, height, 0, gl.DEPTH_COMPONENT, gl.FLOAT, nil)
+	return depthCubeMap
 }
 
 func (light *PointLight) CreateLightSpaceTransforms(width, height float32) {
@@ -101,78 +127,20 @@ func (light *PointLight) CreateLightSpaceTransforms(width, height float32) {
 	light.LightViewMatrices = shadowTransforms
 }
 
-func (light *PointLight) ShadowRender(state *State, object Geometry, shadowProgramInfo *ProgramInfo) {
+// ShadowRender - draws copies of an object, see State.DrawCopies, into the light's cube map, which has to be bound
+// already
+func (light *PointLight) ShadowRender(state *State, copies []Geometry, shadowProgramInfo *ProgramInfo) {
 	gl.UseProgram(shadowProgramInfo.Program)
-	currentModel, err := object.GetModel()
-
+	object := copies[0]
+	modelMatrix, err := object.GetModelMatrix()
 	if err != nil {
-		//throw an error
-		fmt.Printf("ERROR getting model!")
-	}
-	_, _, parent := object.GetDetails()
-	currentCentroid := object.GetCentroid()
-	currentVertices := object.GetVertices()
-	currentBuffers := object.GetBuffers()
-	modelMatrix := mgl32.Ident4()
-
-	if object.GetType() == "mesh" {
-		//move to centroid
-		centroidMat := mgl32.Translate3D(currentCentroid[0], currentCentroid[1], currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(centroidMat)
-		//position
-		positionMat := mgl32.Translate3D(currentModel.Position[0], currentModel.Position[1], currentModel.Position[2])
-		modelMatrix = modelMatrix.Mul4(positionMat)
-		//negative centroid
-		negCent := mgl32.Translate3D(-currentCentroid[0], -currentCentroid[1], -currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(negCent)
-		//rotation
-		modelMatrix = modelMatrix.Mul4(currentModel.Rotation)
-		//scale
-		modelMatrix = ScaleM4(modelMatrix, currentModel.Scale)
-	} else {
-		//move to centroid
-		centroidMat := mgl32.Translate3D(currentCentroid[0], currentCentroid[1], currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(centroidMat)
-		//rotation
-		modelMatrix = modelMatrix.Mul4(currentModel.Rotation)
-		//position
-		positionMat := mgl32.Translate3D(currentModel.Position[0], currentModel.Position[1], currentModel.Position[2])
-		modelMatrix = modelMatrix.Mul4(positionMat)
-		//negative centroid
-		negCent := mgl32.Translate3D(-currentCentroid[0], -currentCentroid[1], -currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(negCent)
-		//scale
-		modelMatrix = ScaleM4(modelMatrix, currentModel.Scale)
-	}
-
-	if parent != "" {
-		parentObj := GetSceneObject(parent, (*state))
-		if parentObj != nil {
-			parentMMatrix, err := parentObj.GetModelMatrix()
-			if err == nil {
-				modelMatrix = modelMatrix.Mul4(parentMMatrix)
-			}
-		} else {
-			fmt.Println("ERROR GETTING PARENT OBJECT")
-		}
-	}
-	if light.Move {
-		light.CreateLightSpaceTransforms(1024, 1024)
+		modelMatrix = ObjectTransform(object).Matrix()
 	}
 
-	for i := 0; i < 6; i++ {
-		gl.UniformMatrix4fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str(strings.Join([]string{"shadowMatrices[", strconv.Itoa(i)}, "")+"]\x00")), 1, false, &light.LightViewMatrices[i][0])
-	}
-
-	gl.UniformMatrix4fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str("uModelMatrix\x00")), 1, false, &modelMatrix[0])
-	gl.Uniform3fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str("lightPos\x00")), 1, &light.Position[0])
-	gl.Uniform1fv(gl.GetUniformLocation(shadowProgramInfo.Program, gl.Str("farPlane\x00")), 1, &light.FarPlane)
-	gl.BindVertexArray(currentBuffers.Vao)
-
-	if object.GetType() != "mesh" {
-		gl.DrawElements(gl.TRIANGLES, int32(len(currentVertices.Vertices)), gl.UNSIGNED_INT, gl.Ptr(nil))
-	} else {
-		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(currentVertices.Vertices)))
-	}
+	gl.UniformMatrix4fv(shadowProgramInfo.UniformLocations.ShadowMatrices, int32(len(light.LightViewMatrices)), false, &light.LightViewMatrices[0][0])
+	gl.UniformMatrix4fv(shadowProgramInfo.UniformLocations.Model, 1, false, &modelMatrix[0])
+	gl.Uniform3fv(shadowProgramInfo.UniformLocations.LightPos, 1, &light.Position[0])
+	gl.Uniform1fv(shadowProgramInfo.UniformLocations.FarPlane, 1, &light.FarPlane)
+	state.DrawCopies(shadowProgramInfo.UniformLocations, copies)
 	gl.BindVertexArray(0)
 }
@@ -0,0 +1,298 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// MaxBloomRadius - most blur passes bloom makes
+const MaxBloomRadius = 8
+
+// builtinEffects - post effects the renderer has shaders for, true for the ones applied to the HDR frame before
+// tone mapping, the others get the tone mapped frame
+var builtinEffects = map[string]bool{
+	"bloom":               true,
+	"depthOfField":        true,
+	"chromaticAberration": false,
+	"fxaa":                false,
+	"vignette":            false,
+	"colorGrading":        false,
+	"filmGrain":           false,
+}
+
+// postEffectDefaults - values of the fields an effect uses when the scene file leaves them out
+var postEffectDefaults = map[string]PostEffect{
+	"bloom":               {Intensity: 0.5, Threshold: 1, Radius: 4},
+	"depthOfField":        {FocusDistance: 10, FocusRange: 10, Radius: 6},
+	"chromaticAberration": {Intensity: 2},
+	"vignette":            {Intensity: 0.4, Radius: 0.8, Smoothness: 0.5},
+	"colorGrading":        {Intensity: 1},
+	"filmGrain":           {Intensity: 0.05},
+}
+
+// PostEffect - one effect of the post processing stack in settings.postProcess. Which fields an effect reads is
+// listed in the README, the rest are ignored. Effects are on unless Enabled is false
+type PostEffect struct {
+	Effect        string  `json:"effect"`
+	Enabled       *bool   `json:"enabled"`
+	Intensity     float32 `json:"intensity"`
+	Threshold     float32 `json:"threshold"`
+	Radius        float32 `json:"radius"`
+	Smoothness    float32 `json:"smoothness"`
+	FocusDistance float32 `json:"focusDistance"`
+	FocusRange    float32 `json:"focusRange"`
+	LUT           string  `json:"lut"`
+	lutTexture    uint32
+	lutSize       int32
+}
+
+// IsEnabled - whether the effect is drawn
+func (e PostEffect) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// SetEnabled - turns the effect on or off from the next frame
+func (e *PostEffect) SetEnabled(enabled bool) {
+	e.Enabled = &enabled
+}
+
+// setDefaults - fills in the values the scene file left out
+func (e *PostEffect) setDefaults() {
+	defaults := postEffectDefaults[e.Effect]
+	if e.Intensity <= 0 {
+		e.Intensity = defaults.Intensity
+	}
+	if e.Threshold <= 0 {
+		e.Threshold = defaults.Threshold
+	}
+	if e.Radius <= 0 {
+		e.Radius = defaults.Radius
+	}
+	if e.Smoothness <= 0 {
+		e.Smoothness = defaults.Smoothness
+	}
+	if e.FocusDistance <= 0 {
+		e.FocusDistance = defaults.FocusDistance
+	}
+	if e.FocusRange <= 0 {
+		e.FocusRange = defaults.FocusRange
+	}
+}
+
+// PostEffect - the first effect of the stack with the given name, nil if there isn't one
+func (s *Settings) PostEffect(name string) *PostEffect {
+	for i := range s.PostProcess {
+		if s.PostProcess[i].Effect == name {
+			return &s.PostProcess[i]
+		}
+	}
+	return nil
+}
+
+// CustomEffect - a post effect written by game code. FragShader is a fragment shader without the #version line and
+// the declarations every effect gets, see shader.PostEffectShader: it reads sceneTexture at oUV and writes
+// frag_colour. SetUniforms, if given, is called with the program in use to upload the effect's own uniforms. Units 0
+// to 3 hold the effect's inputs, textures of its own go on higher units
+type CustomEffect struct {
+	FragShader  string
+	HDR         bool //runs on the HDR frame before tone mapping instead of on the tone mapped frame
+	SetUniforms func(program uint32, effect PostEffect)
+}
+
+// customEffects - effects registered with RegisterPostEffect, by name
+var customEffects = map[string]CustomEffect{}
+
+// RegisterPostEffect - adds an effect that scene files and game code can put in the post processing stack by name.
+// Register from an init function so it exists when scene files are validated
+func RegisterPostEffect(name string, effect CustomEffect) error {
+	//bloom's own passes share the program cache with the effects
+	if _, found := builtinEffects[name]; found || name == "bloomBright" || name == "bloomBlur" {
+		return fmt.Errorf("post effect %q is built in", name)
+	}
+	if name == "" || effect.FragShader == "" {
+		return fmt.Errorf("post effect needs a name and a fragment shader")
+	}
+	customEffects[name] = effect
+	return nil
+}
+
+// knownPostEffect - whether an effect name is built in or registered
+func knownPostEffect(name string) bool {
+	if _, found := builtinEffects[name]; found {
+		return true
+	}
+	_, found := customEffects[name]
+	return found
+}
+
+// InitColorLUT - loads the 3D LUT of a colorGrading effect. The image is N slices of N by N side by side, red
+// growing to the right and green downwards in each slice and blue from slice to slice, so its top left pixel is black
+func InitColorLUT(path string, effect *PostEffect) error {
+	rgba, err := loadRGBA(path)
+	if err != nil {
+		return newLoadError("color grading", path, err)
+	}
+
+	size := rgba.Rect.Dy()
+	if size < 2 || rgba.Rect.Dx() != size*size {
+		return newLoadError("color grading", path, fmt.Errorf("a LUT must be N*N pixels wide and N high, found %dx%d",
+			rgba.Rect.Dx(), size))
+	}
+
+	//reorder the slices into red, green, blue order
+	data := make([]uint8, 0, size*size*size*4)
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			row := rgba.Pix[g*rgba.Stride+b*size*4:]
+			data = append(data, row[:size*4]...)
+		}
+	}
+
+	if effect.lutTexture != 0 {
+		gl.DeleteTextures(1, &effect.lutTexture)
+	}
+	gl.GenTextures(1, &effect.lutTexture)
+	gl.BindTexture(gl.TEXTURE_3D, effect.lutTexture)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_3D, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage3D(gl.TEXTURE_3D, 0, gl.RGBA8, int32(size), int32(size), int32(size), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(data))
+	gl.BindTexture(gl.TEXTURE_3D, 0)
+	effect.lutSize = int32(size)
+	return nil
+}
+
+// deleteColorLUTs - frees the LUTs loaded for the effects of a scene
+func deleteColorLUTs(effects []PostEffect) {
+	for i := range effects {
+		if effects[i].lutTexture != 0 {
+			gl.DeleteTextures(1, &effects[i].lutTexture)
+			effects[i].lutTexture = 0
+		}
+	}
+}
+
+// activeEffects - the enabled effects of the stack that can be drawn, split into the ones before and after tone
+// mapping
+func (p *HDRPipeline) activeEffects(effects []PostEffect) ([]*PostEffect, []*PostEffect) {
+	var hdrEffects, displayEffects []*PostEffect
+	for i := range effects {
+		effect := &effects[i]
+		if !effect.IsEnabled() {
+			continue
+		}
+
+		hdr, found := builtinEffects[effect.Effect]
+		if !found {
+			custom, registered := customEffects[effect.Effect]
+			if !registered {
+				if !p.warned[effect.Effect] {
+					fmt.Printf("Warning: skipping unknown post effect %q\n", effect.Effect)
+					p.warned[effect.Effect] = true
+				}
+				continue
+			}
+			hdr = custom.HDR
+		}
+		if effect.Effect == "colorGrading" && effect.lutTexture == 0 {
+			continue
+		}
+
+		if hdr {
+			hdrEffects = append(hdrEffects, effect)
+		} else {
+			displayEffects = append(displayEffects, effect)
+		}
+	}
+	return hdrEffects, displayEffects
+}
+
+// effectProgram - the program of a post effect shader, built the first time it is asked for
+func (p *HDRPipeline) effectProgram(name string) postProgram {
+	program, found := p.effects[name]
+	if found {
+		return program
+	}
+
+	s := &shader.PostEffectShader{Name: name}
+	if custom, found := customEffects[name]; found {
+		s.Source = custom.FragShader
+	}
+	program = newPostProgram(s)
+	p.effects[name] = program
+	return program
+}
+
+// effectPass - draws one pass of an effect from source into target with the uniforms every effect gets. Width and
+// height are the size of source and target
+func (p *HDRPipeline) effectPass(name string, effect *PostEffect, source, target uint32, width, height int32,
+	frame PostFrame) postProgram {
+	program := p.effectProgram(name)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target)
+	gl.Viewport(0, 0, width, height)
+	gl.UseProgram(program.program)
+	program.bindTexture("sceneTexture", 0, gl.TEXTURE_2D, source)
+	program.bindTexture("depthTexture", 1, gl.TEXTURE_2D, p.depthTexture)
+	gl.Uniform2f(program.location("texelSize"), 1/float32(width), 1/float32(height))
+	gl.Uniform1f(program.location("time"), float32(p.time))
+	gl.Uniform1f(program.location("intensity"), effect.Intensity)
+	gl.Uniform1f(program.location("threshold"), effect.Threshold)
+	gl.Uniform1f(program.location("radius"), effect.Radius)
+	gl.Uniform1f(program.location("smoothness"), effect.Smoothness)
+	gl.Uniform1f(program.location("focusDistance"), effect.FocusDistance)
+	gl.Uniform1f(program.location("focusRange"), effect.FocusRange)
+	gl.Uniform1f(program.location("nearPlane"), frame.Near)
+	gl.Uniform1f(program.location("farPlane"), frame.Far)
+	return program
+}
+
+// runEffect - draws an effect from the source texture into the target framebuffer
+func (p *HDRPipeline) runEffect(effect *PostEffect, source, target uint32, frame PostFrame) {
+	switch effect.Effect {
+	case "bloom":
+		p.runBloom(effect, source, target, frame)
+		return
+	case "colorGrading":
+		program := p.effectPass(effect.Effect, effect, source, target, p.width, p.height, frame)
+		program.bindTexture("lut", 3, gl.TEXTURE_3D, effect.lutTexture)
+		gl.Uniform1f(program.location("lutSize"), float32(effect.lutSize))
+	default:
+		program := p.effectPass(effect.Effect, effect, source, target, p.width, p.height, frame)
+		if custom, found := customEffects[effect.Effect]; found && custom.SetUniforms != nil {
+			custom.SetUniforms(program.program, *effect)
+		}
+	}
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+}
+
+// runBloom - keeps what is brighter than the threshold at half size, blurs it radius times and adds it back
+func (p *HDRPipeline) runBloom(effect *PostEffect, source, target uint32, frame PostFrame) {
+	width, height := halfSize(p.width), halfSize(p.height)
+	p.effectPass("bloomBright", effect, source, p.bloom[0].fbo, width, height, frame)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+
+	passes := int(math.Round(float64(effect.Radius)))
+	if passes < 1 {
+		passes = 1
+	} else if passes > MaxBloomRadius {
+		passes = MaxBloomRadius
+	}
+	for i := 0; i < passes; i++ {
+		program := p.effectPass("bloomBlur", effect, p.bloom[0].texture, p.bloom[1].fbo, width, height, frame)
+		gl.Uniform2f(program.location("direction"), 1, 0)
+		gl.DrawArrays(gl.TRIANGLES, 0, 3)
+		program = p.effectPass("bloomBlur", effect, p.bloom[1].texture, p.bloom[0].fbo, width, height, frame)
+		gl.Uniform2f(program.location("direction"), 0, 1)
+		gl.DrawArrays(gl.TRIANGLES, 0, 3)
+	}
+
+	program := p.effectPass("bloom", effect, source, target, p.width, p.height, frame)
+	program.bindTexture("bloomTexture", 2, gl.TEXTURE_2D, p.bloom[0].texture)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+}
@@ -0,0 +1,207 @@
+package geometry
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// floatImage - an image of linear RGB floats, top row first
+type floatImage struct {
+	width  int
+	height int
+	pix    []float32 //3 per pixel
+}
+
+func newFloatImage(width, height int) *floatImage {
+	return &floatImage{width: width, height: height, pix: make([]float32, width*height*3)}
+}
+
+// at - the RGB of a pixel
+func (img *floatImage) at(x, y int) []float32 {
+	i := (y*img.width + x) * 3
+	return img.pix[i : i+3]
+}
+
+// loadFloatImage - decodes an image into linear floats, Radiance RGBE files when format is "hdr" and anything
+// image.Decode reads, taken to be sRGB, otherwise
+func loadFloatImage(path, format string) (*floatImage, error) {
+	if strings.ToLower(format) == "hdr" {
+		return loadRadiance(path)
+	}
+
+	rgba, err := loadRGBA(path)
+	if err != nil {
+		return nil, err
+	}
+	size := rgba.Rect.Size()
+	img := newFloatImage(size.X, size.Y)
+	for i := 0; i < size.X*size.Y; i++ {
+		for c := 0; c < 3; c++ {
+			img.pix[i*3+c] = srgbToLinear(rgba.Pix[i*4+c])
+		}
+	}
+	return img, nil
+}
+
+// srgbToLinear - decodes an 8 bit sRGB value
+func srgbToLinear(value uint8) float32 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return float32(v / 12.92)
+	}
+	return float32(math.Pow((v+0.055)/1.055, 2.4))
+}
+
+// loadRadiance - decodes a Radiance RGBE image, the .hdr files HDRI environments come as
+func loadRadiance(path string) (*floatImage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeRadiance(bufio.NewReader(file))
+}
+
+// decodeRadiance - reads the header, the resolution line and the scanlines, flat or run length encoded, of a
+// Radiance image. Images stored bottom row first are flipped, other orientations aren't read
+func decodeRadiance(r *bufio.Reader) (*floatImage, error) {
+	magic, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(magic, "#?") {
+		return nil, errors.New("not a Radiance image, missing #? signature")
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading Radiance header: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported Radiance %s, expected 32-bit_rle_rgbe", line)
+		}
+	}
+
+	resolution, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading Radiance resolution: %v", err)
+	}
+	var yAxis, xAxis string
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "%s %d %s %d", &yAxis, &height, &xAxis, &width); err != nil {
+		return nil, fmt.Errorf("bad Radiance resolution %q", strings.TrimSpace(resolution))
+	}
+	if (yAxis != "-Y" && yAxis != "+Y") || xAxis != "+X" || width < 1 || height < 1 {
+		return nil, fmt.Errorf("unsupported Radiance orientation %q", strings.TrimSpace(resolution))
+	}
+
+	img := newFloatImage(width, height)
+	scanline := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		if err := readRadianceScanline(r, scanline); err != nil {
+			return nil, fmt.Errorf("reading Radiance scanline %d: %v", y, err)
+		}
+		row := y
+		if yAxis == "+Y" {
+			row = height - 1 - y
+		}
+		for x := 0; x < width; x++ {
+			e := scanline[x*4+3]
+			if e == 0 {
+				continue
+			}
+			scale := float32(math.Ldexp(1, int(e)-(128+8)))
+			pixel := img.at(x, row)
+			for c := 0; c < 3; c++ {
+				pixel[c] = (float32(scanline[x*4+c]) + 0.5) * scale
+			}
+		}
+	}
+	return img, nil
+}
+
+// readRadianceScanline - reads a scanline of RGBE pixels into line
+func readRadianceScanline(r *bufio.Reader, line []byte) error {
+	width := len(line) / 4
+	if _, err := io.ReadFull(r, line[:4]); err != nil {
+		return err
+	}
+	//scanlines of 8 to 32767 pixels are usually run length encoded, each channel on its own
+	if width < 8 || width > 0x7fff || line[0] != 2 || line[1] != 2 || line[2]&0x80 != 0 {
+		return readFlatScanline(r, line)
+	}
+	if int(line[2])<<8|int(line[3]) != width {
+		return errors.New("run length encoded scanline of the wrong width")
+	}
+
+	for c := 0; c < 4; c++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				run := int(count) - 128
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+run > width {
+					return errors.New("run past the end of the scanline")
+				}
+				for ; run > 0; run-- {
+					line[x*4+c] = value
+					x++
+				}
+				continue
+			}
+			if count == 0 || x+int(count) > width {
+				return errors.New("bad run length")
+			}
+			for ; count > 0; count-- {
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				line[x*4+c] = value
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+// readFlatScanline - reads the rest of a scanline whose first pixel is already in line, stored pixel by pixel with
+// the old run length encoding, where a pixel of 1, 1, 1 repeats the one before it
+func readFlatScanline(r *bufio.Reader, line []byte) error {
+	width := len(line) / 4
+	shift := uint(0)
+	for x := 1; x < width; {
+		var pixel [4]byte
+		if _, err := io.ReadFull(r, pixel[:]); err != nil {
+			return err
+		}
+		if pixel[0] != 1 || pixel[1] != 1 || pixel[2] != 1 {
+			copy(line[x*4:], pixel[:])
+			x++
+			shift = 0
+			continue
+		}
+		run := int(pixel[3]) << shift
+		if x+run > width {
+			return errors.New("run past the end of the scanline")
+		}
+		for ; run > 0; run-- {
+			copy(line[x*4:x*4+4], line[(x-1)*4:x*4])
+			x++
+		}
+		shift += 8
+	}
+	return nil
+}
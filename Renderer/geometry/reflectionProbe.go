@@ -0,0 +1,245 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// DefaultProbeResolution - width and height of each face of a probe's cube map
+	DefaultProbeResolution = 128
+	// DefaultProbeNear - near plane of the probe's faces
+	DefaultProbeNear = 0.1
+	// DefaultProbeFar - far plane of the probe's faces
+	DefaultProbeFar = 100
+)
+
+// update policies of a reflection probe
+const (
+	ProbeUpdateOnce     = "once"     //captured on the first frame only
+	ProbeUpdateInterval = "interval" //captured every Interval frames
+	ProbeUpdateOnDemand = "onDemand" //captured on the first frame and then whenever RefreshProbe asks for it
+)
+
+// probeUpdates - update policy names accepted in the scene file
+var probeUpdates = map[string]bool{
+	ProbeUpdateOnce:     true,
+	ProbeUpdateInterval: true,
+	ProbeUpdateOnDemand: true,
+}
+
+// ReflectionProbe - a point the scene is captured from into a cube map, which reflective and refractive objects
+// nearest to it see instead of the skybox. With BoxProjection, the capture is taken to be of the box from BoxMin to
+// BoxMax, e.g. the walls of a room, and lookups from surfaces inside it are corrected for their distance from the
+// probe
+type ReflectionProbe struct {
+	Name          string     `json:"name"`
+	Position      mgl32.Vec3 `json:"position"`
+	Resolution    int32      `json:"resolution"`
+	Near          float32    `json:"near"`
+	Far           float32    `json:"far"`
+	Update        string     `json:"update"`   //once, interval or onDemand
+	Interval      int        `json:"interval"` //frames between captures with the interval policy
+	BoxProjection bool       `json:"boxProjection"`
+	BoxMin        mgl32.Vec3 `json:"boxMin"`
+	BoxMax        mgl32.Vec3 `json:"boxMax"`
+
+	CubeMap   uint32
+	fbo       uint32
+	depth     uint32
+	captured  bool
+	requested bool
+	frames    int //frames since the last capture
+}
+
+// setDefaults - fills in the values the scene file left out
+func (p *ReflectionProbe) setDefaults() {
+	if p.Resolution <= 0 {
+		p.Resolution = DefaultProbeResolution
+	}
+	if p.Near <= 0 {
+		p.Near = DefaultProbeNear
+	}
+	if p.Far <= p.Near {
+		p.Far = DefaultProbeFar
+	}
+	if !probeUpdates[p.Update] {
+		p.Update = ProbeUpdateOnce
+	}
+	if p.Interval < 1 {
+		p.Interval = 1
+	}
+}
+
+// due - whether the probe is captured this frame, counting the frame towards the next interval
+func (p *ReflectionProbe) due() bool {
+	p.frames++
+	switch {
+	case !p.captured || p.requested:
+		return true
+	case p.Update == ProbeUpdateInterval:
+		return p.frames >= p.Interval
+	}
+	return false
+}
+
+// probeFaces - direction and up vector of each face, +X -X +Y -Y +Z -Z, as the point light shadow maps use them
+var probeFaces = [6][2]mgl32.Vec3{
+	{{1, 0, 0}, {0, -1, 0}},
+	{{-1, 0, 0}, {0, -1, 0}},
+	{{0, 1, 0}, {0, 0, 1}},
+	{{0, -1, 0}, {0, 0, -1}},
+	{{0, 0, 1}, {0, -1, 0}},
+	{{0, 0, -1}, {0, -1, 0}},
+}
+
+// CaptureProbes - renders the scene into every reflection probe that is due this frame, after the shadow maps are
+// up to date and before the lights are uploaded for the camera. drawScene draws the scene into the face being
+// captured with the view and projection given, the lights are already uploaded for them
+func (s *State) CaptureProbes(drawScene func(probe *ReflectionProbe, view, projection mgl32.Mat4)) error {
+	var target int32
+	var viewport [4]int32
+	captured := false
+	for i := range s.ReflectionProbes {
+		probe := &s.ReflectionProbes[i]
+		if !probe.due() {
+			continue
+		}
+		if !captured {
+			gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &target)
+			gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+			captured = true
+		}
+		if probe.CubeMap == 0 {
+			probe.createTargets()
+		}
+
+		projection := mgl32.Perspective(math.Pi/2, 1, probe.Near, probe.Far)
+		gl.BindFramebuffer(gl.FRAMEBUFFER, probe.fbo)
+		gl.Viewport(0, 0, probe.Resolution, probe.Resolution)
+		for face, axes := range probeFaces {
+			gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_CUBE_MAP_POSITIVE_X+uint32(face), probe.CubeMap, 0)
+			if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+				gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(target))
+				gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+				return fmt.Errorf("reflection probe %q framebuffer incomplete: 0x%x", probe.Name, status)
+			}
+			gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+
+			view := mgl32.LookAtV(probe.Position, probe.Position.Add(axes[0]), axes[1])
+			s.UploadLights(view, projection, probe.Near, probe.Far, probe.Resolution, probe.Resolution)
+			drawScene(probe, view, projection)
+			//drawing may have switched framebuffers on the way
+			gl.BindFramebuffer(gl.FRAMEBUFFER, probe.fbo)
+			gl.Viewport(0, 0, probe.Resolution, probe.Resolution)
+		}
+
+		//rough and curved surfaces read smaller mip levels
+		gl.BindTexture(gl.TEXTURE_CUBE_MAP, probe.CubeMap)
+		gl.GenerateMipmap(gl.TEXTURE_CUBE_MAP)
+		gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+
+		probe.captured = true
+		probe.requested = false
+		probe.frames = 0
+	}
+
+	if captured {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(target))
+		gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+	}
+	return nil
+}
+
+// createTargets - creates the probe's cube map and the framebuffer and depth buffer its faces are drawn with
+func (p *ReflectionProbe) createTargets() {
+	gl.GenTextures(1, &p.CubeMap)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, p.CubeMap)
+	for face := uint32(0); face < 6; face++ {
+		gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X+face, 0, gl.RGB16F, p.Resolution, p.Resolution, 0, gl.RGB, gl.FLOAT, nil)
+	}
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+
+	gl.GenRenderbuffers(1, &p.depth)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, p.depth)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, p.Resolution, p.Resolution)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	gl.GenFramebuffers(1, &p.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.fbo)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, p.depth)
+}
+
+// delete - frees the probe's cube map and framebuffer
+func (p *ReflectionProbe) delete() {
+	if p.fbo != 0 {
+		gl.DeleteFramebuffers(1, &p.fbo)
+		gl.DeleteRenderbuffers(1, &p.depth)
+		gl.DeleteTextures(1, &p.CubeMap)
+	}
+	p.fbo, p.depth, p.CubeMap = 0, 0, 0
+	p.captured = false
+}
+
+// RefreshProbe - asks for the probe with the given name to be captured again on the next frame, whatever its update
+// policy
+func (s *State) RefreshProbe(name string) error {
+	for i := range s.ReflectionProbes {
+		if s.ReflectionProbes[i].Name == name {
+			s.ReflectionProbes[i].requested = true
+			return nil
+		}
+	}
+	return fmt.Errorf("no reflection probe named %q", name)
+}
+
+// NearestProbe - the probe a reflective or refractive object sees, the one nearest its origin. nil for other
+// objects and scenes without probes
+func (s *State) NearestProbe(object Geometry) *ReflectionProbe {
+	if reflect, _ := object.GetReflectionValues(); reflect == 0 || len(s.ReflectionProbes) == 0 {
+		return nil
+	}
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
+	}
+	position := modelMatrix.Col(3).Vec3()
+
+	var nearest *ReflectionProbe
+	var nearestDistance float32
+	for i := range s.ReflectionProbes {
+		probe := &s.ReflectionProbes[i]
+		distance := probe.Position.Sub(position).LenSqr()
+		if nearest == nil || distance < nearestDistance {
+			nearest, nearestDistance = probe, distance
+		}
+	}
+	return nearest
+}
+
+// BindReflectionProbe - binds the cube map of the probe a reflective object sees, if it has one, and tells the
+// program in use where the probe is. probe is nil to reflect the skybox, e.g. while a probe is being captured
+func BindReflectionProbe(uniforms Uniforms, probe *ReflectionProbe) {
+	if probe == nil || probe.CubeMap == 0 {
+		gl.Uniform1i(uniforms.ProbePresent, 0)
+		return
+	}
+	bindUnit(probeUnit, gl.TEXTURE_CUBE_MAP, probe.CubeMap)
+	gl.Uniform1i(uniforms.ProbePresent, 1)
+	gl.Uniform3fv(uniforms.ProbePosition, 1, &probe.Position[0])
+	if probe.BoxProjection {
+		gl.Uniform1i(uniforms.ProbeBoxProjection, 1)
+	} else {
+		gl.Uniform1i(uniforms.ProbeBoxProjection, 0)
+	}
+	gl.Uniform3fv(uniforms.ProbeBoxMin, 1, &probe.BoxMin[0])
+	gl.Uniform3fv(uniforms.ProbeBoxMax, 1, &probe.BoxMax[0])
+}
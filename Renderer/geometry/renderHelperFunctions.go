@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 
+	"../texture"
+
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -93,7 +95,86 @@ func compileShader(source string, shaderType uint32) (uint32, error) {
 	return shader, nil
 }
 
+// cacheUniformLocations - looks up every uniform the renderer sets once the program is linked so drawing never
+// has to. Uniforms the program doesn't have get -1, which OpenGL ignores, and the Lights block is bound to
+// LightsBinding when the program uses it
+func cacheUniformLocations(p *ProgramInfo) {
+	location := func(name string) int32 {
+		return gl.GetUniformLocation(p.Program, gl.Str(name+"\x00"))
+	}
+
+	p.UniformLocations = Uniforms{
+		Projection:       location("uProjectionMatrix"),
+		View:             location("uViewMatrix"),
+		Model:            location("uModelMatrix"),
+		NormalMatrix:     location("uNormalMatrix"),
+		DiffuseVal:       location("diffuseVal"),
+		AmbientVal:       location("ambientVal"),
+		SpecularVal:      location("specularVal"),
+		NVal:             location("nVal"),
+		Alpha:            location("Alpha"),
+		CameraPosition:   location("cameraPosition"),
+		NumLights:        -1,
+		LightPositions:   -1,
+		LightColours:     -1,
+		LightStrengths:   -1,
+		DiffuseTexture:   location("uDiffuseTexture"),
+		PointLights:      -1,
+		DepthMap:         location("depthMap"),
+		ShadowMatrices:   location("shadowMatrices"),
+		LightPos:         location("lightPos"),
+		NormalTexture:    location("uNormalTexture"),
+		FarPlane:         location("farPlane"),
+		LightSpaceMatrix: location("lightSpaceMatrix"),
+		PointShadowMaps:  location("pointShadowMaps"),
+		DirShadowMaps:    location("dirShadowMaps"),
+		Skybox:           location("skybox"),
+		SkyboxPresent:    location("skyboxPresent"),
+		Reflective:       location("reflective"),
+		RefractiveIndex:  location("refractiveIndex"),
+
+		BaseColorVal:             location("baseColorVal"),
+		MetallicVal:              location("metallicVal"),
+		RoughnessVal:             location("roughnessVal"),
+		AOVal:                    location("aoVal"),
+		EmissiveVal:              location("emissiveVal"),
+		TextureMaps:              location("textureMaps"),
+		MetallicRoughnessTexture: location("uMetallicRoughnessTexture"),
+		OcclusionTexture:         location("uOcclusionTexture"),
+		EmissiveTexture:          location("uEmissiveTexture"),
+		ShadingModel:             location("shadingModel"),
+		TransparentPass:          location("transparentPass"),
+		SSAOEnabled:              location("ssaoEnabled"),
+
+		ProbePresent:       location("probePresent"),
+		ProbePosition:      location("probePosition"),
+		ProbeBoxProjection: location("probeBoxProjection"),
+		ProbeBoxMin:        location("probeBoxMin"),
+		ProbeBoxMax:        location("probeBoxMax"),
+
+		MirrorPresent:    location("mirrorPresent"),
+		MirrorPixel:      location("mirrorPixel"),
+		MirrorStrength:   location("mirrorStrength"),
+		MirrorDistortion: location("mirrorDistortion"),
+
+		Instanced: location("instanced"),
+	}
+
+	bindLightsBlock(p.Program)
+}
+
+// bindLightsBlock - binds the Lights block of a program to LightsBinding, if the program uses it, and points its
+// samplers at their units
+func bindLightsBlock(program uint32) {
+	if index := gl.GetUniformBlockIndex(program, gl.Str("Lights\x00")); index != gl.INVALID_INDEX {
+		gl.UniformBlockBinding(program, index, LightsBinding)
+	}
+	bindSamplerUnits(program)
+}
+
 func SetupAttributesMap(p *ProgramInfo, m map[string]bool) {
+	cacheUniformLocations(p)
+
 	//fmt.Println(p)
 	//PrintActiveAttribs(p)
 
@@ -339,3 +420,69 @@ func CreateTriangleVAO(programInfo *ProgramInfo, vertices []float32, normals []f
 
 	return VAO
 }
+
+// loadTexture - loads a repeating texture for an object, returning a LoadError naming the file if it can't be read
+func loadTexture(object, path string) (*texture.Texture, error) {
+	tex, err := texture.NewTextureFromFile(path, gl.REPEAT, gl.REPEAT)
+	if err != nil {
+		return nil, newLoadError(object, path, err)
+	}
+	return tex, nil
+}
+
+// loadLinearTexture - loadTexture for maps holding data rather than colours, which are not decoded from sRGB
+func loadLinearTexture(object, path string) (*texture.Texture, error) {
+	tex, err := texture.NewLinearTextureFromFile(path, gl.REPEAT, gl.REPEAT)
+	if err != nil {
+		return nil, newLoadError(object, path, err)
+	}
+	return tex, nil
+}
+
+// deleteVAO - deletes a vertex array along with the vertex and index buffers CreateTriangleVAO attached to it
+func deleteVAO(vao uint32) {
+	if vao == 0 {
+		return
+	}
+
+	gl.BindVertexArray(vao)
+	var buffers []uint32
+
+	var elementBuffer int32
+	gl.GetIntegerv(gl.ELEMENT_ARRAY_BUFFER_BINDING, &elementBuffer)
+	if elementBuffer != 0 {
+		buffers = append(buffers, uint32(elementBuffer))
+	}
+
+	//position, normal, uv, tangent and bitangent
+	for attrib := uint32(0); attrib < 5; attrib++ {
+		var buffer int32
+		gl.GetVertexAttribiv(attrib, gl.VERTEX_ATTRIB_ARRAY_BUFFER_BINDING, &buffer)
+		if buffer != 0 {
+			buffers = append(buffers, uint32(buffer))
+		}
+	}
+	gl.BindVertexArray(0)
+
+	if len(buffers) > 0 {
+		gl.DeleteBuffers(int32(len(buffers)), &buffers[0])
+	}
+	gl.DeleteVertexArrays(1, &vao)
+}
+
+// destroyObjectResources - frees the GL objects an object creates in Setup, textures may be nil
+func destroyObjectResources(programInfo *ProgramInfo, buffers *ObjectBuffers, textures ...*texture.Texture) {
+	deleteVAO(buffers.Vao)
+	buffers.Vao = 0
+
+	if programInfo.Program != 0 {
+		gl.DeleteProgram(programInfo.Program)
+		programInfo.Program = 0
+	}
+
+	for _, tex := range textures {
+		if tex != nil {
+			tex.Delete()
+		}
+	}
+}
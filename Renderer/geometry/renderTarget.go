@@ -0,0 +1,91 @@
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// RenderTarget - offscreen framebuffer with a colour and depth attachment, used for rendering without a window
+type RenderTarget struct {
+	FBO     uint32
+	colorRB uint32
+	depthRB uint32
+	Width   int32
+	Height  int32
+}
+
+// NewRenderTarget - creates a framebuffer with an RGBA8 colour renderbuffer and a 24 bit depth renderbuffer
+func NewRenderTarget(width, height int32) (*RenderTarget, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("render target size must be positive")
+	}
+
+	target := RenderTarget{
+		Width:  width,
+		Height: height,
+	}
+
+	gl.GenFramebuffers(1, &target.FBO)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target.FBO)
+
+	gl.GenRenderbuffers(1, &target.colorRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, target.colorRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, target.colorRB)
+
+	gl.GenRenderbuffers(1, &target.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, target.depthRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, target.depthRB)
+
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	//error check the framebuffer
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		target.Delete()
+		return nil, fmt.Errorf("render target framebuffer incomplete: 0x%x", status)
+	}
+
+	return &target, nil
+}
+
+// ReadPixels - reads the colour attachment back into an opaque image, flipping it so the first row is the top of the frame
+func (t *RenderTarget) ReadPixels() *image.RGBA {
+	width := int(t.Width)
+	height := int(t.Height)
+	pixels := make([]uint8, width*height*4)
+
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.FBO)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, t.Width, t.Height, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rowLen := width * 4
+	for y := 0; y < height; y++ {
+		//opengl stores rows bottom up
+		src := pixels[(height-1-y)*rowLen : (height-y)*rowLen]
+		copy(img.Pix[y*img.Stride:y*img.Stride+rowLen], src)
+	}
+
+	//the frame is shown opaque, blended alpha left in the buffer would otherwise darken the saved image
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	return img
+}
+
+// Delete - frees the framebuffer and its attachments
+func (t *RenderTarget) Delete() {
+	gl.DeleteRenderbuffers(1, &t.colorRB)
+	gl.DeleteRenderbuffers(1, &t.depthRB)
+	gl.DeleteFramebuffers(1, &t.FBO)
+}
@@ -0,0 +1,51 @@
+package geometry
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// EulerToQuat - rotation from angles in radians, roll about Z first, then pitch about X and yaw about Y
+func EulerToQuat(pitch, yaw, roll float32) mgl32.Quat {
+	yawQuat := mgl32.QuatRotate(yaw, mgl32.Vec3{0, 1, 0})
+	pitchQuat := mgl32.QuatRotate(pitch, mgl32.Vec3{1, 0, 0})
+	rollQuat := mgl32.QuatRotate(roll, mgl32.Vec3{0, 0, 1})
+	return yawQuat.Mul(pitchQuat).Mul(rollQuat)
+}
+
+// rotateQuat - current turned by angle radians about a world space axis, a zero axis leaves it alone
+func rotateQuat(current mgl32.Mat4, axis mgl32.Vec3, angle float32) mgl32.Quat {
+	rotation := mgl32.Mat4ToQuat(current)
+	if axis.Len() == 0 {
+		return rotation
+	}
+	return mgl32.QuatRotate(angle, axis.Normalize()).Mul(rotation).Normalize()
+}
+
+// slerpQuat - rotation a fraction t of the way from current to target along the shortest arc
+func slerpQuat(current mgl32.Mat4, target mgl32.Quat, t float32) mgl32.Quat {
+	return mgl32.QuatSlerp(mgl32.Mat4ToQuat(current), target.Normalize(), t)
+}
+
+// lookAtQuat - rotation that points the object's -Z axis from its centroid at target with +Y kept as close to up
+// as possible. The current rotation is kept when the object is already at target
+func lookAtQuat(object Geometry, target mgl32.Vec3) mgl32.Quat {
+	transform := ObjectTransform(object)
+	eye := mgl32.TransformCoordinate(transform.Pivot, transform.Matrix())
+
+	forward := target.Sub(eye)
+	if forward.Len() == 0 {
+		return transform.Rotation
+	}
+	forward = forward.Normalize()
+
+	up := mgl32.Vec3{0, 1, 0}
+	//looking straight up or down, any horizontal axis will do
+	if right := forward.Cross(up); right.Len() < 1e-6 {
+		up = mgl32.Vec3{0, 0, 1}
+	}
+
+	right := forward.Cross(up).Normalize()
+	up = right.Cross(forward)
+
+	return mgl32.Mat4ToQuat(mgl32.Mat3FromCols(right, up, forward.Mul(-1)).Mat4())
+}
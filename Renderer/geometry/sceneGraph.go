@@ -0,0 +1,284 @@
+package geometry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// SceneRootName - name of the node every scene graph hangs from
+const SceneRootName = "root"
+
+// Node - element of the scene graph. A node holds a transform relative to its parent and can carry an object,
+// a point light, a directional light or the camera, which follow the node's world transform
+type Node struct {
+	Name     string
+	Parent   *Node
+	Children []*Node
+
+	Object           Geometry
+	PointLight       *PointLight
+	DirectionalLight *DirectionalLight
+	Camera           *Camera
+
+	local  mgl32.Mat4
+	world  mgl32.Mat4
+	target mgl32.Vec3 //directional light target relative to the node
+	dirty  bool
+}
+
+// NewNode - creates a detached node with an identity transform
+func NewNode(name string) *Node {
+	return &Node{
+		Name:  name,
+		local: mgl32.Ident4(),
+		world: mgl32.Ident4(),
+		dirty: true,
+	}
+}
+
+// AddChild - attaches child to the node, detaching it from its previous parent first. Attaching a node to itself
+// or to one of its descendants is an error
+func (n *Node) AddChild(child *Node) error {
+	for ancestor := n; ancestor != nil; ancestor = ancestor.Parent {
+		if ancestor == child {
+			return fmt.Errorf("can't attach %q to %q, it would create a cycle", child.Name, n.Name)
+		}
+	}
+
+	if child.Parent != nil {
+		child.Parent.RemoveChild(child)
+	}
+	child.Parent = n
+	n.Children = append(n.Children, child)
+	child.dirty = true
+	return nil
+}
+
+// RemoveChild - detaches child from the node, it keeps its own children
+func (n *Node) RemoveChild(child *Node) {
+	for i := 0; i < len(n.Children); i++ {
+		if n.Children[i] == child {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			child.Parent = nil
+			child.dirty = true
+			return
+		}
+	}
+}
+
+// Local - transform of the node relative to its parent
+func (n *Node) Local() mgl32.Mat4 {
+	return n.local
+}
+
+// SetLocal - replaces the transform relative to the parent, the node and everything below it get new world
+// transforms on the next Update
+func (n *Node) SetLocal(local mgl32.Mat4) {
+	n.local = local
+	n.dirty = true
+}
+
+// World - transform of the node in world space, updating the graph first if anything above the node changed
+func (n *Node) World() mgl32.Mat4 {
+	for ancestor := n; ancestor != nil; ancestor = ancestor.Parent {
+		if ancestor.dirty {
+			n.Root().Update()
+			break
+		}
+	}
+	return n.world
+}
+
+// Root - top of the graph the node is in
+func (n *Node) Root() *Node {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return root
+}
+
+// Update - recomputes the world transforms of the node and its descendants that changed since the last update
+// and pushes them to the attached objects, lights and camera
+func (n *Node) Update() {
+	parentWorld := mgl32.Ident4()
+	if n.Parent != nil {
+		parentWorld = n.Parent.world
+	}
+	n.update(parentWorld, false)
+}
+
+func (n *Node) update(parentWorld mgl32.Mat4, parentMoved bool) {
+	//objects are moved through their own model so pick up any change to it here
+	if n.Object != nil {
+		local := ObjectTransform(n.Object).Matrix()
+		if local != n.local {
+			n.local = local
+			n.dirty = true
+		}
+	}
+
+	moved := parentMoved || n.dirty
+	if moved {
+		n.world = parentWorld.Mul4(n.local)
+		n.dirty = false
+		n.apply()
+	}
+
+	for i := 0; i < len(n.Children); i++ {
+		n.Children[i].update(n.world, moved)
+	}
+}
+
+// apply - copies the world transform into whatever is attached to the node
+func (n *Node) apply() {
+	origin := n.world.Col(3).Vec3()
+
+	if n.Object != nil {
+		n.Object.SetModelMatrix(n.world)
+	}
+
+	if n.PointLight != nil {
+		n.PointLight.Position = []float32{origin[0], origin[1], origin[2]}
+		n.PointLight.Move = true
+	}
+
+	if n.DirectionalLight != nil {
+		target := mgl32.TransformCoordinate(n.target, n.world)
+		n.DirectionalLight.Position = []float32{origin[0], origin[1], origin[2]}
+		n.DirectionalLight.Direction = []float32{target[0], target[1], target[2]}
+	}
+
+	if n.Camera != nil {
+		n.Camera.Position = origin
+	}
+}
+
+// Find - first node called name in the subtree, searching depth first, nil if there is none
+func (n *Node) Find(name string) *Node {
+	if n.Name == name {
+		return n
+	}
+	for i := 0; i < len(n.Children); i++ {
+		if found := n.Children[i].Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindPath - node reached by following slash separated child names from this node, for example
+// "hangar/crane/hook". Leading slashes start from the root of the graph
+func (n *Node) FindPath(path string) *Node {
+	current := n
+	if strings.HasPrefix(path, "/") {
+		current = n.Root()
+	}
+
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		next := current.child(name)
+		if next == nil {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// Path - slash separated names from the root down to the node, the root itself is left out
+func (n *Node) Path() string {
+	names := []string{}
+	for node := n; node.Parent != nil; node = node.Parent {
+		names = append([]string{node.Name}, names...)
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+func (n *Node) child(name string) *Node {
+	for i := 0; i < len(n.Children); i++ {
+		if n.Children[i].Name == name {
+			return n.Children[i]
+		}
+	}
+	return nil
+}
+
+// BuildSceneGraph - creates the graph for the loaded objects and lights of a scene. Everything hangs from a root
+// node unless it names a parent, lights and the camera are placed relative to their parent. Parents that don't
+// exist or would create a cycle are reported and the node stays under the root
+func (s *State) BuildSceneGraph() {
+	root := NewNode(SceneRootName)
+	parents := map[*Node]string{}
+	nodes := map[string]*Node{}
+
+	for i := 0; i < len(s.Objects); i++ {
+		name, _, parent := s.Objects[i].GetDetails()
+		node := NewNode(name)
+		node.Object = s.Objects[i]
+		root.AddChild(node)
+		parents[node] = parent
+		if _, found := nodes[name]; !found {
+			nodes[name] = node
+		}
+	}
+
+	for i := 0; i < len(s.PointLights); i++ {
+		light := &s.PointLights[i]
+		node := NewNode(light.Name)
+		node.PointLight = light
+		node.SetLocal(mgl32.Translate3D(light.Position[0], light.Position[1], light.Position[2]))
+		root.AddChild(node)
+		parents[node] = light.Parent
+	}
+
+	for i := 0; i < len(s.DirectionalLights); i++ {
+		light := &s.DirectionalLights[i]
+		node := NewNode(light.Name)
+		node.DirectionalLight = light
+		node.SetLocal(mgl32.Translate3D(light.Position[0], light.Position[1], light.Position[2]))
+		node.target = mgl32.Vec3{
+			light.Direction[0] - light.Position[0],
+			light.Direction[1] - light.Position[1],
+			light.Direction[2] - light.Position[2],
+		}
+		root.AddChild(node)
+		parents[node] = light.Parent
+	}
+
+	//the camera only joins the graph when it follows something, otherwise it's moved freely by the game
+	if s.Settings.Cam.Parent != "" {
+		node := NewNode(s.Settings.Cam.Name)
+		node.Camera = &s.Camera
+		position := s.Settings.Cam.Position
+		node.SetLocal(mgl32.Translate3D(position[0], position[1], position[2]))
+		root.AddChild(node)
+		parents[node] = s.Settings.Cam.Parent
+	}
+
+	for i := 0; i < len(root.Children); {
+		node := root.Children[i]
+		parent := parents[node]
+		if parent == "" {
+			i++
+			continue
+		}
+
+		parentNode, found := nodes[parent]
+		if !found {
+			fmt.Printf("Warning: parent %q of %q not found, leaving it at the root\n", parent, node.Name)
+			i++
+			continue
+		}
+		if err := parentNode.AddChild(node); err != nil {
+			fmt.Printf("Warning: %s, leaving it at the root\n", err)
+			i++
+		}
+	}
+
+	s.Root = root
+}
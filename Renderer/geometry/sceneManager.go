@@ -0,0 +1,196 @@
+package geometry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// SceneIndex - index of the scene with the given name in state.Scenes, -1 if there is none
+func (s *State) SceneIndex(name string) int {
+	for i := 0; i < len(s.Scenes); i++ {
+		if s.Scenes[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SwitchScene - asks for the scene with the given name to be loaded once the current frame has been drawn
+func (s *State) SwitchScene(name string) error {
+	index := s.SceneIndex(name)
+	if index < 0 {
+		return fmt.Errorf("no scene named %q", name)
+	}
+	return s.SwitchSceneIndex(index)
+}
+
+// SwitchSceneIndex - asks for the scene at index to be loaded once the current frame has been drawn
+func (s *State) SwitchSceneIndex(index int) error {
+	if index < 0 || index >= len(s.Scenes) {
+		return fmt.Errorf("scene index %d out of range, %d scene(s) loaded", index, len(s.Scenes))
+	}
+	s.sceneRequested = true
+	s.requestedScene = index
+	return nil
+}
+
+// TakeSceneRequest - returns the scene asked for by SwitchScene since the last call, if any
+func (s *State) TakeSceneRequest() (int, bool) {
+	if !s.sceneRequested {
+		return 0, false
+	}
+	s.sceneRequested = false
+	return s.requestedScene, true
+}
+
+// ModelRoot - directory the ../Editor/models path of scene objects is taken from, the executable's when empty. Set
+// by tests, whose binary is built somewhere else
+var ModelRoot string
+
+// LoadScene - unloads the current scene and loads the objects, lights and settings of state.Scenes[index].
+// Objects that fail to load are aborted on, skipped or replaced depending on opts.Policy
+func (s *State) LoadScene(index int, opts LoadOptions) error {
+	if index < 0 || index >= len(s.Scenes) {
+		return fmt.Errorf("scene index %d out of range, %d scene(s) loaded", index, len(s.Scenes))
+	}
+
+	exPath := ModelRoot
+	if exPath == "" {
+		ex, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		exPath = filepath.Dir(ex)
+	}
+
+	s.UnloadScene()
+	s.CurrentScene = index
+	scene := s.Scenes[index]
+	s.Settings = scene.Settings
+	s.Settings.ToneMapping.setDefaults()
+	s.Settings.SSAO.setDefaults()
+	if s.Settings.Renderer != DeferredRendering {
+		s.Settings.Renderer = ForwardRendering
+	}
+	//the stack is changed at runtime, so the scene's own copy is kept for the next time it loads
+	s.Settings.PostProcess = append([]PostEffect(nil), scene.Settings.PostProcess...)
+	for i := range s.Settings.PostProcess {
+		s.Settings.PostProcess[i].setDefaults()
+	}
+
+	for i := 0; i < len(scene.Objects); i++ {
+		sceneObj := scene.Objects[i]
+		fmt.Println(sceneObj.Name, " loading....")
+
+		err := loadSceneObject(sceneObj, scene.Objects, s, exPath)
+		if err == nil {
+			fmt.Println(sceneObj.Name, " loaded successfully!")
+			continue
+		}
+
+		loadErr := newLoadError(sceneObj.Name, s.ScenePath, err)
+		switch opts.Policy {
+		case LoadSkip:
+			fmt.Printf("Warning: skipping %s\n", loadErr)
+		case LoadPlaceholder:
+			fmt.Printf("Warning: using placeholder for %s\n", loadErr)
+			err = addPlaceholderToState(s, sceneObj)
+			if err != nil {
+				return newLoadError(sceneObj.Name, s.ScenePath, err)
+			}
+		default:
+			return loadErr
+		}
+	}
+
+	for j := 0; j < len(scene.PointLights); j++ {
+		light := scene.PointLights[j]
+		light.SetShadowDefaults()
+		s.PointLights = append(s.PointLights, light)
+	}
+
+	for l := 0; l < len(scene.DirectionalLights); l++ {
+		tempLight := DirectionalLight{
+			Name:      scene.DirectionalLights[l].Name,
+			Parent:    scene.DirectionalLights[l].Parent,
+			Colour:    scene.DirectionalLights[l].Colour,
+			Strength:  scene.DirectionalLights[l].Strength,
+			Direction: scene.DirectionalLights[l].Direction,
+			Position:  scene.DirectionalLights[l].Position,
+
+			Cascades:       scene.DirectionalLights[l].Cascades,
+			SplitScheme:    scene.DirectionalLights[l].SplitScheme,
+			SplitLambda:    scene.DirectionalLights[l].SplitLambda,
+			ShadowDistance: scene.DirectionalLights[l].ShadowDistance,
+			ShadowSettings: scene.DirectionalLights[l].ShadowSettings,
+		}
+		tempLight.SetShadowDefaults()
+		s.DirectionalLights = append(s.DirectionalLights, tempLight)
+	}
+
+	s.ReflectionProbes = append([]ReflectionProbe(nil), scene.ReflectionProbes...)
+	for i := range s.ReflectionProbes {
+		s.ReflectionProbes[i].setDefaults()
+	}
+
+	s.groupInstances()
+	s.BuildSceneGraph()
+
+	return nil
+}
+
+// UnloadScene - frees the GL resources of the current scene (object programs, buffers and textures, instance
+// buffers, light depth maps and clusters, the depth framebuffer, the skybox and its environment maps, the reflection
+// probes) and clears it from the state
+func (s *State) UnloadScene() {
+	for i := 0; i < len(s.Objects); i++ {
+		s.Objects[i].Destroy()
+	}
+
+	s.deleteShadowCache()
+	s.lights.clusters.delete()
+	for i := 0; i < len(s.PointLights); i++ {
+		if s.PointLights[i].DepthMap != 0 {
+			gl.DeleteTextures(1, &s.PointLights[i].DepthMap)
+		}
+	}
+
+	for i := 0; i < len(s.DirectionalLights); i++ {
+		if s.DirectionalLights[i].DepthMap != 0 {
+			gl.DeleteTextures(1, &s.DirectionalLights[i].DepthMap)
+		}
+	}
+
+	if s.DepthFBO != 0 {
+		gl.DeleteFramebuffers(1, &s.DepthFBO)
+		s.DepthFBO = 0
+	}
+
+	skybox := &s.Settings.Skybox
+	if skybox.CubeMap != 0 {
+		gl.DeleteTextures(1, &skybox.CubeMap)
+	}
+	skybox.deleteEnvironment()
+	deleteVAO(skybox.VAO)
+	if skybox.ProgramInfo.Program != 0 {
+		gl.DeleteProgram(skybox.ProgramInfo.Program)
+	}
+
+	s.deleteInstances()
+	deleteColorLUTs(s.Settings.PostProcess)
+	for i := range s.ReflectionProbes {
+		s.ReflectionProbes[i].delete()
+	}
+
+	s.Objects = []Geometry{}
+	s.PointLights = []PointLight{}
+	s.DirectionalLights = []DirectionalLight{}
+	s.ReflectionProbes = nil
+	s.Root = nil
+	s.Settings = Settings{}
+	s.LoadedObjects = 0
+	s.RenderedObjects = 0
+}
@@ -0,0 +1,299 @@
+package geometry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sceneMigration - upgrades a decoded scene file from one version to the next, in place where possible
+type sceneMigration func(root interface{}) (interface{}, error)
+
+// sceneMigrations - sceneMigrations[n] upgrades version n to version n+1
+var sceneMigrations = map[int]sceneMigration{
+	1: migrateSceneV1,
+	2: migrateSceneV2,
+	3: migrateSceneV3,
+}
+
+// DecodeSceneFile - reads scene file data of any supported version, migrating it to SceneFileVersion and
+// validating it. Problems with the contents are returned together as a *SchemaError
+func DecodeSceneFile(filePath string, data []byte) (SceneFile, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return SceneFile{}, &LoadError{File: filePath, Line: jsonErrorLine(data, err), Err: err}
+	}
+
+	version, err := sceneFileVersion(root)
+	if err != nil {
+		return SceneFile{}, &LoadError{File: filePath, Err: err}
+	}
+
+	for v := version; v < SceneFileVersion; v++ {
+		migrate, ok := sceneMigrations[v]
+		if !ok {
+			return SceneFile{}, &LoadError{File: filePath, Err: fmt.Errorf("no migration from scene version %d", v)}
+		}
+		root, err = migrate(root)
+		if err != nil {
+			return SceneFile{}, &LoadError{File: filePath, Err: fmt.Errorf("migrating scene version %d: %v", v, err)}
+		}
+	}
+
+	if problems := validateSceneFile(root); len(problems) > 0 {
+		return SceneFile{}, &SchemaError{File: filePath, Version: version, Problems: problems}
+	}
+
+	//the tree has been validated so converting it into the typed structs can't fail on types
+	migrated, err := json.Marshal(root)
+	if err != nil {
+		return SceneFile{}, &LoadError{File: filePath, Err: err}
+	}
+
+	var sceneFile SceneFile
+	if err := json.Unmarshal(migrated, &sceneFile); err != nil {
+		return SceneFile{}, &LoadError{File: filePath, Err: err}
+	}
+
+	return sceneFile, nil
+}
+
+// sceneFileVersion - version 1 files are the bare array of scenes the Editor writes, later versions are an
+// object with a version field
+func sceneFileVersion(root interface{}) (int, error) {
+	switch value := root.(type) {
+	case []interface{}:
+		return 1, nil
+	case map[string]interface{}:
+		version, ok := value["version"].(float64)
+		if !ok || version != float64(int(version)) || version < 1 {
+			return 0, errors.New("scene file has no valid version field")
+		}
+		if int(version) > SceneFileVersion {
+			return 0, fmt.Errorf("scene file version %d is newer than the supported version %d", int(version), SceneFileVersion)
+		}
+		return int(version), nil
+	}
+
+	return 0, errors.New("scene file must be an array of scenes or an object with a version field")
+}
+
+// migrateSceneV1 - wraps the scene array in a versioned object and cleans up what the Editor writes:
+// null fields are dropped, "./materials/" and "./models/" prefixes are removed from asset names, missing
+// transforms get identity values, unnamed directional lights are named and the old "lights" list becomes
+// point lights
+func migrateSceneV1(root interface{}) (interface{}, error) {
+	scenes, ok := root.([]interface{})
+	if !ok {
+		return nil, errors.New("expected an array of scenes")
+	}
+
+	for _, value := range scenes {
+		scene, ok := value.(map[string]interface{})
+		if !ok {
+			//left for the validator to report
+			continue
+		}
+
+		if lights, ok := scene["lights"].([]interface{}); ok {
+			if _, found := scene["pointLights"]; !found {
+				scene["pointLights"] = migrateLegacyLightsV1(lights)
+			}
+			delete(scene, "lights")
+		}
+
+		for _, key := range []string{"objects", "pointLights", "directionalLights"} {
+			if scene[key] == nil {
+				scene[key] = []interface{}{}
+			}
+		}
+
+		if objects, ok := scene["objects"].([]interface{}); ok {
+			for _, value := range objects {
+				if obj, ok := value.(map[string]interface{}); ok {
+					migrateObjectV1(obj)
+				}
+			}
+		}
+
+		if lights, ok := scene["pointLights"].([]interface{}); ok {
+			for _, value := range lights {
+				if light, ok := value.(map[string]interface{}); ok {
+					dropNulls(light)
+				}
+			}
+		}
+
+		if lights, ok := scene["directionalLights"].([]interface{}); ok {
+			for i, value := range lights {
+				if light, ok := value.(map[string]interface{}); ok {
+					dropNulls(light)
+					if _, found := light["name"]; !found {
+						light["name"] = fmt.Sprintf("directionalLight%d", i)
+					}
+				}
+			}
+		}
+
+		if settings, ok := scene["settings"].(map[string]interface{}); ok {
+			dropNulls(settings)
+			for _, key := range []string{"camera", "skybox"} {
+				if nested, ok := settings[key].(map[string]interface{}); ok {
+					dropNulls(nested)
+				}
+			}
+		} else if scene["settings"] == nil {
+			delete(scene, "settings")
+		}
+	}
+
+	return map[string]interface{}{
+		"version": 2.0,
+		"scenes":  scenes,
+	}, nil
+}
+
+// migrateSceneV2 - version 3 places parented lights and cameras relative to their parent. Version 2 drew a
+// parented point light at its parent's position whatever its own position was, so those are moved onto the parent
+func migrateSceneV2(root interface{}) (interface{}, error) {
+	file, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected a scene file object")
+	}
+
+	scenes, _ := file["scenes"].([]interface{})
+	for _, value := range scenes {
+		scene, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		lights, _ := scene["pointLights"].([]interface{})
+		for _, value := range lights {
+			light, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if parent, _ := light["parent"].(string); parent != "" {
+				light["position"] = []interface{}{0.0, 0.0, 0.0}
+			}
+		}
+	}
+
+	file["version"] = 3.0
+	return file, nil
+}
+
+// migrateSceneV3 - version 4 draws into an HDR target and tone maps it, by default with ACES and an sRGB output.
+// Older scenes were lit for a framebuffer that clipped and wasn't gamma corrected, so they keep that look with no
+// operator and a linear output unless they already set toneMapping
+func migrateSceneV3(root interface{}) (interface{}, error) {
+	file, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("expected a scene file object")
+	}
+
+	scenes, _ := file["scenes"].([]interface{})
+	for _, value := range scenes {
+		scene, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		settings, found := scene["settings"].(map[string]interface{})
+		if !found {
+			if _, present := scene["settings"]; present {
+				//left for the validator to report
+				continue
+			}
+			settings = map[string]interface{}{}
+			scene["settings"] = settings
+		}
+		if _, found := settings["toneMapping"]; !found {
+			settings["toneMapping"] = map[string]interface{}{
+				"operator": "none",
+				"output":   "linear",
+			}
+		}
+	}
+
+	file["version"] = 4.0
+	return file, nil
+}
+
+func migrateObjectV1(obj map[string]interface{}) {
+	dropNulls(obj)
+	if material, ok := obj["material"].(map[string]interface{}); ok {
+		dropNulls(material)
+	}
+
+	for _, key := range []string{"diffuseTexture", "normalTexture"} {
+		if name, ok := obj[key].(string); ok {
+			obj[key] = strings.TrimPrefix(name, "./materials/")
+		}
+	}
+	if name, ok := obj["model"].(string); ok {
+		obj["model"] = strings.TrimPrefix(name, "./models/")
+	}
+
+	if _, found := obj["position"]; !found {
+		obj["position"] = []interface{}{0.0, 0.0, 0.0}
+	}
+	if _, found := obj["scale"]; !found {
+		obj["scale"] = []interface{}{1.0, 1.0, 1.0}
+	}
+	//a missing rotation was drawn unrotated
+	if rotation, ok := obj["rotation"].([]interface{}); !ok || len(rotation) == 0 {
+		identity := make([]interface{}, 16)
+		for i := range identity {
+			identity[i] = 0.0
+			if i%5 == 0 {
+				identity[i] = 1.0
+			}
+		}
+		obj["rotation"] = identity
+	}
+}
+
+// migrateLegacyLightsV1 - converts the "lights" entries of early Editor scenes into unshadowed point lights
+// using the Editor's defaults for new point lights
+func migrateLegacyLightsV1(lights []interface{}) []interface{} {
+	pointLights := []interface{}{}
+
+	for _, value := range lights {
+		light, ok := value.(map[string]interface{})
+		if !ok {
+			pointLights = append(pointLights, value)
+			continue
+		}
+
+		pointLight := map[string]interface{}{
+			"quadratic": 0.035,
+			"linear":    0.09,
+			"constant":  1.0,
+			"nearPlane": 0.5,
+			"farPlane":  50.0,
+			"shadow":    0.0,
+			"strength":  1.0,
+			"colour":    []interface{}{1.0, 1.0, 1.0},
+		}
+		for _, key := range []string{"name", "position", "colour", "strength", "parent"} {
+			if field, found := light[key]; found && field != nil {
+				pointLight[key] = field
+			}
+		}
+		pointLights = append(pointLights, pointLight)
+	}
+
+	return pointLights
+}
+
+// dropNulls - removes null fields so the validator treats them as missing
+func dropNulls(obj map[string]interface{}) {
+	for key, value := range obj {
+		if value == nil {
+			delete(obj, key)
+		}
+	}
+}
@@ -0,0 +1,750 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SceneFileVersion - version of the scene file format written and read by the renderer, older files are migrated on load
+const SceneFileVersion = 4
+
+// SceneFile - top level of a versioned scene file
+type SceneFile struct {
+	Version int     `json:"version"`
+	Scenes  []Scene `json:"scenes"`
+}
+
+// SchemaProblem - one problem found in a scene file, Path points at the value e.g. scenes[0].objects[2].scale
+type SchemaProblem struct {
+	Path    string
+	Message string
+}
+
+func (p SchemaProblem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// SchemaError - every problem found while validating a scene file. Version is the version the file was
+// written in, paths always refer to the current version of the format
+type SchemaError struct {
+	File     string
+	Version  int
+	Problems []SchemaProblem
+}
+
+func (e *SchemaError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d problem(s) in scene file", e.File, len(e.Problems))
+	if e.Version != SceneFileVersion {
+		fmt.Fprintf(&b, " (version %d, migrated to %d)", e.Version, SceneFileVersion)
+	}
+	for _, problem := range e.Problems {
+		b.WriteString("\n\t")
+		b.WriteString(problem.String())
+	}
+	return b.String()
+}
+
+var objectTypes = map[string]bool{
+	"cube":  true,
+	"plane": true,
+	"mesh":  true,
+}
+
+// splitSchemes - ways the camera frustum can be cut into cascades
+var splitSchemes = map[string]bool{
+	"practical":   true,
+	"uniform":     true,
+	"logarithmic": true,
+}
+
+// schemaValidator - walks a decoded scene file collecting problems instead of stopping at the first one
+type schemaValidator struct {
+	problems []SchemaProblem
+}
+
+func (v *schemaValidator) addf(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, SchemaProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateSceneFile - checks a decoded scene file of the current version against the schema
+func validateSceneFile(root interface{}) []SchemaProblem {
+	v := schemaValidator{}
+
+	file, ok := v.object("", root)
+	if !ok {
+		return v.problems
+	}
+
+	if version, ok := v.integer(file, "", "version", true); ok && version != SceneFileVersion {
+		v.addf("version", "expected %d, found %d", SceneFileVersion, version)
+	}
+
+	scenes, ok := v.array(file, "", "scenes", true)
+	if ok && len(scenes) == 0 {
+		v.addf("scenes", "at least one scene is required")
+	}
+	sceneNames := make(map[string]string)
+	for i, scene := range scenes {
+		scenePath := fmt.Sprintf("scenes[%d]", i)
+		name := v.validateScene(scenePath, scene)
+		if name == "" {
+			continue
+		}
+		if first, found := sceneNames[name]; found {
+			v.addf(scenePath+".name", "%q is already used by %s", name, first)
+		} else {
+			sceneNames[name] = scenePath
+		}
+	}
+
+	return v.problems
+}
+
+// validateScene - checks one scene, returning its name for the cross checks
+func (v *schemaValidator) validateScene(path string, value interface{}) string {
+	scene, ok := v.object(path, value)
+	if !ok {
+		return ""
+	}
+
+	sceneName, _ := v.str(scene, path, "name", false)
+
+	names := make(map[string]string)
+	objectParents := make(map[string]string)
+	var children []string
+	var parents []string
+	var parentPaths []string
+
+	objects, _ := v.array(scene, path, "objects", false)
+	for i, value := range objects {
+		objPath := fmt.Sprintf("%s.objects[%d]", path, i)
+		name, parent, copies := v.validateObject(objPath, value)
+
+		//an object with instances is loaded as its copies instead
+		loaded := []string{name}
+		if copies > 0 {
+			loaded = loaded[:0]
+			for j := 0; j < copies; j++ {
+				loaded = append(loaded, instanceName(name, j))
+			}
+		}
+		for _, name := range loaded {
+			if name == "" {
+				continue
+			}
+			if first, found := names[name]; found {
+				v.addf(objPath+".name", "%q is already used by %s", name, first)
+			} else {
+				names[name] = objPath
+			}
+			if parent != "" {
+				objectParents[name] = parent
+				children = append(children, name)
+			}
+		}
+		if parent != "" {
+			parents = append(parents, parent)
+			parentPaths = append(parentPaths, objPath+".parent")
+		}
+	}
+
+	pointLights, _ := v.array(scene, path, "pointLights", false)
+	for i, value := range pointLights {
+		lightPath := fmt.Sprintf("%s.pointLights[%d]", path, i)
+		if parent := v.validatePointLight(lightPath, value); parent != "" {
+			parents = append(parents, parent)
+			parentPaths = append(parentPaths, lightPath+".parent")
+		}
+	}
+
+	directionalLights, _ := v.array(scene, path, "directionalLights", false)
+	for i, value := range directionalLights {
+		lightPath := fmt.Sprintf("%s.directionalLights[%d]", path, i)
+		if parent := v.validateDirectionalLight(lightPath, value); parent != "" {
+			parents = append(parents, parent)
+			parentPaths = append(parentPaths, lightPath+".parent")
+		}
+	}
+
+	probes, _ := v.array(scene, path, "reflectionProbes", false)
+	probeNames := make(map[string]string)
+	for i, value := range probes {
+		probePath := fmt.Sprintf("%s.reflectionProbes[%d]", path, i)
+		if name := v.validateReflectionProbe(probePath, value); name != "" {
+			if first, found := probeNames[name]; found {
+				v.addf(probePath+".name", "%q is already used by %s", name, first)
+			} else {
+				probeNames[name] = probePath
+			}
+		}
+	}
+
+	if settings, ok := v.optionalObject(scene, path, "settings"); ok {
+		if parent := v.validateSettings(path+".settings", settings); parent != "" {
+			parents = append(parents, parent)
+			parentPaths = append(parentPaths, path+".settings.camera.parent")
+		}
+	}
+
+	for i, parent := range parents {
+		if _, found := names[parent]; !found {
+			v.addf(parentPaths[i], "no object named %q in this scene", parent)
+		}
+	}
+
+	//parents have to form a tree, a chain that comes back to where it started can't be placed
+	for _, name := range children {
+		parent := objectParents[name]
+		steps := 0
+		for parent != "" && parent != name && steps < len(objectParents) {
+			parent = objectParents[parent]
+			steps++
+		}
+		if parent == name && steps > 0 {
+			v.addf(names[name]+".parent", "parent chain of %q loops back to itself", name)
+		}
+	}
+
+	return sceneName
+}
+
+// validateObject - checks one scene object, returning its name, parent and number of instances for the cross checks
+func (v *schemaValidator) validateObject(path string, value interface{}) (string, string, int) {
+	obj, ok := v.object(path, value)
+	if !ok {
+		return "", "", 0
+	}
+
+	name, _ := v.str(obj, path, "name", true)
+	objType, ok := v.str(obj, path, "type", true)
+	if ok && !objectTypes[objType] {
+		v.addf(path+".type", "unknown type %q, expected cube, plane or mesh", objType)
+	}
+
+	v.vector(obj, path, "position", 3, true)
+	v.vector(obj, path, "scale", 3, true)
+	v.validateRotation(obj, path)
+
+	diffuseTexture, _ := v.str(obj, path, "diffuseTexture", false)
+	normalTexture, _ := v.str(obj, path, "normalTexture", false)
+	parent, _ := v.str(obj, path, "parent", false)
+	model, _ := v.str(obj, path, "model", false)
+	v.boolean(obj, path, "collide")
+	v.number(obj, path, "refractionIndex", false)
+	if reflective, ok := v.integer(obj, path, "reflective", false); ok && (reflective < 0 || reflective > 2) {
+		v.addf(path+".reflective", "expected 0 (none), 1 (reflect) or 2 (refract), found %d", reflective)
+	}
+
+	if objType == "mesh" && model == "" {
+		v.addf(path+".model", "required for mesh objects")
+	}
+	if parent != "" && parent == name {
+		v.addf(path+".parent", "object can't be its own parent")
+	}
+
+	instances, _ := v.array(obj, path, "instances", false)
+	if len(instances) > 0 && objType != "mesh" {
+		v.addf(path+".instances", "only mesh objects can have instances")
+	}
+	for i, value := range instances {
+		v.validateInstance(fmt.Sprintf("%s.instances[%d]", path, i), value)
+	}
+
+	material, ok := v.requiredObject(obj, path, "material")
+	if !ok {
+		return name, parent, len(instances)
+	}
+	matPath := path + ".material"
+	shaderType, ok := v.integer(material, matPath, "shaderType", false)
+	if ok && (shaderType < 0 || shaderType > PBRShaderType) {
+		v.addf(matPath+".shaderType", "expected 0 to %d, found %d", PBRShaderType, shaderType)
+	}
+
+	//PBR materials have their own colours
+	blinn := shaderType != PBRShaderType
+	v.vector(material, matPath, "diffuse", 3, blinn)
+	v.vector(material, matPath, "ambient", 3, blinn)
+	v.vector(material, matPath, "specular", 3, blinn)
+	v.number(material, matPath, "n", false)
+	v.number(material, matPath, "alpha", false)
+	if !blinn {
+		v.validatePBRMaterial(material, matPath)
+	}
+	if mirror, ok := v.optionalObject(material, matPath, "mirror"); ok {
+		v.validateMirror(mirror, matPath+".mirror")
+		if objType != "plane" {
+			v.addf(matPath+".mirror", "only plane objects can be mirrors")
+		} else if !litShaderType(shaderType) {
+			v.addf(matPath+".mirror", "needs a lit shaderType (1, 3, 4 or %d), found %d", PBRShaderType, shaderType)
+		}
+	}
+
+	//cubes and planes load their textures by shader type, meshes fall back to their mtl file
+	if objType != "mesh" {
+		if (shaderType == 3 || shaderType == 4) && diffuseTexture == "" {
+			v.addf(path+".diffuseTexture", "required by shaderType %d", shaderType)
+		}
+		if shaderType == 4 && normalTexture == "" {
+			v.addf(path+".normalTexture", "required by shaderType %d", shaderType)
+		}
+	}
+
+	return name, parent, len(instances)
+}
+
+// validateInstance - checks one copy of an object with instances, which needs its own position and takes the
+// object's scale and rotation unless it gives them
+func (v *schemaValidator) validateInstance(path string, value interface{}) {
+	instance, ok := v.object(path, value)
+	if !ok {
+		return
+	}
+	v.vector(instance, path, "position", 3, true)
+	v.vector(instance, path, "scale", 3, false)
+	for _, key := range []string{"rotation", "quaternion", "euler"} {
+		if _, found := instance[key]; found {
+			v.validateRotation(instance, path)
+			break
+		}
+	}
+}
+
+// validatePBRMaterial - checks the values of a metallic-roughness material
+func (v *schemaValidator) validatePBRMaterial(material map[string]interface{}, path string) {
+	v.vector(material, path, "baseColor", 3, false)
+	v.vector(material, path, "emissive", 3, false)
+	for _, key := range []string{"metallic", "roughness"} {
+		if value, ok := v.number(material, path, key, true); ok && (value < 0 || value > 1) {
+			v.addf(path+"."+key, "expected 0 to 1, found %g", value)
+		}
+	}
+	if ao, ok := v.number(material, path, "ao", false); ok && (ao <= 0 || ao > 1) {
+		v.addf(path+".ao", "expected more than 0 and at most 1, found %g", ao)
+	}
+	for _, key := range []string{"metallicRoughnessTexture", "occlusionTexture", "emissiveTexture"} {
+		v.str(material, path, key, false)
+	}
+}
+
+// validateMirror - checks the planar mirror settings of a material
+func (v *schemaValidator) validateMirror(mirror map[string]interface{}, path string) {
+	for _, key := range []string{"strength", "resolution"} {
+		if value, ok := v.number(mirror, path, key, false); ok && (value <= 0 || value > 1) {
+			v.addf(path+"."+key, "expected more than 0 and at most 1, found %g", value)
+		}
+	}
+	if distortion, ok := v.number(mirror, path, "distortion", false); ok && distortion < 0 {
+		v.addf(path+".distortion", "must not be negative, found %g", distortion)
+	}
+}
+
+// validateRotation - an object's rotation is given as exactly one of a 16 number matrix, an x, y, z, w
+// quaternion or pitch, yaw and roll in degrees
+func (v *schemaValidator) validateRotation(obj map[string]interface{}, path string) {
+	var given []string
+	for _, key := range []string{"rotation", "quaternion", "euler"} {
+		if _, found := obj[key]; found {
+			given = append(given, key)
+		}
+	}
+
+	if len(given) == 0 {
+		v.addf(joinPath(path, "rotation"), "required, or give quaternion or euler instead")
+		return
+	}
+	if len(given) > 1 {
+		v.addf(path, "rotation is given more than once, as %s", strings.Join(given, " and "))
+	}
+
+	v.vector(obj, path, "rotation", 16, false)
+	v.vector(obj, path, "euler", 3, false)
+	v.vector(obj, path, "quaternion", 4, false)
+
+	if quaternion, ok := obj["quaternion"].([]interface{}); ok && len(quaternion) == 4 {
+		length := 0.0
+		for _, value := range quaternion {
+			if n, ok := value.(float64); ok {
+				length += n * n
+			}
+		}
+		if length == 0 {
+			v.addf(joinPath(path, "quaternion"), "must not be all zeros")
+		}
+	}
+}
+
+// validatePointLight - checks one point light, returning its parent for the cross checks
+func (v *schemaValidator) validatePointLight(path string, value interface{}) string {
+	light, ok := v.object(path, value)
+	if !ok {
+		return ""
+	}
+
+	v.str(light, path, "name", true)
+	v.vector(light, path, "position", 3, true)
+	v.vector(light, path, "colour", 3, true)
+	for _, key := range []string{"strength", "constant", "linear", "quadratic", "nearPlane", "farPlane"} {
+		v.number(light, path, key, false)
+	}
+	if shadow, ok := v.integer(light, path, "shadow", false); ok && shadow != 0 && shadow != 1 {
+		v.addf(path+".shadow", "expected 0 or 1, found %d", shadow)
+	}
+	v.validateShadowSettings(light, path)
+
+	parent, _ := v.str(light, path, "parent", false)
+	return parent
+}
+
+// validateDirectionalLight - checks one directional light, returning its parent for the cross checks
+func (v *schemaValidator) validateDirectionalLight(path string, value interface{}) string {
+	light, ok := v.object(path, value)
+	if !ok {
+		return ""
+	}
+
+	v.str(light, path, "name", true)
+	v.vector(light, path, "position", 3, true)
+	v.vector(light, path, "direction", 3, true)
+	v.vector(light, path, "colour", 3, true)
+	v.number(light, path, "strength", false)
+	if cascades, ok := v.integer(light, path, "cascades", false); ok && (cascades < 1 || cascades > MaxCascades) {
+		v.addf(path+".cascades", "expected 1 to %d, found %d", MaxCascades, cascades)
+	}
+	if scheme, ok := v.str(light, path, "splitScheme", false); ok && !splitSchemes[scheme] {
+		v.addf(path+".splitScheme", "unknown scheme %q, expected practical, uniform or logarithmic", scheme)
+	}
+	if lambda, ok := v.number(light, path, "splitLambda", false); ok && (lambda <= 0 || lambda > 1) {
+		v.addf(path+".splitLambda", "expected more than 0 and at most 1, found %g", lambda)
+	}
+	if distance, ok := v.number(light, path, "shadowDistance", false); ok && distance <= 0 {
+		v.addf(path+".shadowDistance", "must be positive, found %g", distance)
+	}
+	v.validateShadowSettings(light, path)
+	parent, _ := v.str(light, path, "parent", false)
+	return parent
+}
+
+// validateShadowSettings - checks the shadow settings point and directional lights share
+func (v *schemaValidator) validateShadowSettings(light map[string]interface{}, path string) {
+	if resolution, ok := v.integer(light, path, "shadowResolution", false); ok && resolution < 1 {
+		v.addf(path+".shadowResolution", "must be positive, found %d", resolution)
+	}
+	v.number(light, path, "bias", false)
+	if normalBias, ok := v.number(light, path, "normalBias", false); ok && normalBias < 0 {
+		v.addf(path+".normalBias", "must not be negative, found %g", normalBias)
+	}
+	if filter, ok := v.str(light, path, "filter", false); ok {
+		if _, found := shadowFilters[filter]; !found {
+			v.addf(path+".filter", "unknown filter %q, expected hard, pcf, poisson or pcss", filter)
+		}
+	}
+	if size, ok := v.integer(light, path, "filterSize", false); ok && (size < 1 || size > 9) {
+		v.addf(path+".filterSize", "expected 1 to 9, found %d", size)
+	}
+	if lightSize, ok := v.number(light, path, "lightSize", false); ok && lightSize <= 0 {
+		v.addf(path+".lightSize", "must be positive, found %g", lightSize)
+	}
+}
+
+// validateReflectionProbe - checks one reflection probe, returning its name for the cross checks
+func (v *schemaValidator) validateReflectionProbe(path string, value interface{}) string {
+	probe, ok := v.object(path, value)
+	if !ok {
+		return ""
+	}
+
+	name, _ := v.str(probe, path, "name", true)
+	v.vector(probe, path, "position", 3, true)
+	if resolution, ok := v.integer(probe, path, "resolution", false); ok && resolution < 1 {
+		v.addf(path+".resolution", "must be positive, found %d", resolution)
+	}
+	near, nearOk := v.number(probe, path, "near", false)
+	if nearOk && near <= 0 {
+		v.addf(path+".near", "must be positive, found %g", near)
+	}
+	if far, ok := v.number(probe, path, "far", false); ok && nearOk && far <= near {
+		v.addf(path+".far", "must be beyond near (%g), found %g", near, far)
+	}
+	if update, ok := v.str(probe, path, "update", false); ok && !probeUpdates[update] {
+		v.addf(path+".update", "unknown update %q, expected once, interval or onDemand", update)
+	}
+	if interval, ok := v.integer(probe, path, "interval", false); ok && interval < 1 {
+		v.addf(path+".interval", "must be at least 1, found %d", interval)
+	}
+
+	v.boolean(probe, path, "boxProjection")
+	boxProjection, _ := probe["boxProjection"].(bool)
+	v.vector(probe, path, "boxMin", 3, boxProjection)
+	v.vector(probe, path, "boxMax", 3, boxProjection)
+	boxMin, minOk := probe["boxMin"].([]interface{})
+	boxMax, maxOk := probe["boxMax"].([]interface{})
+	if minOk && maxOk && len(boxMin) == 3 && len(boxMax) == 3 {
+		for i := range boxMin {
+			low, lowOk := boxMin[i].(float64)
+			high, highOk := boxMax[i].(float64)
+			if lowOk && highOk && low >= high {
+				v.addf(fmt.Sprintf("%s.boxMax[%d]", path, i), "must be greater than boxMin[%d] (%g), found %g", i, low, high)
+			}
+		}
+	}
+	return name
+}
+
+// validateSettings - checks the scene settings, returning the parent of the camera for the cross checks
+func (v *schemaValidator) validateSettings(path string, settings map[string]interface{}) string {
+	v.vector(settings, path, "backgroundColor", 3, false)
+
+	cameraParent := ""
+	if camera, ok := v.optionalObject(settings, path, "camera"); ok {
+		camPath := path + ".camera"
+		v.str(camera, camPath, "name", false)
+		v.vector(camera, camPath, "position", 3, false)
+		v.vector(camera, camPath, "front", 3, false)
+		v.vector(camera, camPath, "up", 3, false)
+		v.number(camera, camPath, "pitch", false)
+		v.number(camera, camPath, "yaw", false)
+		v.number(camera, camPath, "roll", false)
+		cameraParent, _ = v.str(camera, camPath, "parent", false)
+	}
+
+	if skybox, ok := v.optionalObject(settings, path, "skybox"); ok {
+		skyPath := path + ".skybox"
+		v.str(skybox, skyPath, "path", true)
+		v.str(skybox, skyPath, "format", true)
+		if layout, ok := v.str(skybox, skyPath, "layout", false); ok && !skyboxLayouts[layout] {
+			v.addf(skyPath+".layout", "unknown layout %q, expected faces, equirectangular or cross", layout)
+		}
+	}
+
+	if toneMapping, ok := v.optionalObject(settings, path, "toneMapping"); ok {
+		v.validateToneMapping(toneMapping, path+".toneMapping")
+	}
+
+	if effects, ok := v.array(settings, path, "postProcess", false); ok {
+		for i, value := range effects {
+			v.validatePostEffect(fmt.Sprintf("%s.postProcess[%d]", path, i), value)
+		}
+	}
+
+	if ssao, ok := v.optionalObject(settings, path, "ssao"); ok {
+		v.validateSSAO(ssao, path+".ssao")
+	}
+
+	if renderer, ok := v.str(settings, path, "renderer", false); ok &&
+		renderer != ForwardRendering && renderer != DeferredRendering {
+		v.addf(path+".renderer", "unknown renderer %q, expected forward or deferred", renderer)
+	}
+
+	return cameraParent
+}
+
+// validateToneMapping - checks the settings the HDR frame is tone mapped with
+func (v *schemaValidator) validateToneMapping(toneMapping map[string]interface{}, path string) {
+	if operator, ok := v.str(toneMapping, path, "operator", false); ok {
+		if _, found := toneMapOperators[operator]; !found {
+			v.addf(path+".operator", "unknown operator %q, expected none, reinhard, aces or filmic", operator)
+		}
+	}
+	if output, ok := v.str(toneMapping, path, "output", false); ok {
+		if _, found := toneMapOutputs[output]; !found {
+			v.addf(path+".output", "unknown output %q, expected linear, srgb or gamma", output)
+		}
+	}
+	for _, key := range []string{"exposure", "keyValue", "adaptationSpeed", "gamma"} {
+		if n, ok := v.number(toneMapping, path, key, false); ok && n <= 0 {
+			v.addf(path+"."+key, "must be positive, found %g", n)
+		}
+	}
+	v.boolean(toneMapping, path, "autoExposure")
+}
+
+// validateSSAO - checks the screen space ambient occlusion settings
+func (v *schemaValidator) validateSSAO(ssao map[string]interface{}, path string) {
+	v.boolean(ssao, path, "enabled")
+	for _, key := range []string{"radius", "bias", "power"} {
+		if n, ok := v.number(ssao, path, key, false); ok && n <= 0 {
+			v.addf(path+"."+key, "must be positive, found %g", n)
+		}
+	}
+	if samples, ok := v.integer(ssao, path, "samples", false); ok && (samples < 1 || samples > MaxSSAOSamples) {
+		v.addf(path+".samples", "expected 1 to %d, found %d", MaxSSAOSamples, samples)
+	}
+	if blur, ok := v.integer(ssao, path, "blur", false); ok && blur < 0 {
+		v.addf(path+".blur", "must not be negative, found %d", blur)
+	}
+}
+
+// validatePostEffect - checks one effect of the post processing stack
+func (v *schemaValidator) validatePostEffect(path string, value interface{}) {
+	effect, ok := v.object(path, value)
+	if !ok {
+		return
+	}
+
+	name, ok := v.str(effect, path, "effect", true)
+	if ok && !knownPostEffect(name) {
+		v.addf(path+".effect", "unknown effect %q", name)
+	}
+	v.boolean(effect, path, "enabled")
+	for _, key := range []string{"intensity", "threshold", "smoothness"} {
+		if n, ok := v.number(effect, path, key, false); ok && n < 0 {
+			v.addf(path+"."+key, "must not be negative, found %g", n)
+		}
+	}
+	for _, key := range []string{"radius", "focusDistance", "focusRange"} {
+		if n, ok := v.number(effect, path, key, false); ok && n <= 0 {
+			v.addf(path+"."+key, "must be positive, found %g", n)
+		}
+	}
+	v.str(effect, path, "lut", name == "colorGrading")
+}
+
+// joinPath - path of a field inside the value at path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (v *schemaValidator) object(path string, value interface{}) (map[string]interface{}, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.addf(path, "expected an object, found %s", jsonTypeName(value))
+	}
+	return obj, ok
+}
+
+func (v *schemaValidator) requiredObject(parent map[string]interface{}, path, key string) (map[string]interface{}, bool) {
+	value, found := parent[key]
+	if !found {
+		v.addf(joinPath(path, key), "required")
+		return nil, false
+	}
+	return v.object(joinPath(path, key), value)
+}
+
+func (v *schemaValidator) optionalObject(parent map[string]interface{}, path, key string) (map[string]interface{}, bool) {
+	value, found := parent[key]
+	if !found {
+		return nil, false
+	}
+	return v.object(joinPath(path, key), value)
+}
+
+func (v *schemaValidator) array(parent map[string]interface{}, path, key string, required bool) ([]interface{}, bool) {
+	value, found := parent[key]
+	if !found {
+		if required {
+			v.addf(joinPath(path, key), "required")
+		}
+		return nil, false
+	}
+
+	arr, ok := value.([]interface{})
+	if !ok {
+		v.addf(joinPath(path, key), "expected an array, found %s", jsonTypeName(value))
+	}
+	return arr, ok
+}
+
+func (v *schemaValidator) str(parent map[string]interface{}, path, key string, required bool) (string, bool) {
+	value, found := parent[key]
+	if !found {
+		if required {
+			v.addf(joinPath(path, key), "required")
+		}
+		return "", false
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		v.addf(joinPath(path, key), "expected a string, found %s", jsonTypeName(value))
+		return "", false
+	}
+	if required && s == "" {
+		v.addf(joinPath(path, key), "must not be empty")
+		return "", false
+	}
+	return s, true
+}
+
+func (v *schemaValidator) number(parent map[string]interface{}, path, key string, required bool) (float64, bool) {
+	value, found := parent[key]
+	if !found {
+		if required {
+			v.addf(joinPath(path, key), "required")
+		}
+		return 0, false
+	}
+
+	n, ok := value.(float64)
+	if !ok {
+		v.addf(joinPath(path, key), "expected a number, found %s", jsonTypeName(value))
+	}
+	return n, ok
+}
+
+func (v *schemaValidator) integer(parent map[string]interface{}, path, key string, required bool) (int, bool) {
+	n, ok := v.number(parent, path, key, required)
+	if !ok {
+		return 0, false
+	}
+	if n != math.Trunc(n) {
+		v.addf(joinPath(path, key), "expected a whole number, found %v", n)
+		return 0, false
+	}
+	return int(n), true
+}
+
+func (v *schemaValidator) boolean(parent map[string]interface{}, path, key string) {
+	value, found := parent[key]
+	if !found {
+		return
+	}
+	if _, ok := value.(bool); !ok {
+		v.addf(joinPath(path, key), "expected true or false, found %s", jsonTypeName(value))
+	}
+}
+
+// vector - checks that a field is an array of exactly n numbers
+func (v *schemaValidator) vector(parent map[string]interface{}, path, key string, n int, required bool) {
+	arr, ok := v.array(parent, path, key, required)
+	if !ok {
+		return
+	}
+
+	if len(arr) != n {
+		v.addf(joinPath(path, key), "expected %d numbers, found %d", n, len(arr))
+	}
+	for i, value := range arr {
+		if _, ok := value.(float64); !ok {
+			v.addf(fmt.Sprintf("%s[%d]", joinPath(path, key), i), "expected a number, found %s", jsonTypeName(value))
+		}
+	}
+}
+
+// jsonTypeName - name of the json type of a value decoded into an interface{}
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,324 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// shadowCaster - what the shadow cache knows about one object between frames
+type shadowCaster struct {
+	model    mgl32.Mat4
+	previous mgl32.Mat4
+	center   mgl32.Vec3 //bounding sphere in object space
+	radius   float32
+	dynamic  bool //has moved since the scene was loaded, so it is never baked into a static map
+	moved    bool //model matrix changed this frame
+	promoted bool //became dynamic this frame, static maps holding it are stale
+	seen     bool
+}
+
+// shadowCache - records which shadow casters moved each frame so lights only redraw their maps when something they
+// show changed. Objects count as static until they first move. Each light keeps a map of its static casters and
+// builds its shadow map from a copy of it with the dynamic casters drawn on top
+type shadowCache struct {
+	casters        map[Geometry]*shadowCaster
+	generation     int  //bumped when a static caster leaves the scene, every static map is stale then
+	dynamicRemoved bool //a dynamic caster left the scene this frame
+	copyFBO        uint32
+}
+
+// UpdateShadowCasters - compares every object's model matrix with the last frame's. Call it once per frame after the
+// scene graph update and before any shadow map is drawn
+func (s *State) UpdateShadowCasters() {
+	cache := &s.shadows
+	first := cache.casters == nil
+	if first {
+		cache.casters = make(map[Geometry]*shadowCaster)
+	}
+
+	for _, caster := range cache.casters {
+		caster.seen = false
+	}
+
+	for _, object := range s.Objects {
+		model := casterMatrix(object)
+		caster, found := cache.casters[object]
+		if !found {
+			box := GetBoundingBox(object.GetVertices().Vertices)
+			//objects added after the first frame aren't in any static map
+			caster = &shadowCaster{
+				model:    model,
+				previous: model,
+				center:   box.Min.Add(box.Max).Mul(0.5),
+				radius:   box.Max.Sub(box.Min).Len() / 2,
+				dynamic:  !first,
+				moved:    !first,
+			}
+			cache.casters[object] = caster
+		} else {
+			caster.previous = caster.model
+			caster.model = model
+			caster.moved = model != caster.previous
+			caster.promoted = caster.moved && !caster.dynamic
+			caster.dynamic = caster.dynamic || caster.moved
+		}
+		caster.seen = true
+	}
+
+	cache.dynamicRemoved = false
+	for object, caster := range cache.casters {
+		if caster.seen {
+			continue
+		}
+		if caster.dynamic {
+			cache.dynamicRemoved = true
+		} else {
+			cache.generation++
+		}
+		delete(cache.casters, object)
+	}
+}
+
+// RenderPointShadows - brings the cube map of a shadowed point light up to date. The static casters within the
+// light's far plane are only redrawn when the light or one of them moved, and the dynamic ones only when one of
+// them moved
+func (s *State) RenderPointShadows(light *PointLight, shadowProgramInfo *ProgramInfo) {
+	position := mgl32.Vec3{light.Position[0], light.Position[1], light.Position[2]}
+	staticDirty := light.Move || light.staticMap == 0 || light.staticGeneration != s.shadows.generation
+	dynamicDirty := s.shadows.dynamicRemoved
+
+	var static, dynamic []Geometry
+	for _, object := range s.Objects {
+		caster := s.shadows.casters[object]
+		if caster == nil || !caster.nearPoint(position, light.FarPlane) {
+			continue
+		}
+		if caster.dynamic {
+			dynamic = append(dynamic, object)
+			dynamicDirty = dynamicDirty || caster.moved
+			staticDirty = staticDirty || caster.promoted
+		} else {
+			static = append(static, object)
+		}
+	}
+	if !staticDirty && !dynamicDirty {
+		return
+	}
+
+	resolution := light.ShadowResolution
+	gl.Viewport(0, 0, resolution, resolution)
+	if staticDirty {
+		if light.Move {
+			light.CreateLightSpaceTransforms(float32(resolution), float32(resolution))
+		}
+		if light.staticMap == 0 {
+			light.staticMap = newCubeDepthMap(resolution, resolution)
+		}
+		s.bindShadowTarget(light.staticMap, -1)
+		gl.Clear(gl.DEPTH_BUFFER_BIT)
+		for _, copies := range s.instanceBatches(static) {
+			light.ShadowRender(s, copies, shadowProgramInfo)
+		}
+		light.staticGeneration = s.shadows.generation
+		light.Move = false
+	}
+
+	s.copyDepthLayers(light.staticMap, light.DepthMap, gl.TEXTURE_CUBE_MAP, 6, resolution)
+	s.bindShadowTarget(light.DepthMap, -1)
+	for _, copies := range s.instanceBatches(dynamic) {
+		light.ShadowRender(s, copies, shadowProgramInfo)
+	}
+	s.unbindShadowTarget()
+}
+
+// RenderDirectionalShadows - brings every cascade of a directional light up to date after UpdateCascades. The
+// cascades follow the camera, so the static casters are redrawn whenever the camera moves as well
+func (s *State) RenderDirectionalShadows(light *DirectionalLight, shadowProgramInfo *ProgramInfo) {
+	staticDirty := light.staticMap == 0 || light.staticGeneration != s.shadows.generation ||
+		!sameMatrices(light.CascadeMatrices, light.staticMatrices)
+	dynamicDirty := s.shadows.dynamicRemoved
+
+	var static, dynamic []Geometry
+	for _, object := range s.Objects {
+		caster := s.shadows.casters[object]
+		if caster == nil || !caster.inCascades(light.CascadeMatrices) {
+			continue
+		}
+		if caster.dynamic {
+			dynamic = append(dynamic, object)
+			dynamicDirty = dynamicDirty || caster.moved
+			staticDirty = staticDirty || caster.promoted
+		} else {
+			static = append(static, object)
+		}
+	}
+	if !staticDirty && !dynamicDirty {
+		return
+	}
+
+	resolution := light.ShadowResolution
+	cascades := len(light.CascadeMatrices)
+	gl.Viewport(0, 0, resolution, resolution)
+	//depth clamping keeps casters in front of a cascade's near plane in the map
+	gl.Enable(gl.DEPTH_CLAMP)
+	if staticDirty {
+		if light.staticMap == 0 {
+			light.staticMap = newDepthArray(resolution, light.Cascades)
+		}
+		batches := s.instanceBatches(static)
+		for c := 0; c < cascades; c++ {
+			s.bindShadowTarget(light.staticMap, c)
+			gl.Clear(gl.DEPTH_BUFFER_BIT)
+			for _, copies := range batches {
+				light.ShadowRender(s, copies, shadowProgramInfo, c)
+			}
+		}
+		light.staticGeneration = s.shadows.generation
+		light.staticMatrices = append(light.staticMatrices[:0], light.CascadeMatrices...)
+	}
+
+	s.copyDepthLayers(light.staticMap, light.DepthMap, gl.TEXTURE_2D_ARRAY, cascades, resolution)
+	batches := s.instanceBatches(dynamic)
+	for c := 0; c < cascades; c++ {
+		s.bindShadowTarget(light.DepthMap, c)
+		for _, copies := range batches {
+			light.ShadowRender(s, copies, shadowProgramInfo, c)
+		}
+	}
+	gl.Disable(gl.DEPTH_CLAMP)
+	s.unbindShadowTarget()
+}
+
+// deleteShadowCache - frees the static maps and the copy framebuffer and forgets every caster
+func (s *State) deleteShadowCache() {
+	for i := 0; i < len(s.PointLights); i++ {
+		if s.PointLights[i].staticMap != 0 {
+			gl.DeleteTextures(1, &s.PointLights[i].staticMap)
+		}
+	}
+	for i := 0; i < len(s.DirectionalLights); i++ {
+		if s.DirectionalLights[i].staticMap != 0 {
+			gl.DeleteTextures(1, &s.DirectionalLights[i].staticMap)
+		}
+	}
+	if s.shadows.copyFBO != 0 {
+		gl.DeleteFramebuffers(1, &s.shadows.copyFBO)
+	}
+	s.shadows = shadowCache{}
+}
+
+// bindShadowTarget - binds the depth framebuffer with a depth texture attached. A layer of -1 attaches every face of
+// a cube map for the layered point light pass, otherwise one layer of a texture array is attached
+func (s *State) bindShadowTarget(texture uint32, layer int) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.DepthFBO)
+	if layer < 0 {
+		gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, texture, 0)
+	} else {
+		gl.FramebufferTextureLayer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, texture, 0, int32(layer))
+	}
+	gl.DrawBuffer(gl.NONE)
+	gl.ReadBuffer(gl.NONE)
+
+	//error check the framebuffer
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		fmt.Println("ERROR WITH FRAMEBUFFER ", status)
+		panic(status)
+	}
+}
+
+func (s *State) unbindShadowTarget() {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.DepthFBO)
+	gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, 0, 0)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+}
+
+// copyDepthLayers - copies the first layers faces or layers of one depth texture into another the same size. Cube
+// faces are attached one at a time since GL 4.1 can't attach a single layer of a cube map
+func (s *State) copyDepthLayers(from, to, target uint32, layers int, size int32) {
+	if s.shadows.copyFBO == 0 {
+		gl.GenFramebuffers(1, &s.shadows.copyFBO)
+	}
+
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, s.shadows.copyFBO)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, s.DepthFBO)
+	for layer := 0; layer < layers; layer++ {
+		if target == gl.TEXTURE_CUBE_MAP {
+			face := uint32(gl.TEXTURE_CUBE_MAP_POSITIVE_X + layer)
+			gl.FramebufferTexture2D(gl.READ_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, face, from, 0)
+			gl.FramebufferTexture2D(gl.DRAW_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, face, to, 0)
+		} else {
+			gl.FramebufferTextureLayer(gl.READ_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, from, 0, int32(layer))
+			gl.FramebufferTextureLayer(gl.DRAW_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, to, 0, int32(layer))
+		}
+		gl.BlitFramebuffer(0, 0, size, size, 0, 0, size, size, gl.DEPTH_BUFFER_BIT, gl.NEAREST)
+	}
+
+	gl.FramebufferTexture(gl.READ_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, 0, 0)
+	gl.FramebufferTexture(gl.DRAW_FRAMEBUFFER, gl.DEPTH_ATTACHMENT, 0, 0)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, 0)
+}
+
+// sphere - world space bounding sphere of the caster under model
+func (c *shadowCaster) sphere(model mgl32.Mat4) (mgl32.Vec3, float32) {
+	scale := model.Col(0).Vec3().Len()
+	if y := model.Col(1).Vec3().Len(); y > scale {
+		scale = y
+	}
+	if z := model.Col(2).Vec3().Len(); z > scale {
+		scale = z
+	}
+	return mgl32.TransformCoordinate(c.center, model), c.radius * scale
+}
+
+// nearPoint - whether the caster is within farPlane of a point light now or was last frame
+func (c *shadowCaster) nearPoint(position mgl32.Vec3, farPlane float32) bool {
+	for _, model := range []mgl32.Mat4{c.model, c.previous} {
+		center, radius := c.sphere(model)
+		if center.Sub(position).Len()-radius <= farPlane {
+			return true
+		}
+	}
+	return false
+}
+
+// inCascades - whether the caster overlaps the light space box of any cascade now or did last frame. Casters between
+// the light and a box are clamped onto its near plane, so only the far side of the box limits the depth
+func (c *shadowCaster) inCascades(cascades []mgl32.Mat4) bool {
+	for _, model := range []mgl32.Mat4{c.model, c.previous} {
+		center, radius := c.sphere(model)
+		for _, lightSpace := range cascades {
+			p := mgl32.TransformCoordinate(center, lightSpace)
+			r := radius * lightSpace.Row(0).Vec3().Len()
+			if math.Abs(float64(p[0])) <= float64(1+r) && math.Abs(float64(p[1])) <= float64(1+r) && p[2] <= 1+r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// casterMatrix - world transform the shadow passes draw the object with
+func casterMatrix(object Geometry) mgl32.Mat4 {
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
+	}
+	return modelMatrix
+}
+
+func sameMatrices(a, b []mgl32.Mat4) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
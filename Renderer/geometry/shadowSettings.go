@@ -0,0 +1,57 @@
+package geometry
+
+import "fmt"
+
+const (
+	// DefaultShadowResolution - width and height of a shadow map that doesn't set shadowResolution
+	DefaultShadowResolution = 1024
+	// DefaultShadowBias - depth bias in shadow map texels when bias isn't set
+	DefaultShadowBias = 1.0
+	// DefaultShadowFilter - filter of a light that doesn't set filter
+	DefaultShadowFilter = "pcf"
+	// DefaultFilterSize - PCF kernel width and Poisson disk diameter in texels when filterSize isn't set
+	DefaultFilterSize = 3
+)
+
+// shadowFilters - filter names in the scene file and the matching SHADOW_ define in shader/shadows.go
+var shadowFilters = map[string]int32{
+	"hard":    0,
+	"pcf":     1,
+	"poisson": 2,
+	"pcss":    3,
+}
+
+// ShadowSettings - how a light's shadow map is rendered and sampled. Biases and filter sizes are in shadow map texels
+// so they hold up however big the area a texel covers is. LightSize only matters to pcss
+type ShadowSettings struct {
+	ShadowResolution int32    `json:"shadowResolution"`
+	Bias             *float32 `json:"bias"` //0 turns the bias off
+	NormalBias       float32  `json:"normalBias"`
+	Filter           string   `json:"filter"`
+	FilterSize       int32    `json:"filterSize"`
+	LightSize        float32  `json:"lightSize"`
+}
+
+// setDefaults - fills in the settings the scene file left out for the named light, lightSize depends on the kind of
+// light
+func (s *ShadowSettings) setDefaults(light string, lightSize float32) {
+	if s.ShadowResolution <= 0 {
+		s.ShadowResolution = DefaultShadowResolution
+	}
+	if s.Bias == nil {
+		bias := float32(DefaultShadowBias)
+		s.Bias = &bias
+	}
+	if _, found := shadowFilters[s.Filter]; !found {
+		if s.Filter != "" {
+			fmt.Printf("Warning: light %q has unknown shadow filter %q, using %s\n", light, s.Filter, DefaultShadowFilter)
+		}
+		s.Filter = DefaultShadowFilter
+	}
+	if s.FilterSize <= 0 {
+		s.FilterSize = DefaultFilterSize
+	}
+	if s.LightSize <= 0 {
+		s.LightSize = lightSize
+	}
+}
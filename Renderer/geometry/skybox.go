@@ -13,34 +13,42 @@ import (
 	"github.com/go-gl/gl/v4.1-core/gl"
 )
 
+// Skybox - the sky drawn behind the scene and lighting it. Path and Format name the image or images, see the layouts
+// in skyboxLayout.go
 type Skybox struct {
 	Path        string `json:"path"`
 	Format      string `json:"format"`
+	Layout      string `json:"layout"`
 	Vertices    []float32
 	ProgramInfo ProgramInfo
 	CubeMap     uint32
 	VAO         uint32
+
+	irradiance  uint32 //the maps image based lighting reads, see imageBasedLighting.go
+	prefiltered uint32
+	brdfLUT     uint32
+}
+
+// Bind - binds the sky's cube map to the unit the skybox samplers read
+func (s *Skybox) Bind() {
+	bindUnit(skyboxUnit, gl.TEXTURE_CUBE_MAP, s.CubeMap)
 }
 
-func LoadCubeMap(path, extension string) uint32 {
+// LoadCubeMap - loads the 6 faces <path>0.<extension> to <path>5.<extension> into a cube map texture
+func LoadCubeMap(path, extension string) (uint32, error) {
 	var textureID uint32
 	gl.GenTextures(1, &textureID)
 	gl.BindTexture(gl.TEXTURE_CUBE_MAP, textureID)
 
 	for i := 0; i < 6; i++ {
-		//fmt.Println(path + strconv.Itoa(i) + "." + extension)
-		imgFile, err := os.Open(path + strconv.Itoa(i) + "." + extension)
+		facePath := path + strconv.Itoa(i) + "." + extension
+		rgba, err := loadRGBA(facePath)
 		if err != nil {
-			panic(err)
+			gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+			gl.DeleteTextures(1, &textureID)
+			return 0, newLoadError("skybox", facePath, err)
 		}
 
-		defer imgFile.Close()
-
-		img, _, err := image.Decode(imgFile)
-		if err != nil {
-			panic(err)
-		}
-		rgba := image.NewRGBA(img.Bounds())
 		internalFmt := int32(gl.SRGB_ALPHA)
 		format := uint32(gl.RGBA)
 		width := int32(rgba.Rect.Size().X)
@@ -48,22 +56,40 @@ func LoadCubeMap(path, extension string) uint32 {
 		pixType := uint32(gl.UNSIGNED_BYTE)
 		dataPtr := gl.Ptr(rgba.Pix)
 
-		draw.Draw(rgba, rgba.Bounds(), img, image.Pt(0, 0), draw.Src)
 		gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X+uint32(i), 0, internalFmt, width, height, 0, format, pixType, dataPtr)
 	}
 
-	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+	finishCubeMap()
 	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
 
-	return textureID
+	return textureID, nil
+}
+
+// loadRGBA - decodes an image file into an RGBA image, used for cube map faces and colour grading LUTs
+func loadRGBA(path string) (*image.RGBA, error) {
+	imgFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer imgFile.Close()
+
+	img, _, err := image.Decode(imgFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, image.Pt(0, 0), draw.Src)
+	return rgba, nil
 }
 
-func InitSkyBox(path, extension string, settingsSkyBox *Skybox) {
-	skybox := LoadCubeMap(path, extension)
+// InitSkyBox - loads the skybox cube map in the skybox's layout, creates the program and VAO used to draw it and
+// works out the environment maps the lit shaders are lit by
+func InitSkyBox(path, extension string, settingsSkyBox *Skybox) error {
+	skybox, err := loadSkyboxCubeMap(path, extension, settingsSkyBox.Layout)
+	if err != nil {
+		return err
+	}
 
 	skyboxVertices := []float32{
 		//front face
@@ -139,4 +165,6 @@ func InitSkyBox(path, extension string, settingsSkyBox *Skybox) {
 	settingsSkyBox.VAO = skyboxVAO
 	settingsSkyBox.ProgramInfo = skyShaderProgramInfo
 	settingsSkyBox.Vertices = skyboxVertices
+
+	return settingsSkyBox.precomputeEnvironment()
 }
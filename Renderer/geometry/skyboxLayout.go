@@ -0,0 +1,172 @@
+package geometry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// skybox layouts, the faces layout is used when none is given
+const (
+	SkyboxFaces           = "faces"           //six images <path>0.<format> to <path>5.<format>, +X -X +Y -Y +Z -Z
+	SkyboxEquirectangular = "equirectangular" //one latitude-longitude image twice as wide as it is high
+	SkyboxCross           = "cross"           //one image of the faces unfolded into a horizontal or vertical cross
+)
+
+// skyboxLayouts - layout names accepted in the scene file
+var skyboxLayouts = map[string]bool{
+	SkyboxFaces:           true,
+	SkyboxEquirectangular: true,
+	SkyboxCross:           true,
+}
+
+// loadSkyboxCubeMap - loads the skybox's image or images into a cube map as its layout says. Faces of LDR images
+// keep the sRGB cube map LoadCubeMap makes, everything else becomes a floating point one
+func loadSkyboxCubeMap(path, format, layout string) (uint32, error) {
+	switch layout {
+	case SkyboxEquirectangular:
+		img, err := loadFloatImage(path, format)
+		if err != nil {
+			return 0, newLoadError("skybox", path, err)
+		}
+		cubeMap, err := equirectangularToCubeMap(img)
+		if err != nil {
+			return 0, newLoadError("skybox", path, err)
+		}
+		return cubeMap, nil
+	case SkyboxCross:
+		img, err := loadFloatImage(path, format)
+		if err != nil {
+			return 0, newLoadError("skybox", path, err)
+		}
+		faces, err := cutCross(img)
+		if err != nil {
+			return 0, newLoadError("skybox", path, err)
+		}
+		return floatCubeMap(faces), nil
+	case "", SkyboxFaces:
+		if strings.ToLower(format) != "hdr" {
+			return LoadCubeMap(path, format)
+		}
+		faces := make([]*floatImage, 6)
+		for i := range faces {
+			facePath := path + strconv.Itoa(i) + "." + format
+			face, err := loadRadiance(facePath)
+			if err != nil {
+				return 0, newLoadError("skybox", facePath, err)
+			}
+			if face.width != face.height || (i > 0 && face.width != faces[0].width) {
+				return 0, newLoadError("skybox", facePath, fmt.Errorf("faces must be square and the same size, found %dx%d", face.width, face.height))
+			}
+			faces[i] = face
+		}
+		return floatCubeMap(faces), nil
+	}
+	return 0, fmt.Errorf("unknown skybox layout %q", layout)
+}
+
+// crossFaces - the column and row of each face, +X -X +Y -Y +Z -Z, in a cross three faces wide. A horizontal cross
+// puts -Z at the end of the middle row, a vertical one puts it upside down below -Y
+var crossFaces = [6][2]int{{2, 1}, {0, 1}, {1, 0}, {1, 2}, {1, 1}, {3, 1}}
+
+// cutCross - cuts the six faces out of a horizontal (4:3) or vertical (3:4) cross
+func cutCross(img *floatImage) ([]*floatImage, error) {
+	vertical := img.width*4 == img.height*3
+	if img.width*3 != img.height*4 && !vertical {
+		return nil, fmt.Errorf("a cross must be 4:3 or 3:4, found %dx%d", img.width, img.height)
+	}
+	size := img.height / 3
+	if vertical {
+		size = img.width / 3
+	}
+
+	faces := make([]*floatImage, 6)
+	for i, cell := range crossFaces {
+		column, row := cell[0], cell[1]
+		flip := false
+		if vertical && i == 5 {
+			column, row, flip = 1, 3, true
+		}
+		face := newFloatImage(size, size)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				sx, sy := x, y
+				if flip {
+					sx, sy = size-1-x, size-1-y
+				}
+				copy(face.at(x, y), img.at(column*size+sx, row*size+sy))
+			}
+		}
+		faces[i] = face
+	}
+	return faces, nil
+}
+
+// floatCubeMap - uploads six square faces, +X -X +Y -Y +Z -Z, into a half float cube map
+func floatCubeMap(faces []*floatImage) uint32 {
+	var textureID uint32
+	gl.GenTextures(1, &textureID)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, textureID)
+	for i, face := range faces {
+		size := int32(face.width)
+		gl.TexImage2D(gl.TEXTURE_CUBE_MAP_POSITIVE_X+uint32(i), 0, gl.RGB16F, size, size, 0, gl.RGB, gl.FLOAT, gl.Ptr(face.pix))
+	}
+	finishCubeMap()
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	return textureID
+}
+
+// equirectangularToCubeMap - renders a latitude-longitude image into the faces of a half float cube map a quarter
+// of its width across
+func equirectangularToCubeMap(img *floatImage) (uint32, error) {
+	if img.width != img.height*2 || img.width < 4 {
+		return 0, fmt.Errorf("an equirectangular image must be 2:1, found %dx%d", img.width, img.height)
+	}
+	size := int32(img.width / 4)
+
+	var source uint32
+	gl.GenTextures(1, &source)
+	gl.BindTexture(gl.TEXTURE_2D, source)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	//longitude wraps round, latitude stops at the poles
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB32F, int32(img.width), int32(img.height), 0, gl.RGB, gl.FLOAT, gl.Ptr(img.pix))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	cubeMap := newCubeTexture(size, 1)
+	pass := beginOffscreenPass()
+	program := newPostProgram(&shader.EquirectangularShader{})
+	gl.UseProgram(program.program)
+	program.bindTexture("equirectangular", 0, gl.TEXTURE_2D, source)
+	err := renderCubeFaces(program, cubeMap, 0, size)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.DeleteProgram(program.program)
+	pass.end()
+	gl.DeleteTextures(1, &source)
+
+	if err != nil {
+		gl.DeleteTextures(1, &cubeMap)
+		return 0, err
+	}
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, cubeMap)
+	finishCubeMap()
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	return cubeMap, nil
+}
+
+// finishCubeMap - builds the mip levels of the bound cube map and sets how it's sampled
+func finishCubeMap() {
+	//the environment passes read the sky from smaller mip levels the blurrier their samples
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAX_LEVEL, 1000)
+	gl.GenerateMipmap(gl.TEXTURE_CUBE_MAP)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_CUBE_MAP, gl.TEXTURE_WRAP_R, gl.CLAMP_TO_EDGE)
+}
@@ -0,0 +1,314 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	// MaxSSAOSamples - size of the sample kernel array in shader/ssao.go
+	MaxSSAOSamples = 64
+	// DefaultSSAORadius - how far around a surface occluders are looked for, in world units
+	DefaultSSAORadius = 0.5
+	// DefaultSSAOSamples - samples taken for each pixel
+	DefaultSSAOSamples = 16
+	// DefaultSSAOBias - how far in front of a sample a surface must be to hide it
+	DefaultSSAOBias = 0.025
+	// DefaultSSAOBlur - pixels either side of each pixel the occlusion is averaged over
+	DefaultSSAOBlur = 2
+	// DefaultSSAOPower - what the occlusion is raised to, higher is darker
+	DefaultSSAOPower = 1
+
+	ssaoNoiseSize = 4 //width and height of the tiled noise texture
+)
+
+// SSAO - screen space ambient occlusion of a scene, which darkens the ambient light of the lit shaders in creases and
+// corners. It is off unless Enabled is set
+type SSAO struct {
+	Enabled bool    `json:"enabled"`
+	Radius  float32 `json:"radius"`
+	Samples int32   `json:"samples"` //1 to MaxSSAOSamples
+	Bias    float32 `json:"bias"`
+	Blur    *int32  `json:"blur"` //0 leaves the noise in
+	Power   float32 `json:"power"`
+}
+
+// setDefaults - fills in the values the scene file left out
+func (s *SSAO) setDefaults() {
+	if s.Radius <= 0 {
+		s.Radius = DefaultSSAORadius
+	}
+	if s.Samples <= 0 {
+		s.Samples = DefaultSSAOSamples
+	}
+	if s.Samples > MaxSSAOSamples {
+		s.Samples = MaxSSAOSamples
+	}
+	if s.Bias <= 0 {
+		s.Bias = DefaultSSAOBias
+	}
+	if s.Blur == nil || *s.Blur < 0 {
+		blur := int32(DefaultSSAOBlur)
+		s.Blur = &blur
+	}
+	if s.Power <= 0 {
+		s.Power = DefaultSSAOPower
+	}
+}
+
+// SSAOPass - draws the view space position and normal of the opaque lit objects in a prepass, estimates from them
+// how hidden each pixel is from the light around it, blurs that and binds it for the lit shaders to scale their
+// ambient term by
+type SSAOPass struct {
+	width      int32
+	height     int32
+	fbo        uint32
+	position   uint32 //RGBA32F, view space position, w is 1 where there is a surface
+	normal     uint32 //RGBA16F, view space normal
+	depthRB    uint32
+	occlusion  [2]colorTarget //R16F, the raw occlusion and the blurred one
+	noise      uint32
+	kernel     []float32
+	kernelSize int32
+
+	prepass ProgramInfo
+	ssao    postProgram
+	blur    postProgram
+	vao     uint32 //empty, for the fullscreen triangle
+}
+
+// NewSSAOPass - the programs and targets are made by Begin, the first time a scene asks for SSAO
+func NewSSAOPass() *SSAOPass {
+	return &SSAOPass{}
+}
+
+// Handles - whether an object is drawn into the prepass, only the lit shader types read the occlusion
+func (p *SSAOPass) Handles(object Geometry) bool {
+	mat := object.GetMaterial()
+	return mat.Alpha >= 1.0 && litShaderType(mat.ShaderType)
+}
+
+// Begin - binds and clears the prepass for the objects to be drawn into, remaking the targets first if the frame
+// size changed
+func (p *SSAOPass) Begin(width, height int32) error {
+	if p.prepass.Program == 0 {
+		p.setup()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if p.fbo == 0 || width != p.width || height != p.height {
+		if err := p.createTargets(width, height); err != nil {
+			return err
+		}
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.fbo)
+	gl.Viewport(0, 0, width, height)
+	zero := []float32{0, 0, 0, 0}
+	gl.ClearBufferfv(gl.COLOR, 0, &zero[0])
+	gl.ClearBufferfv(gl.COLOR, 1, &zero[0])
+	one := float32(1)
+	gl.ClearBufferfv(gl.DEPTH, 0, &one)
+
+	gl.Enable(gl.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.DepthFunc(gl.LEQUAL)
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.CULL_FACE)
+	return nil
+}
+
+// setup - builds the programs and the noise texture
+func (p *SSAOPass) setup() {
+	s := &shader.PositionNormalShader{}
+	s.Setup()
+	p.prepass.Program = InitOpenGL(s.GetVertShader(), s.GetFragShader(), s.GetGeometryShader())
+	cacheUniformLocations(&p.prepass)
+
+	p.ssao = newPostProgram(&shader.SSAOShader{})
+	p.blur = newPostProgram(&shader.SSAOBlurShader{})
+	gl.GenVertexArrays(1, &p.vao)
+
+	//random directions in the surface's plane, the same every run so frames can be compared
+	random := rand.New(rand.NewSource(1))
+	noise := make([]float32, 0, ssaoNoiseSize*ssaoNoiseSize*3)
+	for i := 0; i < ssaoNoiseSize*ssaoNoiseSize; i++ {
+		noise = append(noise, random.Float32()*2-1, random.Float32()*2-1, 0)
+	}
+	gl.GenTextures(1, &p.noise)
+	gl.BindTexture(gl.TEXTURE_2D, p.noise)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB32F, ssaoNoiseSize, ssaoNoiseSize, 0, gl.RGB, gl.FLOAT, gl.Ptr(noise))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// createTargets - makes the prepass textures, the depth buffer they share and the occlusion targets
+func (p *SSAOPass) createTargets(width, height int32) error {
+	p.deleteTargets()
+	p.width = width
+	p.height = height
+
+	gl.GenFramebuffers(1, &p.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.fbo)
+	//clamped to the edge, so samples outside the frame read its edge rather than wrapping round to the other side
+	p.position = newColorTexture(gl.RGBA32F, gl.RGBA, width, height, gl.NEAREST)
+	p.normal = newColorTexture(gl.RGBA16F, gl.RGBA, width, height, gl.NEAREST)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, p.position, 0)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT1, gl.TEXTURE_2D, p.normal, 0)
+	drawBuffers := []uint32{gl.COLOR_ATTACHMENT0, gl.COLOR_ATTACHMENT1}
+	gl.DrawBuffers(int32(len(drawBuffers)), &drawBuffers[0])
+
+	gl.GenRenderbuffers(1, &p.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, p.depthRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, p.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		return fmt.Errorf("SSAO prepass framebuffer incomplete: 0x%x", status)
+	}
+
+	for i := range p.occlusion {
+		target, err := newColorTarget(gl.R16F, gl.RED, width, height, gl.NEAREST)
+		p.occlusion[i] = target
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DrawObject - draws copies of an object the pass handles, see State.DrawCopies, into the prepass, after Begin
+func (p *SSAOPass) DrawObject(state *State, copies []Geometry, view, projection mgl32.Mat4) {
+	object := copies[0]
+	uniforms := p.prepass.UniformLocations
+	gl.UseProgram(p.prepass.Program)
+
+	modelMatrix, err := object.GetModelMatrix()
+	if err != nil {
+		modelMatrix = ObjectTransform(object).Matrix()
+	}
+	normalMatrix := NormalMatrix(modelMatrix)
+	gl.UniformMatrix4fv(uniforms.Projection, 1, false, &projection[0])
+	gl.UniformMatrix4fv(uniforms.View, 1, false, &view[0])
+	gl.UniformMatrix4fv(uniforms.Model, 1, false, &modelMatrix[0])
+	gl.UniformMatrix3fv(uniforms.NormalMatrix, 1, false, &normalMatrix[0])
+	state.DrawCopies(uniforms, copies)
+	gl.BindVertexArray(0)
+}
+
+// Occlude - works out the occlusion from the prepass and binds it to ssaoUnit for the lit shaders
+func (p *SSAOPass) Occlude(settings SSAO, projection mgl32.Mat4) {
+	if settings.Samples != p.kernelSize {
+		p.buildKernel(settings.Samples)
+	}
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.DepthMask(false)
+	gl.Disable(gl.BLEND)
+	gl.Viewport(0, 0, p.width, p.height)
+	gl.BindVertexArray(p.vao)
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.occlusion[0].fbo)
+	gl.UseProgram(p.ssao.program)
+	p.ssao.bindTexture("positionTexture", 0, gl.TEXTURE_2D, p.position)
+	p.ssao.bindTexture("normalTexture", 1, gl.TEXTURE_2D, p.normal)
+	p.ssao.bindTexture("noiseTexture", 2, gl.TEXTURE_2D, p.noise)
+	gl.Uniform3fv(p.ssao.location("samples"), p.kernelSize, &p.kernel[0])
+	gl.Uniform1i(p.ssao.location("sampleCount"), p.kernelSize)
+	gl.Uniform1f(p.ssao.location("radius"), settings.Radius)
+	gl.Uniform1f(p.ssao.location("bias"), settings.Bias)
+	gl.Uniform1f(p.ssao.location("power"), settings.Power)
+	gl.Uniform2f(p.ssao.location("noiseScale"), float32(p.width)/ssaoNoiseSize, float32(p.height)/ssaoNoiseSize)
+	gl.UniformMatrix4fv(p.ssao.location("projection"), 1, false, &projection[0])
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+
+	result := p.occlusion[0].texture
+	if settings.Blur != nil && *settings.Blur > 0 {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, p.occlusion[1].fbo)
+		gl.UseProgram(p.blur.program)
+		p.blur.bindTexture("occlusionTexture", 0, gl.TEXTURE_2D, result)
+		gl.Uniform1i(p.blur.location("blurRadius"), *settings.Blur)
+		gl.DrawArrays(gl.TRIANGLES, 0, 3)
+		result = p.occlusion[1].texture
+	}
+
+	gl.Enable(gl.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.BindVertexArray(0)
+	for unit := uint32(0); unit < 3; unit++ {
+		gl.ActiveTexture(gl.TEXTURE0 + unit)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}
+	bindFrameUnit(ssaoUnit, gl.TEXTURE_2D, result)
+}
+
+// buildKernel - random points in the hemisphere above a surface, more of them close to it since near occluders
+// matter most
+func (p *SSAOPass) buildKernel(size int32) {
+	random := rand.New(rand.NewSource(1))
+	p.kernel = p.kernel[:0]
+	for i := int32(0); i < size; i++ {
+		sample := mgl32.Vec3{random.Float32()*2 - 1, random.Float32()*2 - 1, random.Float32()}.Normalize()
+		t := float64(i) / float64(size)
+		scale := float32(0.1+0.9*t*t) * random.Float32()
+		sample = sample.Mul(float32(math.Max(float64(scale), 0.01)))
+		p.kernel = append(p.kernel, sample[0], sample[1], sample[2])
+	}
+	p.kernelSize = size
+}
+
+// deleteTargets - frees the prepass and occlusion targets
+func (p *SSAOPass) deleteTargets() {
+	if p.position != 0 {
+		textures := []uint32{p.position, p.normal}
+		gl.DeleteTextures(int32(len(textures)), &textures[0])
+		p.position, p.normal = 0, 0
+	}
+	if p.depthRB != 0 {
+		gl.DeleteRenderbuffers(1, &p.depthRB)
+		p.depthRB = 0
+	}
+	if p.fbo != 0 {
+		gl.DeleteFramebuffers(1, &p.fbo)
+		p.fbo = 0
+	}
+	for i := range p.occlusion {
+		if p.occlusion[i].fbo != 0 {
+			p.occlusion[i].delete()
+		}
+	}
+}
+
+// Delete - frees the targets, programs, noise texture and vertex array
+func (p *SSAOPass) Delete() {
+	p.deleteTargets()
+	for _, program := range []uint32{p.prepass.Program, p.ssao.program, p.blur.program} {
+		if program != 0 {
+			gl.DeleteProgram(program)
+		}
+	}
+	p.prepass.Program, p.ssao.program, p.blur.program = 0, 0, 0
+	if p.noise != 0 {
+		gl.DeleteTextures(1, &p.noise)
+		p.noise = 0
+	}
+	if p.vao != 0 {
+		gl.DeleteVertexArrays(1, &p.vao)
+		p.vao = 0
+	}
+}
@@ -20,7 +20,18 @@ type State struct {
 	ShadowMatrices    []mgl32.Mat4
 	CurrentTexUnit    uint32
 	DepthFBO          uint32
+	FrameBuffer       uint32 //framebuffer the final image is drawn into, 0 is the window
 	Settings          Settings
+	Scenes            []Scene //every scene in the loaded scene file
+	CurrentScene      int     //index into Scenes of the scene being drawn
+	ScenePath         string
+	Root              *Node //scene graph of the current scene, see BuildSceneGraph
+	ReflectionProbes  []ReflectionProbe
+	lights            lightBuffer
+	shadows           shadowCache
+	instances         instancing
+	sceneRequested    bool
+	requestedScene    int
 }
 
 // Camera : struct for holding info about the camera
@@ -32,4 +43,5 @@ type Camera struct {
 	Pitch    float32    `json:"pitch"`
 	Yaw      float32    `json:"yaw"`
 	Roll     float32    `json:"roll"`
+	Parent   string     `json:"parent"` //object the camera follows, Position is then relative to it
 }
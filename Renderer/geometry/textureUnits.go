@@ -0,0 +1,112 @@
+package geometry
+
+import (
+	"fmt"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// texture units of the samplers of the shaders objects are drawn with and of the deferred lighting passes. Each
+// sampler has a unit of its own, which bindSamplerUnits points it at once when its program is linked, and textures
+// are bound to the unit of the sampler that reads them. No unit is sampled as two types in one draw however many
+// textures a scene makes, and a sampler without a texture has its unit to itself. Passes with programs of their own,
+// post processing, ambient occlusion, transparency and the environment maps, number their samplers from 0 instead.
+// The point shadow maps come last, as how many there are is only known once the context is
+const (
+	//bound for each object drawn
+	baseColorUnit = iota
+	normalMapUnit
+	metallicRoughnessUnit
+	occlusionMapUnit
+	emissiveMapUnit
+	skyboxUnit
+	probeUnit
+	mirrorUnit
+	dirShadowUnits                                         //the ith directional light's shadow map is on dirShadowUnits+i
+	gBufferUnits   = dirShadowUnits + MaxDirectionalLights //bound for the lighting passes
+
+	//bound once a frame before anything is drawn, and left bound. Nothing else is bound to these
+	clusterUnits     = gBufferUnits + len(gBufferSamplers)
+	ssaoUnit         = clusterUnits + len(clusterSamplers)
+	environmentUnits = ssaoUnit + 1
+
+	//bound for each object drawn, the ith shadowed point light's shadow map is on pointShadowUnits+i
+	pointShadowUnits = environmentUnits + len(environmentSamplers)
+)
+
+// litSamplers - samplers the PBR shader reads besides the point shadow maps, the most of any lit shader: its five
+// material maps, the mirror, the directional shadow maps, the light clusters, ambient occlusion and the environment
+const litSamplers = 5 + 1 + MaxDirectionalLights + len(clusterSamplers) + 1 + len(environmentSamplers)
+
+// SetupTextureUnits - sizes the point shadow map array from the samplers the current context allows a fragment
+// shader, and the units it has, so the lit shaders link. Call it once the context is made, before any shader is set
+// up. OpenGL 4.1 only promises 16 samplers, which leaves no point light shadows
+func SetupTextureUnits() error {
+	var fragmentUnits, combinedUnits int32
+	gl.GetIntegerv(gl.MAX_TEXTURE_IMAGE_UNITS, &fragmentUnits)
+	gl.GetIntegerv(gl.MAX_COMBINED_TEXTURE_IMAGE_UNITS, &combinedUnits)
+	if int(fragmentUnits) < litSamplers {
+		return fmt.Errorf("OpenGL allows %d samplers in a fragment shader, the lit shaders need %d", fragmentUnits, litSamplers)
+	}
+
+	MaxPointShadows = int(fragmentUnits) - litSamplers
+	if MaxPointShadows > int(combinedUnits)-pointShadowUnits {
+		MaxPointShadows = int(combinedUnits) - pointShadowUnits
+	}
+	shader.MaxPointShadows = MaxPointShadows
+	return nil
+}
+
+// bindSamplerUnits - points the samplers a program uses at their units. An array's elements take the units from its
+// first on
+func bindSamplerUnits(program uint32) {
+	point := func(name string, unit, count int) {
+		location := gl.GetUniformLocation(program, gl.Str(name+"\x00"))
+		if location == -1 {
+			return
+		}
+		units := make([]int32, count)
+		for i := range units {
+			units[i] = int32(unit + i)
+		}
+		gl.ProgramUniform1iv(program, location, int32(count), &units[0])
+	}
+
+	point("uDiffuseTexture", baseColorUnit, 1)
+	point("uNormalTexture", normalMapUnit, 1)
+	point("uMetallicRoughnessTexture", metallicRoughnessUnit, 1)
+	point("uOcclusionTexture", occlusionMapUnit, 1)
+	point("uEmissiveTexture", emissiveMapUnit, 1)
+	point("skybox", skyboxUnit, 1)
+	point("probeMap", probeUnit, 1)
+	point("mirrorMap", mirrorUnit, 1)
+	point("dirShadowMaps", dirShadowUnits, MaxDirectionalLights)
+	point("pointShadowMaps", pointShadowUnits, MaxPointShadows)
+	//the point light pass reads one light's shadow map at a time
+	point("shadowMap", pointShadowUnits, 1)
+	for i, name := range gBufferSamplers {
+		point(name, gBufferUnits+i, 1)
+	}
+	for i, name := range clusterSamplers {
+		point(name, clusterUnits+i, 1)
+	}
+	point("ssaoTexture", ssaoUnit, 1)
+	for i, name := range environmentSamplers {
+		point(name, environmentUnits+i, 1)
+	}
+}
+
+// bindUnit - binds a texture to a unit. The unit is left active, so only units bound for each draw may be passed,
+// drawing code unbinds the textures of the active unit
+func bindUnit(unit int, target, texture uint32) {
+	gl.ActiveTexture(gl.TEXTURE0 + uint32(unit))
+	gl.BindTexture(target, texture)
+}
+
+// bindFrameUnit - binds a texture to one of the units bound once a frame, leaving unit 0 active
+func bindFrameUnit(unit int, target, texture uint32) {
+	bindUnit(unit, target, texture)
+	//drawing unbinds textures on the active unit, which mustn't be this one
+	gl.ActiveTexture(gl.TEXTURE0)
+}
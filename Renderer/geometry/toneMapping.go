@@ -0,0 +1,63 @@
+package geometry
+
+const (
+	// DefaultToneMapOperator - operator of a scene that doesn't set toneMapping.operator
+	DefaultToneMapOperator = "aces"
+	// DefaultToneMapOutput - output encoding of a scene that doesn't set toneMapping.output
+	DefaultToneMapOutput = "srgb"
+	// DefaultKeyValue - average brightness auto exposure aims for, middle grey
+	DefaultKeyValue = 0.18
+	// DefaultAdaptationSpeed - how quickly auto exposure follows the scene, higher is faster
+	DefaultAdaptationSpeed = 1.5
+	// DefaultGamma - display gamma of the gamma output
+	DefaultGamma = 2.2
+)
+
+// toneMapOperators - operator names in the scene file and the matching TONEMAP_ define in shader/toneMapping.go
+var toneMapOperators = map[string]int32{
+	"none":     0,
+	"reinhard": 1,
+	"aces":     2,
+	"filmic":   3,
+}
+
+// toneMapOutputs - output names in the scene file and the matching OUTPUT_ define in shader/toneMapping.go
+var toneMapOutputs = map[string]int32{
+	"linear": 0,
+	"srgb":   1,
+	"gamma":  2,
+}
+
+// ToneMapping - how the HDR frame is brought into display range. Exposure scales the scene before the operator and,
+// with AutoExposure, multiplies the exposure that brings the average luminance to KeyValue
+type ToneMapping struct {
+	Operator        string  `json:"operator"`
+	Exposure        float32 `json:"exposure"`
+	AutoExposure    bool    `json:"autoExposure"`
+	KeyValue        float32 `json:"keyValue"`
+	AdaptationSpeed float32 `json:"adaptationSpeed"`
+	Output          string  `json:"output"`
+	Gamma           float32 `json:"gamma"`
+}
+
+// setDefaults - fills in the values the scene file left out
+func (t *ToneMapping) setDefaults() {
+	if _, found := toneMapOperators[t.Operator]; !found {
+		t.Operator = DefaultToneMapOperator
+	}
+	if t.Exposure <= 0 {
+		t.Exposure = 1
+	}
+	if t.KeyValue <= 0 {
+		t.KeyValue = DefaultKeyValue
+	}
+	if t.AdaptationSpeed <= 0 {
+		t.AdaptationSpeed = DefaultAdaptationSpeed
+	}
+	if _, found := toneMapOutputs[t.Output]; !found {
+		t.Output = DefaultToneMapOutput
+	}
+	if t.Gamma <= 0 {
+		t.Gamma = DefaultGamma
+	}
+}
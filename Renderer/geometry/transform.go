@@ -0,0 +1,63 @@
+package geometry
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Transform - placement of an object: Scale is applied first, the object is then turned by Rotation about its
+// Pivot and finally moved by Position. This is the order the Editor draws objects in
+type Transform struct {
+	Position mgl32.Vec3
+	Rotation mgl32.Quat
+	Scale    mgl32.Vec3
+	Pivot    mgl32.Vec3
+}
+
+// NewTransform - identity transform, no rotation and a scale of 1
+func NewTransform() Transform {
+	return Transform{
+		Rotation: mgl32.QuatIdent(),
+		Scale:    mgl32.Vec3{1, 1, 1},
+	}
+}
+
+// ObjectTransform - transform of an object built from its model, pivoting about the object's centroid
+func ObjectTransform(object Geometry) Transform {
+	transform := NewTransform()
+	currentModel, err := object.GetModel()
+	if err != nil {
+		return transform
+	}
+
+	transform.Position = currentModel.Position
+	transform.Rotation = mgl32.Mat4ToQuat(currentModel.Rotation)
+	transform.Scale = currentModel.Scale
+	transform.Pivot = object.GetCentroid()
+	return transform
+}
+
+// Matrix - model matrix, Position * Pivot * Rotation * -Pivot * Scale
+func (t Transform) Matrix() mgl32.Mat4 {
+	rotation := t.Rotation
+	if rotation.Len() == 0 {
+		rotation = mgl32.QuatIdent()
+	}
+	pivot := t.Pivot
+
+	modelMatrix := mgl32.Translate3D(t.Position[0], t.Position[1], t.Position[2])
+	modelMatrix = modelMatrix.Mul4(mgl32.Translate3D(pivot[0], pivot[1], pivot[2]))
+	modelMatrix = modelMatrix.Mul4(rotation.Normalize().Mat4())
+	modelMatrix = modelMatrix.Mul4(mgl32.Translate3D(-pivot[0], -pivot[1], -pivot[2]))
+	return modelMatrix.Mul4(mgl32.Scale3D(t.Scale[0], t.Scale[1], t.Scale[2]))
+}
+
+// NormalMatrix - matrix that takes object space normals to world space for this transform
+func (t Transform) NormalMatrix() mgl32.Mat3 {
+	return NormalMatrix(t.Matrix())
+}
+
+// NormalMatrix - inverse transpose of the upper 3x3 of a model matrix, keeps normals perpendicular to surfaces
+// under non uniform scale. A matrix that flattens the object gives a zero matrix
+func NormalMatrix(modelMatrix mgl32.Mat4) mgl32.Mat3 {
+	return modelMatrix.Mat3().Inv().Transpose()
+}
@@ -0,0 +1,176 @@
+package geometry
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const matrixTolerance = 1e-5
+
+// approxEqual - whether a and b differ by no more than matrixTolerance in any element. mgl32's ApproxEqual compares
+// relative to the size of the elements, which fails on the zeros these matrices are full of
+func approxEqual(a, b []float32) bool {
+	for i := range a {
+		if math.Abs(float64(a[i]-b[i])) > matrixTolerance {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// quarterTurnZ - 90 degrees about +z, taking +x to +y and +y to -x
+var quarterTurnZ = mgl32.QuatRotate(mgl32.DegToRad(90), mgl32.Vec3{0, 0, 1})
+
+// the expected matrices are written column by column, the way mgl32 stores them
+func TestTransformMatrix(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		want      mgl32.Mat4
+	}{
+		{
+			name:      "identity",
+			transform: NewTransform(),
+			want:      mgl32.Ident4(),
+		},
+		{
+			name:      "zero rotation is no rotation",
+			transform: Transform{Scale: mgl32.Vec3{1, 1, 1}},
+			want:      mgl32.Ident4(),
+		},
+		{
+			name:      "translation",
+			transform: Transform{Position: mgl32.Vec3{1, 2, 3}, Rotation: mgl32.QuatIdent(), Scale: mgl32.Vec3{1, 1, 1}},
+			want: mgl32.Mat4{
+				1, 0, 0, 0,
+				0, 1, 0, 0,
+				0, 0, 1, 0,
+				1, 2, 3, 1,
+			},
+		},
+		{
+			//the pivot stays where it is, then everything moves up by Position
+			name:      "rotation about a pivot",
+			transform: Transform{Position: mgl32.Vec3{0, 0, 2}, Rotation: quarterTurnZ, Scale: mgl32.Vec3{1, 1, 1}, Pivot: mgl32.Vec3{1, 0, 0}},
+			want: mgl32.Mat4{
+				0, 1, 0, 0,
+				-1, 0, 0, 0,
+				0, 0, 1, 0,
+				1, -1, 2, 1,
+			},
+		},
+		{
+			//scaled along the object's own axes before turning, so x's scale ends up along y
+			name:      "non uniform scale with rotation",
+			transform: Transform{Position: mgl32.Vec3{5, 0, 0}, Rotation: quarterTurnZ, Scale: mgl32.Vec3{2, 3, 4}},
+			want: mgl32.Mat4{
+				0, 2, 0, 0,
+				-3, 0, 0, 0,
+				0, 0, 4, 0,
+				5, 0, 0, 1,
+			},
+		},
+		{
+			//the pivot is in scaled space and is not scaled itself
+			name:      "scale, rotation, pivot and translation",
+			transform: Transform{Position: mgl32.Vec3{1, 1, 1}, Rotation: quarterTurnZ, Scale: mgl32.Vec3{2, 1, 1}, Pivot: mgl32.Vec3{0, 1, 0}},
+			want: mgl32.Mat4{
+				0, 2, 0, 0,
+				-1, 0, 0, 0,
+				0, 0, 1, 0,
+				2, 2, 1, 1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.transform.Matrix()
+			if !approxEqual(got[:], test.want[:]) {
+				t.Errorf("Matrix() =\n%v\nwant\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalMatrix(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		want      mgl32.Mat3
+	}{
+		{
+			name:      "identity",
+			transform: NewTransform(),
+			want:      mgl32.Ident3(),
+		},
+		{
+			name:      "translation is ignored",
+			transform: Transform{Position: mgl32.Vec3{1, 2, 3}, Rotation: mgl32.QuatIdent(), Scale: mgl32.Vec3{1, 1, 1}},
+			want:      mgl32.Ident3(),
+		},
+		{
+			//a rotation is its own inverse transpose
+			name:      "rotation about a pivot",
+			transform: Transform{Position: mgl32.Vec3{0, 0, 2}, Rotation: quarterTurnZ, Scale: mgl32.Vec3{1, 1, 1}, Pivot: mgl32.Vec3{1, 0, 0}},
+			want: mgl32.Mat3{
+				0, 1, 0,
+				-1, 0, 0,
+				0, 0, 1,
+			},
+		},
+		{
+			name:      "non uniform scale",
+			transform: Transform{Rotation: mgl32.QuatIdent(), Scale: mgl32.Vec3{2, 4, 1}},
+			want: mgl32.Mat3{
+				0.5, 0, 0,
+				0, 0.25, 0,
+				0, 0, 1,
+			},
+		},
+		{
+			//(R*S)^-T = R*S^-1
+			name:      "non uniform scale with rotation",
+			transform: Transform{Position: mgl32.Vec3{5, 0, 0}, Rotation: quarterTurnZ, Scale: mgl32.Vec3{2, 3, 4}},
+			want: mgl32.Mat3{
+				0, 0.5, 0,
+				-1.0 / 3, 0, 0,
+				0, 0, 0.25,
+			},
+		},
+		{
+			name:      "flattened",
+			transform: Transform{Rotation: mgl32.QuatIdent(), Scale: mgl32.Vec3{1, 0, 1}},
+			want:      mgl32.Mat3{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.transform.NormalMatrix()
+			if !approxEqual(got[:], test.want[:]) {
+				t.Errorf("NormalMatrix() =\n%v\nwant\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+// a normal taken through NormalMatrix stays perpendicular to its surface taken through Matrix
+func TestNormalMatrixKeepsNormalsPerpendicular(t *testing.T) {
+	transform := Transform{
+		Position: mgl32.Vec3{3, -1, 2},
+		Rotation: mgl32.QuatRotate(0.7, mgl32.Vec3{1, 2, 3}.Normalize()),
+		Scale:    mgl32.Vec3{0.5, 3, 2},
+		Pivot:    mgl32.Vec3{1, 1, 0},
+	}
+	tangent := mgl32.Vec3{1, -1, 0}
+	normal := mgl32.Vec3{1, 1, 1}
+
+	worldTangent := transform.Matrix().Mul4x1(tangent.Vec4(0)).Vec3()
+	worldNormal := transform.NormalMatrix().Mul3x1(normal)
+	if dot := worldTangent.Dot(worldNormal); math.Abs(float64(dot)) > matrixTolerance {
+		t.Errorf("transformed tangent . normal = %v, want 0", dot)
+	}
+}
@@ -0,0 +1,165 @@
+package geometry
+
+import (
+	"fmt"
+
+	"../shader"
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// TransparencyPass - draws the transparent objects after the opaque ones with weighted blended order independent
+// transparency, so overlapping glass and water look the same whatever order they are drawn in. The objects are
+// depth tested against the opaque frame without writing depth, their weighted colours are added into an
+// accumulation target and their coverage multiplied into a revealage target, and Composite puts the average over the
+// frame. Only the lit shader types write the weighted outputs, see Transparent
+type TransparencyPass struct {
+	width     int32
+	height    int32
+	fbo       uint32
+	accum     uint32 //RGBA16F, sum of the weighted premultiplied colours and of the weights
+	revealage uint32 //R16F, product of 1 - alpha, how much of the frame still shows through
+	depthRB   uint32
+	target    uint32 //framebuffer the frame is in, remembered by Begin
+
+	composite postProgram
+	vao       uint32 //empty, for the fullscreen triangle
+}
+
+// NewTransparencyPass - the program and targets are made by Begin, the first time a frame has transparent objects
+func NewTransparencyPass() *TransparencyPass {
+	return &TransparencyPass{}
+}
+
+// Transparent - whether an object is drawn by the transparency pass. Objects of the other shader types are drawn
+// as if they were opaque
+func Transparent(object Geometry) bool {
+	mat := object.GetMaterial()
+	return mat.Alpha < 1.0 && litShaderType(mat.ShaderType)
+}
+
+// Begin - copies the depth of the frame bound for drawing, which must be the size given, and binds and clears the
+// transparency targets for the transparent objects to be drawn into, remaking them first if the frame size changed
+func (t *TransparencyPass) Begin(width, height int32) error {
+	var target int32
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &target)
+	t.target = uint32(target)
+
+	if t.composite.program == 0 {
+		t.composite = newPostProgram(&shader.TransparencyCompositeShader{})
+		gl.GenVertexArrays(1, &t.vao)
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if t.fbo == 0 || width != t.width || height != t.height {
+		if err := t.createTargets(width, height); err != nil {
+			return err
+		}
+	}
+
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, t.target)
+	gl.BindFramebuffer(gl.DRAW_FRAMEBUFFER, t.fbo)
+	gl.BlitFramebuffer(0, 0, width, height, 0, 0, width, height, gl.DEPTH_BUFFER_BIT, gl.NEAREST)
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	gl.Viewport(0, 0, width, height)
+	zero := []float32{0, 0, 0, 0}
+	one := []float32{1, 1, 1, 1}
+	gl.ClearBufferfv(gl.COLOR, 0, &zero[0])
+	gl.ClearBufferfv(gl.COLOR, 1, &one[0])
+
+	gl.Enable(gl.CULL_FACE)
+	gl.Enable(gl.DEPTH_TEST)
+	gl.DepthFunc(gl.LEQUAL)
+	gl.DepthMask(false)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunci(0, gl.ONE, gl.ONE)
+	gl.BlendFunci(1, gl.ZERO, gl.ONE_MINUS_SRC_COLOR)
+	return nil
+}
+
+// createTargets - makes the accumulation and revealage textures and the depth buffer they share
+func (t *TransparencyPass) createTargets(width, height int32) error {
+	t.deleteTargets()
+	t.width = width
+	t.height = height
+
+	gl.GenFramebuffers(1, &t.fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fbo)
+	t.accum = newColorTexture(gl.RGBA16F, gl.RGBA, width, height, gl.NEAREST)
+	t.revealage = newColorTexture(gl.R16F, gl.RED, width, height, gl.NEAREST)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.accum, 0)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT1, gl.TEXTURE_2D, t.revealage, 0)
+	drawBuffers := []uint32{gl.COLOR_ATTACHMENT0, gl.COLOR_ATTACHMENT1}
+	gl.DrawBuffers(int32(len(drawBuffers)), &drawBuffers[0])
+
+	//the same format as the HDR target's depth so the opaque depth can be copied in
+	gl.GenRenderbuffers(1, &t.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, t.depthRB)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT24, width, height)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, t.depthRB)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		return fmt.Errorf("transparency framebuffer incomplete: 0x%x", status)
+	}
+	return nil
+}
+
+// Composite - blends the transparent objects drawn since Begin over the frame and binds it for drawing again
+func (t *TransparencyPass) Composite() {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.target)
+	gl.Viewport(0, 0, t.width, t.height)
+	gl.UseProgram(t.composite.program)
+	t.composite.bindTexture("accumTexture", 0, gl.TEXTURE_2D, t.accum)
+	t.composite.bindTexture("revealageTexture", 1, gl.TEXTURE_2D, t.revealage)
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.BindVertexArray(t.vao)
+	gl.DrawArrays(gl.TRIANGLES, 0, 3)
+
+	gl.Enable(gl.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+	gl.BindVertexArray(0)
+	for unit := uint32(0); unit < 2; unit++ {
+		gl.ActiveTexture(gl.TEXTURE0 + unit)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}
+}
+
+// deleteTargets - frees the transparency targets
+func (t *TransparencyPass) deleteTargets() {
+	if t.accum != 0 {
+		textures := []uint32{t.accum, t.revealage}
+		gl.DeleteTextures(int32(len(textures)), &textures[0])
+		t.accum, t.revealage = 0, 0
+	}
+	if t.depthRB != 0 {
+		gl.DeleteRenderbuffers(1, &t.depthRB)
+		t.depthRB = 0
+	}
+	if t.fbo != 0 {
+		gl.DeleteFramebuffers(1, &t.fbo)
+		t.fbo = 0
+	}
+}
+
+// Delete - frees the targets, the program and the vertex array
+func (t *TransparencyPass) Delete() {
+	t.deleteTargets()
+	if t.composite.program != 0 {
+		gl.DeleteProgram(t.composite.program)
+		t.composite.program = 0
+	}
+	if t.vao != 0 {
+		gl.DeleteVertexArrays(1, &t.vao)
+		t.vao = 0
+	}
+}
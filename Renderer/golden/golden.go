@@ -0,0 +1,114 @@
+// Package golden compares rendered frames against stored reference images.
+package golden
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Result - outcome of comparing a render against its reference image
+type Result struct {
+	Mismatched int   //number of pixels with a channel outside the tolerance
+	Total      int   //number of pixels compared
+	MaxDiff    uint8 //largest single channel difference found
+	Diff       *image.RGBA
+}
+
+// Passed - true when the fraction of mismatched pixels is at most maxBadRatio
+func (r Result) Passed(maxBadRatio float64) bool {
+	if r.Total == 0 {
+		return false
+	}
+	return float64(r.Mismatched)/float64(r.Total) <= maxBadRatio
+}
+
+// Compare - compares two images channel by channel, any channel differing by more than
+// tolerance marks the pixel as mismatched. The diff image shows matching pixels as a faded
+// grayscale copy of the reference and mismatched pixels in red, scaled by how far off they are.
+func Compare(got, want image.Image, tolerance uint8) (Result, error) {
+	if got.Bounds().Size() != want.Bounds().Size() {
+		return Result{}, fmt.Errorf("size mismatch: got %v, reference is %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+
+	size := want.Bounds().Size()
+	result := Result{
+		Total: size.X * size.Y,
+		Diff:  image.NewRGBA(image.Rect(0, 0, size.X, size.Y)),
+	}
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			a := color.RGBAModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y)).(color.RGBA)
+			b := color.RGBAModel.Convert(want.At(want.Bounds().Min.X+x, want.Bounds().Min.Y+y)).(color.RGBA)
+
+			diff := maxChannelDiff(a, b)
+			if diff > result.MaxDiff {
+				result.MaxDiff = diff
+			}
+
+			if diff > tolerance {
+				result.Mismatched++
+				result.Diff.SetRGBA(x, y, color.RGBA{R: 128 + diff/2, A: 255})
+			} else {
+				gray := uint8((uint16(b.R) + uint16(b.G) + uint16(b.B)) / 3 / 4)
+				result.Diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func maxChannelDiff(a, b color.RGBA) uint8 {
+	max := absDiff(a.R, b.R)
+	if d := absDiff(a.G, b.G); d > max {
+		max = d
+	}
+	if d := absDiff(a.B, b.B); d > max {
+		max = d
+	}
+	if d := absDiff(a.A, b.A); d > max {
+		max = d
+	}
+	return max
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// LoadPNG - reads a PNG image from disk
+func LoadPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return png.Decode(file)
+}
+
+// SavePNG - writes an image to disk as a PNG, creating the parent directory if needed
+func SavePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
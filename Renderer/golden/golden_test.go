@@ -0,0 +1,105 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// solid - a w by h image filled with c
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+var purple = color.RGBA{R: 120, G: 60, B: 180, A: 255}
+
+func TestCompareWithinTolerance(t *testing.T) {
+	want := solid(2, 2, purple)
+	got := solid(2, 2, purple)
+	got.SetRGBA(1, 0, color.RGBA{R: 122, G: 58, B: 180, A: 255})
+
+	result, err := Compare(got, want, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatched != 0 || result.Total != 4 || result.MaxDiff != 2 {
+		t.Errorf("got %d of %d mismatched, max diff %d, want 0 of 4, max diff 2", result.Mismatched, result.Total, result.MaxDiff)
+	}
+	if !result.Passed(0) {
+		t.Error("Passed(0) = false, want true")
+	}
+}
+
+func TestCompareOneChannelPastTolerance(t *testing.T) {
+	want := solid(2, 2, purple)
+	got := solid(2, 2, purple)
+	got.SetRGBA(0, 1, color.RGBA{R: 120, G: 60, B: 183, A: 255})
+
+	result, err := Compare(got, want, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatched != 1 || result.Total != 4 || result.MaxDiff != 3 {
+		t.Errorf("got %d of %d mismatched, max diff %d, want 1 of 4, max diff 3", result.Mismatched, result.Total, result.MaxDiff)
+	}
+	if result.Passed(0) {
+		t.Error("Passed(0) = true, want false")
+	}
+	if !result.Passed(0.25) {
+		t.Error("Passed(0.25) = false, want true")
+	}
+}
+
+func TestCompareSizeMismatch(t *testing.T) {
+	result, err := Compare(solid(2, 2, purple), solid(2, 3, purple), 2)
+	if err == nil {
+		t.Fatal("Compare of a 2x2 and a 2x3 image gave no error")
+	}
+	if result.Diff != nil || result.Passed(1) {
+		t.Error("a size mismatch gave a result that can pass")
+	}
+}
+
+func TestCompareDiffImage(t *testing.T) {
+	want := solid(2, 1, purple)
+	got := solid(2, 1, purple)
+	got.SetRGBA(1, 0, color.RGBA{R: 20, G: 60, B: 180, A: 255})
+
+	result, err := Compare(got, want, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := result.Diff.Bounds().Size(); size != (image.Point{2, 1}) {
+		t.Fatalf("diff image is %v, want 2x1", size)
+	}
+
+	//matching pixels are the reference's average brightness, faded to a quarter
+	if c, want := result.Diff.RGBAAt(0, 0), (color.RGBA{R: 30, G: 30, B: 30, A: 255}); c != want {
+		t.Errorf("matching pixel = %v, want %v", c, want)
+	}
+	//mismatched ones are red, brighter the further off they are
+	if c, want := result.Diff.RGBAAt(1, 0), (color.RGBA{R: 128 + 100/2, A: 255}); c != want {
+		t.Errorf("mismatched pixel = %v, want %v", c, want)
+	}
+}
+
+func TestCompareOffsetBounds(t *testing.T) {
+	want := solid(4, 4, purple)
+	got := solid(4, 4, purple)
+	got.SetRGBA(3, 3, color.RGBA{A: 255})
+
+	//the same 2x2 corner of each image, so not at the origin
+	result, err := Compare(got.SubImage(image.Rect(2, 2, 4, 4)), want.SubImage(image.Rect(2, 2, 4, 4)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatched != 1 || result.Diff.RGBAAt(1, 1).R != 128+180/2 {
+		t.Errorf("got %d mismatched with diff pixel %v, want 1 at (1, 1)", result.Mismatched, result.Diff.RGBAAt(1, 1))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+
+	"./game"
+	"./geometry"
+	"./globals"
+	"./headless"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// headlessDeltaTime - fixed frame time used offscreen so renders are repeatable
+const headlessDeltaTime = 1.0 / 60.0
+
+// runHeadless - loads a scene without a window, renders it into an offscreen framebuffer and writes the result as a PNG
+func runHeadless(statePath, outPath string, frames int, opts geometry.LoadOptions) error {
+	ctx, err := headless.NewContext(globals.Width, globals.Height)
+	if err != nil {
+		return err
+	}
+	defer ctx.Destroy()
+
+	if err := gl.Init(); err != nil {
+		return err
+	}
+	if err := geometry.SetupTextureUnits(); err != nil {
+		return err
+	}
+
+	//no multisampling, the render target isn't multisampled either
+	hdr, err := geometry.NewHDRPipeline(0)
+	if err != nil {
+		return err
+	}
+	defer hdr.Delete()
+	deferred := geometry.NewDeferredRenderer()
+	defer deferred.Delete()
+	transparency := geometry.NewTransparencyPass()
+	defer transparency.Delete()
+	ssao := geometry.NewSSAOPass()
+	defer ssao.Delete()
+	mirrors := geometry.NewMirrorPass()
+	defer mirrors.Delete()
+
+	state := newState()
+	target, err := renderOffscreen(statePath, &state, hdr, deferred, transparency, ssao, mirrors, frames, opts)
+	if err != nil {
+		return err
+	}
+	defer target.Delete()
+
+	return writePNG(outPath, target)
+}
+
+// renderOffscreen - loads a scene file and runs the full draw pipeline for a number of frames into a new render target.
+// The HDR pipeline is reset first so the render doesn't depend on earlier ones
+func renderOffscreen(statePath string, state *geometry.State, hdr *geometry.HDRPipeline, deferred *geometry.DeferredRenderer, transparency *geometry.TransparencyPass, ssao *geometry.SSAOPass, mirrors *geometry.MirrorPass, frames int, opts geometry.LoadOptions) (*geometry.RenderTarget, error) {
+	if frames < 1 {
+		return nil, fmt.Errorf("frame count must be at least 1, got %d", frames)
+	}
+
+	target, err := geometry.NewRenderTarget(int32(globals.Width), int32(globals.Height))
+	if err != nil {
+		return nil, err
+	}
+	state.FrameBuffer = target.FBO
+
+	if err := geometry.ParseJSONFile(statePath, state, opts); err != nil {
+		target.Delete()
+		return nil, err
+	}
+
+	pointLightShadowProgramInfo, dirLightShadowProgramInfo := setupShadowPrograms()
+	hdr.Reset()
+	if err := setupScene(state, opts); err != nil {
+		target.Delete()
+		return nil, err
+	}
+
+	for i := 0; i < frames; i++ {
+		game.Update(state, headlessDeltaTime)
+		draw(state, hdr, deferred, transparency, ssao, mirrors, headlessDeltaTime, &pointLightShadowProgramInfo, &dirLightShadowProgramInfo)
+
+		if index, ok := state.TakeSceneRequest(); ok {
+			if err := switchScene(state, index, opts); err != nil {
+				target.Delete()
+				return nil, err
+			}
+		}
+	}
+	gl.Finish()
+
+	return target, nil
+}
+
+func writePNG(outPath string, target *geometry.RenderTarget) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, target.ReadPixels())
+}
@@ -0,0 +1,98 @@
+//go:build egl
+// +build egl
+
+package headless
+
+/*
+#cgo linux LDFLAGS: -lEGL
+#include <stdlib.h>
+#include <EGL/egl.h>
+#include <EGL/eglext.h>
+
+// surfacelessDisplay prefers Mesa's surfaceless platform so no window system is needed
+static EGLDisplay surfacelessDisplay() {
+	PFNEGLGETPLATFORMDISPLAYEXTPROC getPlatformDisplay =
+		(PFNEGLGETPLATFORMDISPLAYEXTPROC) eglGetProcAddress("eglGetPlatformDisplayEXT");
+	if (getPlatformDisplay != NULL) {
+		EGLDisplay display = getPlatformDisplay(EGL_PLATFORM_SURFACELESS_MESA, EGL_DEFAULT_DISPLAY, NULL);
+		if (display != EGL_NO_DISPLAY) {
+			return display;
+		}
+	}
+	return eglGetDisplay(EGL_DEFAULT_DISPLAY);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+)
+
+type eglContext struct {
+	display C.EGLDisplay
+	context C.EGLContext
+}
+
+// NewContext - creates a surfaceless EGL context and makes it current
+func NewContext(width, height int) (Context, error) {
+	display := C.surfacelessDisplay()
+	if display == C.EGLDisplay(C.EGL_NO_DISPLAY) {
+		return nil, fmt.Errorf("egl: no display available")
+	}
+
+	var major, minor C.EGLint
+	if C.eglInitialize(display, &major, &minor) == C.EGL_FALSE {
+		return nil, fmt.Errorf("egl: initialize failed: 0x%x", int(C.eglGetError()))
+	}
+
+	configAttribs := []C.EGLint{
+		C.EGL_SURFACE_TYPE, C.EGL_PBUFFER_BIT,
+		C.EGL_RENDERABLE_TYPE, C.EGL_OPENGL_BIT,
+		C.EGL_RED_SIZE, 8,
+		C.EGL_GREEN_SIZE, 8,
+		C.EGL_BLUE_SIZE, 8,
+		C.EGL_ALPHA_SIZE, 8,
+		C.EGL_DEPTH_SIZE, 24,
+		C.EGL_NONE,
+	}
+
+	var config C.EGLConfig
+	var numConfigs C.EGLint
+	if C.eglChooseConfig(display, &configAttribs[0], &config, 1, &numConfigs) == C.EGL_FALSE || numConfigs == 0 {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("egl: no config supporting desktop OpenGL")
+	}
+
+	if C.eglBindAPI(C.EGL_OPENGL_API) == C.EGL_FALSE {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("egl: cannot bind the OpenGL API")
+	}
+
+	contextAttribs := []C.EGLint{
+		C.EGL_CONTEXT_MAJOR_VERSION, 4,
+		C.EGL_CONTEXT_MINOR_VERSION, 1,
+		C.EGL_CONTEXT_OPENGL_PROFILE_MASK, C.EGL_CONTEXT_OPENGL_CORE_PROFILE_BIT,
+		C.EGL_NONE,
+	}
+
+	context := C.eglCreateContext(display, config, C.EGLContext(C.EGL_NO_CONTEXT), &contextAttribs[0])
+	if context == C.EGLContext(C.EGL_NO_CONTEXT) {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("egl: cannot create a 4.1 core context: 0x%x", int(C.eglGetError()))
+	}
+
+	//no surface is needed, everything is drawn into framebuffer objects
+	if C.eglMakeCurrent(display, C.EGLSurface(C.EGL_NO_SURFACE), C.EGLSurface(C.EGL_NO_SURFACE), context) == C.EGL_FALSE {
+		C.eglDestroyContext(display, context)
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("egl: make current failed: 0x%x", int(C.eglGetError()))
+	}
+
+	return &eglContext{display: display, context: context}, nil
+}
+
+func (c *eglContext) Destroy() {
+	C.eglMakeCurrent(c.display, C.EGLSurface(C.EGL_NO_SURFACE), C.EGLSurface(C.EGL_NO_SURFACE), C.EGLContext(C.EGL_NO_CONTEXT))
+	C.eglDestroyContext(c.display, c.context)
+	C.eglTerminate(c.display)
+}
@@ -0,0 +1,38 @@
+//go:build !egl
+// +build !egl
+
+package headless
+
+import (
+	"github.com/go-gl/glfw/v3.1/glfw"
+)
+
+type glfwContext struct {
+	window *glfw.Window
+}
+
+// NewContext - creates an invisible GLFW window and makes its context current
+func NewContext(width, height int) (Context, error) {
+	if err := glfw.Init(); err != nil {
+		return nil, err
+	}
+	glfw.WindowHint(glfw.Visible, glfw.False)
+	glfw.WindowHint(glfw.ContextVersionMajor, 4)
+	glfw.WindowHint(glfw.ContextVersionMinor, 1)
+	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
+	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
+
+	window, err := glfw.CreateWindow(width, height, "Go GL", nil, nil)
+	if err != nil {
+		glfw.Terminate()
+		return nil, err
+	}
+	window.MakeContextCurrent()
+
+	return &glfwContext{window: window}, nil
+}
+
+func (c *glfwContext) Destroy() {
+	c.window.Destroy()
+	glfw.Terminate()
+}
@@ -0,0 +1,14 @@
+// Package headless creates OpenGL contexts that are not tied to a visible window,
+// so scenes can be rendered on machines without a display.
+//
+// Building with the "egl" tag creates a surfaceless EGL context (Mesa llvmpipe works
+// without a GPU or X server, set LIBGL_ALWAYS_SOFTWARE=1 to force it). The "egl" tag
+// also makes the go-gl bindings resolve functions through eglGetProcAddress.
+// Without the tag an invisible GLFW window is used instead, which needs an X server
+// such as Xvfb.
+package headless
+
+// Context - an OpenGL 4.1 core context made current on the calling thread
+type Context interface {
+	Destroy()
+}
@@ -1,14 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
-	"sort"
-	"strconv"
-	"strings"
 	"syscall"
 
 	"./game"
@@ -39,7 +38,81 @@ func main() {
 	}()
 
 	//get arguments
-	argsWithoutProgram := os.Args[1:]
+	headlessMode := flag.Bool("headless", false, "render offscreen and write the final frame to a PNG instead of opening a window")
+	frames := flag.Int("frames", 1, "number of frames to render in headless mode")
+	outPath := flag.String("out", "render.png", "output PNG path for headless mode")
+	width := flag.Int("width", globals.Width, "render width")
+	height := flag.Int("height", globals.Height, "render height")
+	goldenMode := flag.Bool("golden", false, "render each scene file offscreen and compare it against its reference PNG")
+	refDir := flag.String("ref", "golden/reference", "reference PNG directory for golden mode")
+	diffDir := flag.String("diffs", "golden/output", "directory golden mode writes actual and diff images of failing scenes to")
+	tolerance := flag.Int("tolerance", 2, "largest per channel difference a pixel may have in golden mode")
+	maxBad := flag.Float64("maxbad", 0, "fraction of pixels allowed outside the tolerance in golden mode")
+	update := flag.Bool("update", false, "overwrite the reference PNGs with the current renders in golden mode")
+	validate := flag.Bool("validate", false, "check scene files against the current schema and print every problem without rendering")
+	sceneName := flag.String("scene", "", "name of the scene in the statefile to start in, the first scene if empty")
+	onError := flag.String("onerror", "placeholder", "what to do with objects that fail to load: abort, skip or placeholder")
+	flag.Parse()
+
+	policy, err := geometry.ParseLoadPolicy(*onError)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	loadOpts := geometry.LoadOptions{Policy: policy, Scene: *sceneName}
+
+	globals.Width = *width
+	globals.Height = *height
+
+	if *validate {
+		scenes := flag.Args()
+		if len(scenes) == 0 {
+			scenes, _ = filepath.Glob("../Editor/statefiles/*.json")
+		}
+		if runValidate(scenes) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *goldenMode {
+		scenes := flag.Args()
+		if len(scenes) == 0 {
+			scenes, _ = filepath.Glob("golden/scenes/*.json")
+		}
+		failures, err := runGolden(scenes, goldenOptions{
+			ReferenceDir: *refDir,
+			OutputDir:    *diffDir,
+			Frames:       *frames,
+			Tolerance:    uint8(*tolerance),
+			MaxBadRatio:  *maxBad,
+			Update:       *update,
+			Load:         loadOpts,
+		})
+		if err != nil {
+			fmt.Println("Golden run failed: ", err)
+			os.Exit(1)
+		}
+		if failures > 0 {
+			fmt.Printf("%d of %d scenes failed\n", failures, len(scenes))
+			os.Exit(1)
+		}
+		return
+	}
+
+	statePath := "../Editor/statefiles/testsave.json"
+	if flag.NArg() > 0 {
+		statePath = flag.Arg(0)
+	}
+
+	if *headlessMode {
+		if err := runHeadless(statePath, *outPath, *frames, loadOpts); err != nil {
+			fmt.Println("Headless render failed: ", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote ", *outPath)
+		return
+	}
 
 	objectsToRender = make(chan geometry.RenderObject, 10)
 	keys = make(map[glfw.Key]bool)
@@ -47,7 +120,108 @@ func main() {
 	mouseMovement = make(map[string]float64)
 	mouseMovement["sensitivity"] = 8
 
-	state := geometry.State{
+	state := newState()
+
+	window := initGlfw()
+	defer glfw.Terminate()
+
+	window.SetKeyCallback(KeyHandler)
+	window.SetMouseButtonCallback(MouseButtonHandler)
+	window.SetCursorPosCallback(MouseMoveHandler)
+
+	if err := gl.Init(); err != nil {
+		fmt.Println("Failed to initialise OpenGL: ", err)
+		os.Exit(1)
+	}
+	if err := geometry.SetupTextureUnits(); err != nil {
+		fmt.Println("Failed to set up texture units: ", err)
+		os.Exit(1)
+	}
+
+	if err := geometry.ParseJSONFile(statePath, &state, loadOpts); err != nil {
+		fmt.Println("Failed to load scene: ", err)
+		os.Exit(1)
+	}
+
+	then := 0.0
+
+	fmt.Println("PID: ", os.Getpid())
+	pointLightShadowProgramInfo, dirLightShadowProgramInfo := setupShadowPrograms()
+	hdr, err := geometry.NewHDRPipeline(geometry.WindowSamples)
+	if err != nil {
+		fmt.Println("Failed to set up HDR rendering: ", err)
+		os.Exit(1)
+	}
+	defer hdr.Delete()
+	deferred := geometry.NewDeferredRenderer()
+	defer deferred.Delete()
+	transparency := geometry.NewTransparencyPass()
+	defer transparency.Delete()
+	ssao := geometry.NewSSAOPass()
+	defer ssao.Delete()
+	mirrors := geometry.NewMirrorPass()
+	defer mirrors.Delete()
+	if err := setupScene(&state, loadOpts); err != nil {
+		fmt.Println("Failed to set up scene: ", err)
+		os.Exit(1)
+	}
+
+	for !window.ShouldClose() {
+		if state.LoadedObjects == len(state.Objects) {
+
+			now := glfw.GetTime()
+			deltaTime := now - then
+			then = now
+
+			game.Update(&state, deltaTime) //main logic update
+
+			state.Keys = keys
+
+			if mouseMovement["move"] == 1 && buttons[glfw.MouseButton2] {
+				front := mgl32.Vec3{0, 0, 0}
+				state.Camera.Yaw += float32(mouseMovement["Xmove"] * mouseMovement["sensitivity"] * deltaTime)
+				state.Camera.Pitch += float32(mouseMovement["Ymove"] * mouseMovement["sensitivity"] * deltaTime)
+
+				if state.Camera.Pitch > 89 {
+					state.Camera.Pitch = 89
+				}
+				if state.Camera.Pitch < -89 {
+					state.Camera.Pitch = -89
+				}
+
+				front[0] = float32(math.Cos(geometry.ToRadians(state.Camera.Yaw)) * math.Cos(geometry.ToRadians(state.Camera.Pitch)))
+				front[1] = float32(math.Sin(geometry.ToRadians(-state.Camera.Pitch)))
+				front[2] = float32(math.Sin(geometry.ToRadians(state.Camera.Yaw)) * math.Cos(geometry.ToRadians(state.Camera.Pitch)))
+
+				front = front.Normalize()
+
+				state.Camera.Front = front
+
+				//Rotation := geometry.RotateY(state.Camera.Center, state.Camera.Position, -(2 * deltaTime * mouseMovement["Xmove"]))
+				//fmt.Println(mouseMovement["Ymove"])
+				//state.Camera.Center = Rotation
+			}
+			mouseMovement["move"] = 0
+			glfw.PollEvents()
+			draw(&state, hdr, deferred, transparency, ssao, mirrors, deltaTime, &pointLightShadowProgramInfo, &dirLightShadowProgramInfo)
+			window.SwapBuffers()
+
+			//scene switches asked for during the frame happen between frames
+			if index, ok := state.TakeSceneRequest(); ok {
+				if err := switchScene(&state, index, loadOpts); err != nil {
+					fmt.Println("Failed to load scene: ", err)
+					os.Exit(1)
+				}
+			}
+
+		}
+	}
+	fmt.Println("Program ended successfully!")
+}
+
+// newState - creates the default scene state before a scene file is loaded
+func newState() geometry.State {
+	return geometry.State{
 		Camera: geometry.Camera{
 			Name:     "default",
 			Position: mgl32.Vec3{-1, 2.0, -3},
@@ -63,48 +237,84 @@ func main() {
 		LoadedObjects:  0,
 		CurrentTexUnit: 0,
 	}
+}
 
-	window := initGlfw()
-	defer glfw.Terminate()
-
-	window.SetKeyCallback(KeyHandler)
-	window.SetMouseButtonCallback(MouseButtonHandler)
-	window.SetCursorPosCallback(MouseMoveHandler)
-
-	if len(argsWithoutProgram) <= 0 {
-		geometry.ParseJSONFile("../Editor/statefiles/testsave.json", &state)
-	} else {
-		geometry.ParseJSONFile(argsWithoutProgram[0], &state)
-	}
-
+// setupScene - sets the camera, starts the game logic and creates the depth maps, skybox and colour grading LUTs
+// for a freshly loaded scene. A skybox or LUT that fails to load is an error under LoadAbort, otherwise the scene
+// falls back to its background colour or goes without the grading
+func setupScene(state *geometry.State, opts geometry.LoadOptions) error {
 	//setup main camera
 	if state.Settings.Cam.Name != "" {
 		state.Camera = state.Settings.Cam
 	}
 
-	then := 0.0
+	game.Start(state) //main logic start
 
-	game.Start(&state) //main logic start
-	fmt.Println("PID: ", os.Getpid())
 	gl.GenFramebuffers(1, &state.DepthFBO)
 
 	//iterate through pointlights and create depth maps for each
 	for l := 0; l < len(state.PointLights); l++ {
 		if state.PointLights[l].Shadow == 1 {
-			state.PointLights[l].CreateLightSpaceTransforms(1024, 1024)
-			state.PointLights[l].CreateCubeDepthMap(1024, 1024)
+			resolution := state.PointLights[l].ShadowResolution
+			state.PointLights[l].CreateLightSpaceTransforms(float32(resolution), float32(resolution))
+			state.PointLights[l].CreateCubeDepthMap(resolution, resolution)
 		}
 	}
 
 	for l := 0; l < len(state.DirectionalLights); l++ {
-		state.DirectionalLights[l].CreateLightSpaceTransforms(1.0, 7.5)
-		state.DirectionalLights[l].CreateDirectionalDepthMap(1024, 1024)
+		state.DirectionalLights[l].CreateDirectionalDepthMap()
 	}
 
 	if state.Settings.Skybox.Path != "" {
-		geometry.InitSkyBox(".."+state.Settings.Skybox.Path, state.Settings.Skybox.Format, &state.Settings.Skybox)
+		err := geometry.InitSkyBox(".."+state.Settings.Skybox.Path, state.Settings.Skybox.Format, &state.Settings.Skybox)
+		if err != nil {
+			if opts.Policy == geometry.LoadAbort {
+				return err
+			}
+			fmt.Printf("Warning: drawing without skybox, %s\n", err)
+			state.Settings.Skybox.Path = ""
+		}
 	}
 
+	for i := range state.Settings.PostProcess {
+		effect := &state.Settings.PostProcess[i]
+		if effect.Effect != "colorGrading" {
+			continue
+		}
+		if err := geometry.InitColorLUT("../Editor/materials/"+effect.LUT, effect); err != nil {
+			if opts.Policy == geometry.LoadAbort {
+				return err
+			}
+			fmt.Printf("Warning: drawing without color grading, %s\n", err)
+			effect.SetEnabled(false)
+		}
+	}
+
+	return nil
+}
+
+// switchScene - tears down the current scene and builds state.Scenes[index], going back to the previous scene
+// if the new one fails to load
+func switchScene(state *geometry.State, index int, opts geometry.LoadOptions) error {
+	previous := state.CurrentScene
+
+	err := state.LoadScene(index, opts)
+	if err == nil {
+		err = setupScene(state, opts)
+	}
+	if err == nil {
+		return nil
+	}
+
+	fmt.Println("Failed to switch scene: ", err)
+	if err := state.LoadScene(previous, opts); err != nil {
+		return err
+	}
+	return setupScene(state, opts)
+}
+
+// setupShadowPrograms - creates the shader programs used to render point and directional light depth maps
+func setupShadowPrograms() (geometry.ProgramInfo, geometry.ProgramInfo) {
 	//setup pointlightshadow shader program
 	shadowShaderVals := make(map[string]bool)
 	shadowShaderVals["uModelMatrix"] = true
@@ -131,61 +341,19 @@ func main() {
 	dirLightShadowProgramInfo.SetAttributes(shadowProgAttribs)
 	geometry.SetupAttributesMap(&dirLightShadowProgramInfo, shadowShaderVals)
 
-	for !window.ShouldClose() {
-		if state.LoadedObjects == len(state.Objects) {
-
-			now := glfw.GetTime()
-			deltaTime := now - then
-			then = now
-
-			game.Update(&state, deltaTime) //main logic update
-
-			state.Keys = keys
-
-			if mouseMovement["move"] == 1 && buttons[glfw.MouseButton2] {
-				front := mgl32.Vec3{0, 0, 0}
-				state.Camera.Yaw += float32(mouseMovement["Xmove"] * mouseMovement["sensitivity"] * deltaTime)
-				state.Camera.Pitch += float32(mouseMovement["Ymove"] * mouseMovement["sensitivity"] * deltaTime)
-
-				if state.Camera.Pitch > 89 {
-					state.Camera.Pitch = 89
-				}
-				if state.Camera.Pitch < -89 {
-					state.Camera.Pitch = -89
-				}
-
-				front[0] = float32(math.Cos(geometry.ToRadians(state.Camera.Yaw)) * math.Cos(geometry.ToRadians(state.Camera.Pitch)))
-				front[1] = float32(math.Sin(geometry.ToRadians(-state.Camera.Pitch)))
-				front[2] = float32(math.Sin(geometry.ToRadians(state.Camera.Yaw)) * math.Cos(geometry.ToRadians(state.Camera.Pitch)))
-
-				front = front.Normalize()
-
-				state.Camera.Front = front
-
-				//Rotation := geometry.RotateY(state.Camera.Center, state.Camera.Position, -(2 * deltaTime * mouseMovement["Xmove"]))
-				//fmt.Println(mouseMovement["Ymove"])
-				//state.Camera.Center = Rotation
-			}
-			mouseMovement["move"] = 0
-			draw(window, &state, &pointLightShadowProgramInfo, &dirLightShadowProgramInfo)
-
-		}
-	}
-	fmt.Println("Program ended successfully!")
+	return pointLightShadowProgramInfo, dirLightShadowProgramInfo
 }
 
 //TODO make cleaner pass of shadow programinfos
-func draw(window *glfw.Window, state *geometry.State, pointLightShadowProgramInfo, dirLightShadowProgramInfo *geometry.ProgramInfo) {
+func draw(state *geometry.State, hdr *geometry.HDRPipeline, deferred *geometry.DeferredRenderer, transparency *geometry.TransparencyPass, ssao *geometry.SSAOPass, mirrors *geometry.MirrorPass, deltaTime float64, pointLightShadowProgramInfo, dirLightShadowProgramInfo *geometry.ProgramInfo) {
 	gl.Enable(gl.DEPTH_TEST)
 	gl.Enable(gl.MULTISAMPLE)
 	gl.Enable(gl.CULL_FACE)
-	//gl.Enable(gl.FRAMEBUFFER_SRGB)
+	//the tone mapping pass encodes the output, so FRAMEBUFFER_SRGB stays off
 
 	if state.Settings.BackgroundColor != nil {
 		gl.ClearColor(state.Settings.BackgroundColor[0], state.Settings.BackgroundColor[1], state.Settings.BackgroundColor[2], 1.0)
 	}
-
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 	// err := gl.GetError()
 
 	// if err != gl.NO_ERROR {
@@ -193,335 +361,354 @@ func draw(window *glfw.Window, state *geometry.State, pointLightShadowProgramInf
 	// 	//panic(err)
 	// }
 
-	glfw.PollEvents()
+	//apply forces and bring the scene graph up to date before any pass reads the model matrices or lights
+	for x := 0; x < len(state.Objects); x++ {
+		state.Objects[x].Translate(state.Objects[x].GetForce())
+	}
+	if state.Root != nil {
+		state.Root.Update()
+	}
+	state.UpdateInstances()
 
-	//going to have to render depth for each pointlight here
+	//shadow maps are only redrawn when the light or a caster they show moved
+	state.UpdateShadowCasters()
 	for l := 0; l < len(state.PointLights); l++ {
 		if state.PointLights[l].Shadow == 1 {
-			//fmt.Println("here")
-			state.PointLights[l].BindDepthMap(state)
-			gl.Viewport(0, 0, 1024, 1024)
-			gl.BindFramebuffer(gl.FRAMEBUFFER, state.DepthFBO)
-			gl.Clear(gl.DEPTH_BUFFER_BIT)
-			for x := 0; x < len(state.Objects); x++ {
-				//check for the light's parent object here
-				name, _, _ := state.Objects[x].GetDetails()
-				if state.PointLights[l].Parent == name {
-					currentModel, err := state.Objects[x].GetModel()
-					if err != nil {
-						fmt.Printf("ERROR getting model!")
-					}
-					state.PointLights[l].Position = []float32{currentModel.Position[0], currentModel.Position[1], currentModel.Position[2]}
-				}
-				state.PointLights[l].ShadowRender(state, state.Objects[x], pointLightShadowProgramInfo)
-			}
-			gl.FramebufferTexture(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, 0, 0)
-			gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
-		} else {
-			for x := 0; x < len(state.Objects); x++ {
-				//check for the light's parent object here
-				name, _, _ := state.Objects[x].GetDetails()
-				if state.PointLights[l].Parent == name {
-					currentModel, err := state.Objects[x].GetModel()
-					if err != nil {
-						fmt.Printf("ERROR getting model!")
-					}
-					state.PointLights[l].Position = []float32{currentModel.Position[0], currentModel.Position[1], currentModel.Position[2]}
-				}
-			}
+			state.RenderPointShadows(&state.PointLights[l], pointLightShadowProgramInfo)
 		}
 	}
 
-	//Depth draw directional lights
+	//directional light cascades are fitted to the camera frustum first
+	fovy, aspect, near, far := cameraLens()
 	for l := 0; l < len(state.DirectionalLights); l++ {
-		state.DirectionalLights[l].BindDepthMap(state)
-		gl.Viewport(0, 0, 1024, 1024)
-		gl.BindFramebuffer(gl.FRAMEBUFFER, state.DepthFBO)
-		gl.Clear(gl.DEPTH_BUFFER_BIT)
-		for x := 0; x < len(state.Objects); x++ {
-			state.DirectionalLights[l].ShadowRender(state, state.Objects[x], dirLightShadowProgramInfo)
-		}
-		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, 0, 0)
-		gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+		state.DirectionalLights[l].UpdateCascades(cameraView(state), fovy, aspect, near, far)
+		state.RenderDirectionalShadows(&state.DirectionalLights[l], dirLightShadowProgramInfo)
 	}
 
-	//sort the objects
-	sort.Slice(state.Objects, func(a, b int) bool {
-		nameA, _, _ := state.Objects[a].GetDetails()
-		nameB, _, _ := state.Objects[b].GetDetails()
-		aModel, err := state.Objects[a].GetModel()
-		bModel, err := state.Objects[b].GetModel()
-		aBox := state.Objects[a].GetBoundingBox()
-		bBox := state.Objects[b].GetBoundingBox()
+	//light positions and shadow matrices are final for this frame now, the reflection probes see the scene lit and
+	//shadowed like the camera does
+	state.Settings.Skybox.BindEnvironment()
+	err := state.CaptureProbes(func(probe *geometry.ReflectionProbe, view, projection mgl32.Mat4) {
+		probeView := renderView{view: view, projection: projection, position: probe.Position, probe: probe}
+		//the skybox of the face before leaves culling off
+		gl.Enable(gl.CULL_FACE)
+		for i := 0; i < len(state.Objects); i++ {
+			object := state.Objects[i]
+			//transparent objects need the transparency pass, and an object would hide the probe it reflects
+			if !geometry.Transparent(object) && state.NearestProbe(object) != probe {
+				ClassicRender(state, object, probeView)
+			}
+		}
+		drawSkybox(state, view, projection)
+	})
+	if err != nil {
+		panic(err)
+	}
+	width, height := int32(globals.Width), int32(globals.Height)
+	camera := renderView{view: cameraView(state), projection: mgl32.Perspective(fovy, aspect, near, far), position: state.Camera.Position, mirrors: mirrors}
 
+	//mirrors the camera sees draw the scene reflected about themselves, with the lights uploaded for each reflection
+	mirrors.Prune(state.Objects)
+	for i := 0; i < len(state.Objects); i++ {
+		mirror := state.Objects[i]
+		if geometry.MirrorOf(mirror) == nil || !visible(mirror, camera.view, camera.projection) {
+			continue
+		}
+		reflection, err := mirrors.Begin(mirror, camera.view, camera.projection, camera.position, width, height)
 		if err != nil {
 			panic(err)
 		}
+		//the oblique projection's far plane is tilted, so the lights and culling use the camera's
+		state.UploadLights(reflection.View, camera.projection, near, far, reflection.Width, reflection.Height)
+		mirrorView := renderView{view: reflection.View, projection: reflection.Projection, cull: camera.projection, position: reflection.Position, mirror: mirror}
+		gl.Enable(gl.CULL_FACE)
+		for j := 0; j < len(state.Objects); j++ {
+			object := state.Objects[j]
+			if object != mirror && !geometry.Transparent(object) {
+				ClassicRender(state, object, mirrorView)
+			}
+		}
+		drawSkybox(state, reflection.View, camera.projection)
+		mirrors.End()
+	}
+	state.UploadLights(camera.view, camera.projection, near, far, width, height)
 
-		aDist := geometry.VectorDistance(state.Camera.Position, aModel.Position.Add(aBox.Min))
-		bDist := geometry.VectorDistance(state.Camera.Position, bModel.Position.Add(bBox.Min))
-		//iLengthToCam := state.Camera.Position.Sub(iModel.Position)
-		if aDist > bDist {
-			return true
-		} else if bDist > aDist {
-			return false
-		} else {
-			return nameA > nameB
+	//the lit shaders read the occlusion of the opaque objects, so it is found before any of them are drawn
+	if state.Settings.SSAO.Enabled {
+		projection := mgl32.Perspective(fovy, aspect, near, far)
+		viewMatrix := cameraView(state)
+		if err := ssao.Begin(width, height); err != nil {
+			panic(err)
 		}
-	})
+		for i := 0; i < len(state.Objects); i++ {
+			object := state.Objects[i]
+			if !ssao.Handles(object) {
+				continue
+			}
+			if copies := visibleCopies(state, object, viewMatrix, projection); len(copies) > 0 {
+				ssao.DrawObject(state, copies, viewMatrix, projection)
+			}
+		}
+		ssao.Occlude(state.Settings.SSAO, projection)
+	}
 
-	//try the classical render method
-	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
-	gl.Viewport(0, 0, int32(globals.Width), int32(globals.Height))
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	if state.Settings.Renderer == geometry.DeferredRendering {
+		//opaque lit objects go through the G-buffer, the rest are drawn forward over the lit frame
+		projection := mgl32.Perspective(fovy, aspect, near, far)
+		viewMatrix := cameraView(state)
+		if err := deferred.Begin(width, height); err != nil {
+			panic(err)
+		}
+		for i := 0; i < len(state.Objects); i++ {
+			object := state.Objects[i]
+			if object.GetBoundingBox().Collide {
+				collisionTest(state, object)
+			}
+			if deferred.Handles(object) {
+				if copies := visibleCopies(state, object, viewMatrix, projection); len(copies) > 0 {
+					state.RenderedObjects++
+					deferred.DrawObject(state, copies, viewMatrix, projection)
+				}
+			}
+		}
+
+		if err := hdr.BeginResolved(width, height); err != nil {
+			panic(err)
+		}
+		gl.Clear(gl.COLOR_BUFFER_BIT)
+		deferred.Light(state, viewMatrix, projection)
+		for i := 0; i < len(state.Objects); i++ {
+			if !deferred.Handles(state.Objects[i]) && !geometry.Transparent(state.Objects[i]) {
+				ClassicRender(state, state.Objects[i], camera)
+			}
+		}
+	} else {
+		//try the classical render method, into the HDR target
+		if err := hdr.Begin(width, height); err != nil {
+			panic(err)
+		}
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+		for i := 0; i < len(state.Objects); i++ {
+			if state.Objects[i].GetBoundingBox().Collide {
+				collisionTest(state, state.Objects[i])
+			}
+			if !geometry.Transparent(state.Objects[i]) {
+				ClassicRender(state, state.Objects[i], camera)
+			}
+		}
+	}
+
+	drawSkybox(state, camera.view, camera.projection)
+
+	//transparent objects go over the opaque frame and the skybox, in any order
+	var transparent []geometry.Geometry
 	for i := 0; i < len(state.Objects); i++ {
-		if state.Objects[i].GetBoundingBox().Collide {
-			collisionTest(state, state.Objects[i])
+		if geometry.Transparent(state.Objects[i]) {
+			transparent = append(transparent, state.Objects[i])
+		}
+	}
+	if len(transparent) > 0 {
+		if err := transparency.Begin(width, height); err != nil {
+			panic(err)
+		}
+		for _, object := range transparent {
+			ClassicRender(state, object, camera)
 		}
-		ClassicRender(state, state.Objects[i])
+		transparency.Composite()
 	}
 
-	if state.Settings.Skybox.Path != "" {
-		//get shader program using skymap
+	hdr.Resolve(&state.Settings, geometry.PostFrame{
+		Target:    state.FrameBuffer,
+		DeltaTime: deltaTime,
+		Near:      near,
+		Far:       far,
+	})
+}
+
+// drawSkybox - draws the skybox, if the scene has one, behind what has been drawn so far
+func drawSkybox(state *geometry.State, view, projection mgl32.Mat4) {
+	if state.Settings.Skybox.Path == "" {
+		return
+	}
+	gl.UseProgram(state.Settings.Skybox.ProgramInfo.Program)
+	gl.Disable(gl.CULL_FACE)
+
+	gl.DepthFunc(gl.LEQUAL)
+	//the sky is infinitely far away, so only the rotation of the view applies
+	viewMatrix := view.Mat3().Mat4()
+	gl.UniformMatrix4fv(state.Settings.Skybox.ProgramInfo.UniformLocations.Projection, 1, false, &projection[0])
+	gl.UniformMatrix4fv(state.Settings.Skybox.ProgramInfo.UniformLocations.View, 1, false, &viewMatrix[0])
+	state.Settings.Skybox.Bind()
+	gl.BindVertexArray(state.Settings.Skybox.VAO)
+	gl.DrawElements(gl.TRIANGLES, int32(len(state.Settings.Skybox.Vertices)), gl.UNSIGNED_INT, gl.Ptr(nil))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
+	gl.BindVertexArray(0)
+	gl.DepthFunc(gl.LESS)
+}
 
-		gl.UseProgram(state.Settings.Skybox.ProgramInfo.Program)
-		gl.Disable(gl.CULL_FACE)
+// renderView - where objects are drawn from, the camera, a face of the reflection probe being captured or the
+// reflection in a mirror
+type renderView struct {
+	view       mgl32.Mat4
+	projection mgl32.Mat4
+	cull       mgl32.Mat4 //projection objects are culled with when it isn't projection, zero otherwise
+	position   mgl32.Vec3
+	probe      *geometry.ReflectionProbe //the probe being captured, nil otherwise
+	mirror     geometry.Geometry         //the mirror whose reflection is drawn, nil otherwise
+	mirrors    *geometry.MirrorPass      //reflections the mirrors show, nil unless this is the camera
+}
 
-		var fovy = float32(60 * math.Pi / 180)
-		var aspect = float32(globals.Width / globals.Height)
-		var near = float32(0.1)
-		var far = float32(1000.0)
-		gl.DepthFunc(gl.LEQUAL)
-		projection := mgl32.Perspective(fovy, aspect, near, far)
-		camFront := state.Camera.Position.Add(state.Camera.Front)
-		viewMatrix := mgl32.LookAtV(state.Camera.Position, camFront, state.Camera.Up)
-		viewMatrix = viewMatrix.Mat3().Mat4()
-		gl.UniformMatrix4fv(gl.GetUniformLocation(state.Settings.Skybox.ProgramInfo.Program, gl.Str("uProjectionMatrix\x00")), 1, false, &projection[0])
-		gl.UniformMatrix4fv(gl.GetUniformLocation(state.Settings.Skybox.ProgramInfo.Program, gl.Str("uViewMatrix\x00")), 1, false, &viewMatrix[0])
-		gl.ActiveTexture(gl.TEXTURE0 + state.Settings.Skybox.CubeMap)
-		gl.BindTexture(gl.TEXTURE_CUBE_MAP, state.Settings.Skybox.CubeMap)
-		gl.Uniform1i(gl.GetUniformLocation(state.Settings.Skybox.ProgramInfo.Program, gl.Str("skybox\x00")), int32(state.Settings.Skybox.CubeMap))
-		gl.BindVertexArray(state.Settings.Skybox.VAO)
-		gl.DrawElements(gl.TRIANGLES, int32(len(state.Settings.Skybox.Vertices)), gl.UNSIGNED_INT, gl.Ptr(nil))
-		gl.BindTexture(gl.TEXTURE_2D, 0)
-		gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
-		gl.BindVertexArray(0)
-		gl.DepthFunc(gl.LESS)
-	}
-
-	window.SwapBuffers()
+// fromCamera - whether the view is the camera's, which counts the objects drawn and reads the ambient occlusion
+func (v renderView) fromCamera() bool {
+	return v.probe == nil && v.mirror == nil
+}
+
+// cullProjection - projection the view's frustum culling uses
+func (v renderView) cullProjection() mgl32.Mat4 {
+	if v.cull != (mgl32.Mat4{}) {
+		return v.cull
+	}
+	return v.projection
+}
+
+// cameraLens - fovy, aspect, near and far of the perspective projection objects are drawn with
+func cameraLens() (float32, float32, float32, float32) {
+	return float32(60 * math.Pi / 180), float32(globals.Width / globals.Height), 0.1, 1000.0
 }
 
-//Classic non threaded render
-func ClassicRender(state *geometry.State, object geometry.Geometry) {
+// cameraView - view matrix of the scene camera
+func cameraView(state *geometry.State) mgl32.Mat4 {
+	camFront := state.Camera.Position.Add(state.Camera.Front)
+	return mgl32.LookAtV(state.Camera.Position, camFront, state.Camera.Up)
+}
+
+//Classic non threaded render, from the camera, a reflection probe or a mirror. Probe captures and reflections leave
+//out the ambient occlusion, which is the camera's, and mirrors in them show no reflection
+func ClassicRender(state *geometry.State, object geometry.Geometry, from renderView) {
 	currentProgramInfo, err := object.GetProgramInfo()
 	if err != nil {
 		panic(err)
 	}
 
-	currentBuffers := object.GetBuffers()
-
 	gl.UseProgram(currentProgramInfo.Program)
 
-	currentForce := object.GetForce()
-	object.Translate(currentForce)
+	currentMaterial := object.GetMaterial()
 
-	//now get the model
-	currentModel, err := object.GetModel()
+	projection := from.projection
+	viewMatrix := from.view
+	camPosition := []float32{from.position[0], from.position[1], from.position[2]}
+	//world transform from the scene graph
+	modelMatrix, err := object.GetModelMatrix()
 	if err != nil {
-		//throw an error
-		fmt.Printf("ERROR getting model!")
+		modelMatrix = geometry.ObjectTransform(object).Matrix()
 	}
 
-	_, _, parent := object.GetDetails()
-	currentCentroid := object.GetCentroid()
-	currentMaterial := object.GetMaterial()
-	currentVertices := object.GetVertices()
-
-	state.RenderedObjects++
-
-	var fovy = float32(60 * math.Pi / 180)
-	var aspect = float32(globals.Width / globals.Height)
-	var near = float32(0.1)
-	var far = float32(1000.0)
-
-	projection := mgl32.Perspective(fovy, aspect, near, far)
-	//create a camfront value
-	camFront := state.Camera.Position.Add(state.Camera.Front)
-	viewMatrix := mgl32.LookAtV(state.Camera.Position, camFront, state.Camera.Up)
-	camPosition := []float32{state.Camera.Position[0], state.Camera.Position[1], state.Camera.Position[2]}
-	modelMatrix := mgl32.Ident4()
-
-	if object.GetType() == "mesh" {
-		//move to centroid
-		centroidMat := mgl32.Translate3D(currentCentroid[0], currentCentroid[1], currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(centroidMat)
-		//position
-		positionMat := mgl32.Translate3D(currentModel.Position[0], currentModel.Position[1], currentModel.Position[2])
-		modelMatrix = modelMatrix.Mul4(positionMat)
-		//negative centroid
-		negCent := mgl32.Translate3D(-currentCentroid[0], -currentCentroid[1], -currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(negCent)
-		//rotation
-		modelMatrix = modelMatrix.Mul4(currentModel.Rotation)
-		//scale
-		modelMatrix = geometry.ScaleM4(modelMatrix, currentModel.Scale)
-	} else {
-		//move to centroid
-		centroidMat := mgl32.Translate3D(currentCentroid[0], currentCentroid[1], currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(centroidMat)
-		//rotation
-		modelMatrix = modelMatrix.Mul4(currentModel.Rotation)
-		//position
-		positionMat := mgl32.Translate3D(currentModel.Position[0], currentModel.Position[1], currentModel.Position[2])
-		modelMatrix = modelMatrix.Mul4(positionMat)
-		//negative centroid
-		negCent := mgl32.Translate3D(-currentCentroid[0], -currentCentroid[1], -currentCentroid[2])
-		modelMatrix = modelMatrix.Mul4(negCent)
-		//scale
-		modelMatrix = geometry.ScaleM4(modelMatrix, currentModel.Scale)
-	}
-
-	if currentMaterial.Alpha < 1.0 {
-		// name, _, _ := object.CurrentObject.GetDetails()
-		// fmt.Println("here: ", name)
-		gl.Enable(gl.BLEND)
-		gl.Disable(gl.DEPTH_TEST)
-		gl.BlendFunc(gl.ONE_MINUS_CONSTANT_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
-		gl.ClearDepth(float64(currentMaterial.Alpha))
+	//transparent objects are drawn between the transparency pass's Begin and Composite, which set up the blending
+	//and aren't in the ambient occlusion prepass, so they don't read it
+	if geometry.Transparent(object) {
+		gl.Uniform1i(currentProgramInfo.UniformLocations.TransparentPass, 1)
+		gl.Uniform1i(currentProgramInfo.UniformLocations.SSAOEnabled, 0)
 	} else {
+		gl.Uniform1i(currentProgramInfo.UniformLocations.TransparentPass, 0)
+		if state.Settings.SSAO.Enabled && from.fromCamera() {
+			gl.Uniform1i(currentProgramInfo.UniformLocations.SSAOEnabled, 1)
+		} else {
+			gl.Uniform1i(currentProgramInfo.UniformLocations.SSAOEnabled, 0)
+		}
 		gl.Enable(gl.DEPTH_TEST)
 		gl.DepthMask(true)
 		gl.Disable(gl.BLEND)
-		gl.ClearDepth(1.0)
 		gl.DepthFunc(gl.LEQUAL)
 	}
 
-	if parent != "" {
-		parentObj := geometry.GetSceneObject(parent, (*state))
-		if parentObj != nil {
-			parentMMatrix, err := parentObj.GetModelMatrix()
-			if err == nil {
-				modelMatrix = modelMatrix.Mul4(parentMMatrix)
-			}
-		} else {
-			fmt.Println("ERROR GETTING PARENT OBJECT")
-		}
+	if from.fromCamera() {
+		state.ViewMatrix = viewMatrix
 	}
-	object.SetModelMatrix(modelMatrix)
-	state.ViewMatrix = viewMatrix
 
 	gl.UniformMatrix4fv(currentProgramInfo.UniformLocations.Projection, 1, false, &projection[0])
 	gl.UniformMatrix4fv(currentProgramInfo.UniformLocations.View, 1, false, &viewMatrix[0])
 	gl.Uniform3fv(currentProgramInfo.UniformLocations.CameraPosition, 1, &camPosition[0])
 	gl.UniformMatrix4fv(currentProgramInfo.UniformLocations.Model, 1, false, &modelMatrix[0])
+	normalMatrix := geometry.NormalMatrix(modelMatrix)
+	gl.UniformMatrix3fv(currentProgramInfo.UniformLocations.NormalMatrix, 1, false, &normalMatrix[0])
 
-	model, err := object.GetModel()
-	if err != nil {
-		panic(err)
-	}
-
-	frustum := mymath.ConstructFrustrum(viewMatrix, projection)
-	testLen := object.GetBoundingBox().Max.LenSqr() * object.GetBoundingBox().Max.LenSqr()
-	result := frustum.SphereIntersection(model.Position, testLen)
-
-	name, _, _ := object.GetDetails()
-
-	if !result || name == "playerCube" {
+	copies := visibleCopies(state, object, viewMatrix, from.cullProjection())
+	if len(copies) == 0 {
 		return
 	}
+	if from.fromCamera() {
+		state.RenderedObjects++
+	}
 
-	gl.Uniform3fv(currentProgramInfo.UniformLocations.DiffuseVal, 1, &currentMaterial.Diffuse[0])
-	gl.Uniform3fv(currentProgramInfo.UniformLocations.AmbientVal, 1, &currentMaterial.Ambient[0])
-	gl.Uniform3fv(currentProgramInfo.UniformLocations.SpecularVal, 1, &currentMaterial.Specular[0])
-	gl.Uniform1fv(currentProgramInfo.UniformLocations.NVal, 1, &currentMaterial.N)
-	gl.Uniform1fv(currentProgramInfo.UniformLocations.Alpha, 1, &currentMaterial.Alpha)
-
-	numPointLights := int32(len(state.PointLights))
-	gl.Uniform1iv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("numPointLights\x00")), 1, &numPointLights)
-	numDirLights := int32(len(state.DirectionalLights))
-	gl.Uniform1iv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("numDirLights\x00")), 1, &numDirLights)
-
-	diffuseTexture := object.GetDiffuseTexture()
-	normalTexture := object.GetNormalTexture()
-
-	if diffuseTexture != nil {
-		diffuseTex := diffuseTexture.GetHandle()
-		gl.ActiveTexture(gl.TEXTURE0 + diffuseTex)
-		gl.BindTexture(gl.TEXTURE_2D, diffuseTex)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("uDiffuseTexture\x00")), int32(diffuseTex))
-	}
-
-	if normalTexture != nil {
-		normTex := normalTexture.GetHandle()
-		gl.ActiveTexture(gl.TEXTURE0 + normTex)
-		gl.BindTexture(gl.TEXTURE_2D, normTex)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("uNormalTexture\x00")), int32(normTex))
-	}
-
-	for i := 0; i < len(state.PointLights); i++ {
-		gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].position\x00")), 1, &state.PointLights[i].Position[0])
-		gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].color\x00")), 1, &state.PointLights[i].Colour[0])
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].strength\x00")), 1, &state.PointLights[i].Strength)
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].constant\x00")), 1, &state.PointLights[i].Constant)
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].linear\x00")), 1, &state.PointLights[i].Linear)
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].quadratic\x00")), 1, &state.PointLights[i].Quadratic)
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].farPlane\x00")), 1, &state.PointLights[i].FarPlane)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].shadow\x00")), state.PointLights[i].Shadow)
-		gl.ActiveTexture(gl.TEXTURE0 + state.PointLights[i].DepthMap)
-		gl.BindTexture(gl.TEXTURE_CUBE_MAP, state.PointLights[i].DepthMap)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"pointLights[", strconv.Itoa(i)}, "")+"].depthMap\x00")), int32(state.PointLights[i].DepthMap))
-	}
-
-	// for i := 0; i < len(state.DirectionalLights); i++ {
-	// 	gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"dirLights[", strconv.Itoa(i)}, "")+"].direction\x00")), 1, &state.DirectionalLights[i].Direction[0])
-	// 	gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"dirLights[", strconv.Itoa(i)}, "")+"].color\x00")), 1, &state.DirectionalLights[i].Colour[0])
-	// 	gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"dirLights[", strconv.Itoa(i)}, "")+"].strength\x00")), 1, &state.DirectionalLights[i].Strength)
-	// 	gl.UniformMatrix4fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"dirLights[", strconv.Itoa(i)}, "")+"].lightSpaceMatrix\x00")), 1, false, &state.DirectionalLights[i].LightViewMatrix[0])
-	// 	gl.ActiveTexture(gl.TEXTURE0 + state.DirectionalLights[i].DepthMap)
-	// 	gl.BindTexture(gl.TEXTURE_2D, state.DirectionalLights[i].DepthMap)
-	// 	gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str(strings.Join([]string{"dirLights[", strconv.Itoa(i)}, "")+"].depthMap\x00")), int32(state.DirectionalLights[i].DepthMap))
-	// }
-
-	if numDirLights > 0 {
-		gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.direction\x00")), 1, &state.DirectionalLights[0].Direction[0])
-		gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.color\x00")), 1, &state.DirectionalLights[0].Colour[0])
-		gl.Uniform3fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.position\x00")), 1, &state.DirectionalLights[0].Position[0])
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.strength\x00")), 1, &state.DirectionalLights[0].Strength)
-		gl.UniformMatrix4fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.lightSpaceMatrix\x00")), 1, false, &state.DirectionalLights[0].LightViewMatrix[0])
-		gl.ActiveTexture(gl.TEXTURE0 + state.DirectionalLights[0].DepthMap)
-		gl.BindTexture(gl.TEXTURE_2D, state.DirectionalLights[0].DepthMap)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("dirLight.depthMap\x00")), int32(state.DirectionalLights[0].DepthMap))
-
+	if currentMaterial.ShaderType == geometry.PBRShaderType {
+		geometry.BindPBRMaterial(currentProgramInfo, object)
+	} else {
+		gl.Uniform3fv(currentProgramInfo.UniformLocations.DiffuseVal, 1, &currentMaterial.Diffuse[0])
+		gl.Uniform3fv(currentProgramInfo.UniformLocations.AmbientVal, 1, &currentMaterial.Ambient[0])
+		gl.Uniform3fv(currentProgramInfo.UniformLocations.SpecularVal, 1, &currentMaterial.Specular[0])
+		gl.Uniform1fv(currentProgramInfo.UniformLocations.NVal, 1, &currentMaterial.N)
+		gl.Uniform1fv(currentProgramInfo.UniformLocations.Alpha, 1, &currentMaterial.Alpha)
+		geometry.BindBlinnTextures(object)
 	}
 
+	//light values come from the Lights uniform buffer and the light clusters, only the shadow maps are bound per program
+	state.BindShadowMaps()
+
 	//tell the shader if there is a cubemap
 	if state.Settings.Skybox.Path != "" {
-		gl.ActiveTexture(gl.TEXTURE0 + state.Settings.Skybox.CubeMap)
-		gl.BindTexture(gl.TEXTURE_CUBE_MAP, state.Settings.Skybox.CubeMap)
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("skyboxPresent\x00")), int32(1))
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("skybox\x00")), int32(state.Settings.Skybox.CubeMap))
-
-		reflect, refract := object.GetReflectionValues()
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("reflective\x00")), int32(reflect))
-		gl.Uniform1fv(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("refractiveIndex\x00")), 1, &refract)
-
+		state.Settings.Skybox.Bind()
+		gl.Uniform1i(currentProgramInfo.UniformLocations.SkyboxPresent, int32(1))
 	} else {
-		gl.Uniform1i(gl.GetUniformLocation(currentProgramInfo.Program, gl.Str("skyboxPresent\x00")), int32(0))
+		gl.Uniform1i(currentProgramInfo.UniformLocations.SkyboxPresent, int32(0))
 	}
 
-	gl.BindVertexArray(currentBuffers.Vao)
-	if object.GetType() != "mesh" {
-		gl.DrawElements(gl.TRIANGLES, int32(len(currentVertices.Vertices)), gl.UNSIGNED_INT, gl.Ptr(nil))
+	//reflective objects see the nearest reflection probe when there is one, the skybox otherwise
+	reflect, refract := object.GetReflectionValues()
+	gl.Uniform1i(currentProgramInfo.UniformLocations.Reflective, int32(reflect))
+	gl.Uniform1fv(currentProgramInfo.UniformLocations.RefractiveIndex, 1, &refract)
+	if from.probe == nil {
+		geometry.BindReflectionProbe(currentProgramInfo.UniformLocations, state.NearestProbe(object))
 	} else {
-		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(currentVertices.Vertices)))
+		geometry.BindReflectionProbe(currentProgramInfo.UniformLocations, nil)
 	}
+	from.mirrors.Bind(currentProgramInfo.UniformLocations, object)
+
+	state.DrawCopies(currentProgramInfo.UniformLocations, copies)
 
 	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
 	gl.BindTexture(gl.TEXTURE_CUBE_MAP, 0)
 	gl.BindVertexArray(0)
 }
 
+// visibleCopies - the copies drawing object draws that are in the view frustum, see State.Copies. Objects drawn
+// with the rest of their instance group get none
+func visibleCopies(state *geometry.State, object geometry.Geometry, view, projection mgl32.Mat4) []geometry.Geometry {
+	var copies []geometry.Geometry
+	for _, instance := range state.Copies(object) {
+		if visible(instance, view, projection) {
+			copies = append(copies, instance)
+		}
+	}
+	return copies
+}
+
+// visible - whether an object is drawn this frame, the ones outside the view frustum are skipped
+func visible(object geometry.Geometry, view, projection mgl32.Mat4) bool {
+	model, err := object.GetModel()
+	if err != nil {
+		panic(err)
+	}
+
+	frustum := mymath.ConstructFrustrum(view, projection)
+	testLen := object.GetBoundingBox().Max.LenSqr() * object.GetBoundingBox().Max.LenSqr()
+	result := frustum.SphereIntersection(model.Position, testLen)
+
+	name, _, _ := object.GetDetails()
+	return result && name != "playerCube"
+}
+
 // initGlfw initializes glfw and returns a Window to use.
 func initGlfw() *glfw.Window {
 	if err := glfw.Init(); err != nil {
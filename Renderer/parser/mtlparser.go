@@ -3,7 +3,6 @@ package parser
 import (
 	"bufio"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -18,6 +17,8 @@ type ParsedMaterial struct {
 	MapKs   string
 }
 
+// ParseMTLFile - reads one named material from an MTL file in the models folder. When the file can't be
+// opened default values are returned along with the error, malformed statements are reported as a *ParseError
 func ParseMTLFile(filename string, materialName string) (ParsedMaterial, error) {
 	mtlFile, err := os.Open("../Editor/models/" + filename)
 	if err != nil {
@@ -36,93 +37,68 @@ func ParseMTLFile(filename string, materialName string) (ParsedMaterial, error)
 	mtlDetails := ParsedMaterial{}
 	mtlDetails.MapKD = ""
 	materialFound := false
+	lineNumber := 0
 
 	scanner := bufio.NewScanner(mtlFile)
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNumber++
 		line = strings.TrimSpace(line) //trim up the string to remove any leading or trailing whitespace
-		whiteSpaceSplit := strings.Split(line, " ")
+		whiteSpaceSplit := strings.Fields(line)
 
-		if whiteSpaceSplit[0] == "newmtl" && whiteSpaceSplit[1] != materialName {
-			materialFound = false
+		if len(whiteSpaceSplit) == 0 {
+			continue
 		}
 
-		if whiteSpaceSplit[0] == "newmtl" && whiteSpaceSplit[1] == materialName {
-			materialFound = true
+		if whiteSpaceSplit[0] == "newmtl" {
+			materialFound = len(whiteSpaceSplit) > 1 && whiteSpaceSplit[1] == materialName
+			continue
 		}
 
-		if materialFound {
-			if whiteSpaceSplit[0] == "Ns" {
-				nS, err := strconv.ParseFloat(whiteSpaceSplit[1], 64)
-				if err != nil {
-					panic(err)
-				}
-				mtlDetails.Ns = float32(nS)
-			} else if whiteSpaceSplit[0] == "Ka" {
-				ka1, err := strconv.ParseFloat(whiteSpaceSplit[1], 64)
-				if err != nil {
-					panic(err)
-				}
-				ka2, err := strconv.ParseFloat(whiteSpaceSplit[2], 64)
-				if err != nil {
-					panic(err)
-				}
-				ka3, err := strconv.ParseFloat(whiteSpaceSplit[3], 64)
-				if err != nil {
-					panic(err)
-				}
-
-				mtlDetails.Ka = append(mtlDetails.Ka, float32(ka1))
-				mtlDetails.Ka = append(mtlDetails.Ka, float32(ka2))
-				mtlDetails.Ka = append(mtlDetails.Ka, float32(ka3))
-			} else if whiteSpaceSplit[0] == "Kd" {
-				kd1, err := strconv.ParseFloat(whiteSpaceSplit[1], 64)
-				if err != nil {
-					panic(err)
-				}
-				kd2, err := strconv.ParseFloat(whiteSpaceSplit[2], 64)
-				if err != nil {
-					panic(err)
-				}
-				kd3, err := strconv.ParseFloat(whiteSpaceSplit[3], 64)
-				if err != nil {
-					panic(err)
-				}
-
-				mtlDetails.Kd = append(mtlDetails.Kd, float32(kd1))
-				mtlDetails.Kd = append(mtlDetails.Kd, float32(kd2))
-				mtlDetails.Kd = append(mtlDetails.Kd, float32(kd3))
-			} else if whiteSpaceSplit[0] == "Ks" {
-				ks1, err := strconv.ParseFloat(whiteSpaceSplit[1], 64)
-				if err != nil {
-					panic(err)
-				}
-				ks2, err := strconv.ParseFloat(whiteSpaceSplit[2], 64)
-				if err != nil {
-					panic(err)
-				}
-				ks3, err := strconv.ParseFloat(whiteSpaceSplit[3], 64)
-				if err != nil {
-					panic(err)
-				}
-
-				mtlDetails.Ks = append(mtlDetails.Ks, float32(ks1))
-				mtlDetails.Ks = append(mtlDetails.Ks, float32(ks2))
-				mtlDetails.Ks = append(mtlDetails.Ks, float32(ks3))
-			} else if whiteSpaceSplit[0] == "d" {
-				d, err := strconv.ParseFloat(whiteSpaceSplit[1], 64)
-				if err != nil {
-					panic(err)
-				}
+		if !materialFound {
+			continue
+		}
 
-				mtlDetails.D = float32(d)
-			} else if whiteSpaceSplit[0] == "map_Kd" {
-				mtlDetails.MapKD = whiteSpaceSplit[1]
-			} else if whiteSpaceSplit[0] == "map_Bump" {
-				mtlDetails.MapBump = whiteSpaceSplit[1]
+		if whiteSpaceSplit[0] == "Ns" {
+			nS, err := parseFloats(whiteSpaceSplit, 1)
+			if err != nil {
+				return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
+			}
+			mtlDetails.Ns = nS[0]
+		} else if whiteSpaceSplit[0] == "Ka" {
+			ka, err := parseFloats(whiteSpaceSplit, 3)
+			if err != nil {
+				return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
 			}
+			mtlDetails.Ka = append(mtlDetails.Ka, ka...)
+		} else if whiteSpaceSplit[0] == "Kd" {
+			kd, err := parseFloats(whiteSpaceSplit, 3)
+			if err != nil {
+				return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
+			}
+			mtlDetails.Kd = append(mtlDetails.Kd, kd...)
+		} else if whiteSpaceSplit[0] == "Ks" {
+			ks, err := parseFloats(whiteSpaceSplit, 3)
+			if err != nil {
+				return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
+			}
+			mtlDetails.Ks = append(mtlDetails.Ks, ks...)
+		} else if whiteSpaceSplit[0] == "d" {
+			d, err := parseFloats(whiteSpaceSplit, 1)
+			if err != nil {
+				return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
+			}
+			mtlDetails.D = d[0]
+		} else if whiteSpaceSplit[0] == "map_Kd" && len(whiteSpaceSplit) > 1 {
+			mtlDetails.MapKD = whiteSpaceSplit[1]
+		} else if whiteSpaceSplit[0] == "map_Bump" && len(whiteSpaceSplit) > 1 {
+			mtlDetails.MapBump = whiteSpaceSplit[1]
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return mtlDetails, &ParseError{File: filename, Line: lineNumber, Err: err}
+	}
+
 	return mtlDetails, nil
 }
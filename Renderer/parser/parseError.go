@@ -0,0 +1,23 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// ParseError - error for a malformed OBJ or MTL file, Line is 0 when the problem is not tied to one line
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
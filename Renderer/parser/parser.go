@@ -26,23 +26,22 @@ type OBJObject struct {
 	Smooth    bool
 }
 
-func SerializeOBJ(vals []OBJObject) string {
+func SerializeOBJ(vals []OBJObject) (string, error) {
 	b := bytes.Buffer{}
 	e := gob.NewEncoder(&b)
 
 	err := e.Encode(vals)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(b.Bytes())
+	return base64.StdEncoding.EncodeToString(b.Bytes()), nil
 }
 
-func DeserializeOBJ(value string) []OBJObject {
+func DeserializeOBJ(value string) ([]OBJObject, error) {
 	var objects []OBJObject
 	by, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
-		fmt.Println(value)
-		panic(err)
+		return nil, err
 	}
 	b := bytes.Buffer{}
 
@@ -50,10 +49,10 @@ func DeserializeOBJ(value string) []OBJObject {
 	d := gob.NewDecoder(&b)
 	err = d.Decode(&objects)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return objects
+	return objects, nil
 }
 
 type Mesh struct {
@@ -69,19 +68,26 @@ type Sparse struct {
 	UVs      []float32
 }
 
-func addFace(a *int, b *int, c *int, d *int, ua *int, ub *int, uc *int, ud *int, na *int, nb *int, nc *int, nd *int, mesh *Mesh) {
+func addFace(a *int, b *int, c *int, d *int, ua *int, ub *int, uc *int, ud *int, na *int, nb *int, nc *int, nd *int, mesh *Mesh) error {
 	vLen := len(mesh.Sparse.Vertices)
 
 	ia := parseVertexIndex((*a), vLen)
 	ib := parseVertexIndex((*b), vLen)
 	ic := parseVertexIndex((*c), vLen)
 
+	if err := checkIndices(vLen, 3, "vertex", ia, ib, ic); err != nil {
+		return err
+	}
+
 	if d == nil {
 		addVertex(ia, ib, ic, mesh)
 
 	} else {
 
 		id := parseVertexIndex((*d), vLen)
+		if err := checkIndices(vLen, 3, "vertex", id); err != nil {
+			return err
+		}
 		addVertex(ia, ib, id, mesh)
 		addVertex(ib, ic, id, mesh)
 	}
@@ -94,11 +100,18 @@ func addFace(a *int, b *int, c *int, d *int, ua *int, ub *int, uc *int, ud *int,
 		ib := parseUVIndex((*ub), uvLen)
 		ic := parseUVIndex((*uc), uvLen)
 
+		if err := checkIndices(uvLen, 2, "uv", ia, ib, ic); err != nil {
+			return err
+		}
+
 		if d == nil {
 			//add uv call
 			addUV(ia, ib, ic, mesh)
 		} else {
 			id := parseUVIndex((*ud), uvLen)
+			if err := checkIndices(uvLen, 2, "uv", id); err != nil {
+				return err
+			}
 
 			addUV(ia, ib, id, mesh)
 			addUV(ib, ic, id, mesh)
@@ -122,16 +135,34 @@ func addFace(a *int, b *int, c *int, d *int, ua *int, ub *int, uc *int, ud *int,
 			ic = parseVertexIndex((*nc), nLen)
 		}
 
+		if err := checkIndices(len(mesh.Sparse.Normals), 3, "normal", ia, ib, ic); err != nil {
+			return err
+		}
+
 		if d == nil {
 			addNormal(ia, ib, ic, mesh)
 		} else {
 			id := parseVertexIndex((*nd), nLen)
+			if err := checkIndices(len(mesh.Sparse.Normals), 3, "normal", id); err != nil {
+				return err
+			}
 
 			addNormal(ia, ib, id, mesh)
 			addNormal(ib, ic, id, mesh)
 		}
 	}
 
+	return nil
+}
+
+// checkIndices - makes sure face indices point inside the sparse arrays they index into
+func checkIndices(length int, stride int, kind string, indices ...int) error {
+	for _, i := range indices {
+		if i < 0 || i+stride > length {
+			return fmt.Errorf("face references %s %d but only %d are defined", kind, i/stride+1, length/stride)
+		}
+	}
+	return nil
 }
 
 func addLineGeometry(vertices []float32, uvs []float32, mesh *Mesh) {
@@ -198,10 +229,11 @@ func parseVertexIndex(value int, len int) int {
 	return (int(value) + len/3) * 3
 }
 
-func Parse(filePath string) []OBJObject {
+// Parse - reads an OBJ file into objects split by material, malformed lines are reported as a *ParseError
+func Parse(filePath string) ([]OBJObject, error) {
 	objFile, err := os.Open(filePath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	defer objFile.Close()
@@ -212,9 +244,11 @@ func Parse(filePath string) []OBJObject {
 	objects = append(objects, OBJObject{})
 	mtlLib := ""
 
+	lineNumber := 0
 	scanner := bufio.NewScanner(objFile)
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNumber++
 
 		if len(line) == 0 {
 			continue
@@ -224,126 +258,84 @@ func Parse(filePath string) []OBJObject {
 			continue
 		}
 
-		if line[0] == 'v' {
+		if line[0] == 'v' && len(line) > 1 {
 			if line[1] == ' ' {
-				result := strings.Fields(line)
-				for i := 1; i < 4; i++ {
-					if s, err := strconv.ParseFloat(result[i], 32); err == nil {
-						//fmt.Println(len(objects), objectCount)
-						objects[objectCount].Geometry.Sparse.Vertices = append(objects[objectCount].Geometry.Sparse.Vertices, float32(s))
-					}
+				values, err := parseFloats(strings.Fields(line), 3)
+				if err != nil {
+					return nil, &ParseError{File: filePath, Line: lineNumber, Err: err}
 				}
+				objects[objectCount].Geometry.Sparse.Vertices = append(objects[objectCount].Geometry.Sparse.Vertices, values...)
 			} else if line[1] == 'n' {
-				result := strings.Fields(line)
-				for i := 1; i < 4; i++ {
-					if s, err := strconv.ParseFloat(result[i], 32); err == nil {
-						objects[objectCount].Geometry.Sparse.Normals = append(objects[objectCount].Geometry.Sparse.Normals, float32(s))
-					}
+				values, err := parseFloats(strings.Fields(line), 3)
+				if err != nil {
+					return nil, &ParseError{File: filePath, Line: lineNumber, Err: err}
 				}
+				objects[objectCount].Geometry.Sparse.Normals = append(objects[objectCount].Geometry.Sparse.Normals, values...)
 			} else if line[1] == 't' {
-				result := strings.Fields(line)
-				for i := 1; i < 3; i++ {
-					if s, err := strconv.ParseFloat(result[i], 32); err == nil {
-						objects[objectCount].Geometry.Sparse.UVs = append(objects[objectCount].Geometry.Sparse.UVs, float32(s))
-					}
+				values, err := parseFloats(strings.Fields(line), 2)
+				if err != nil {
+					return nil, &ParseError{File: filePath, Line: lineNumber, Err: err}
 				}
+				objects[objectCount].Geometry.Sparse.UVs = append(objects[objectCount].Geometry.Sparse.UVs, values...)
 			}
 		} else if line[0] == 'f' {
+			var faceErr error
 			//means we have f vertex/uv/normal vertex/uv/normal vertex/uv/normal
 			if result, err := regexp.MatchString(`^f\s+(-?\d+)\/(-?\d+)\/(-?\d+)\s+(-?\d+)\/(-?\d+)\/(-?\d+)\s+(-?\d+)\/(-?\d+)\/(-?\d+)(?:\s+(-?\d+)\/(-?\d+)\/(-?\d+))?`, line); err == nil && result {
-
-				//split on whitespace first
-				whiteSpaceSplit := strings.Split(line, " ")
-				var values []int
-
-				//now iterate through the 3 values and pull the values out
-				for i := 1; i < len(whiteSpaceSplit); i++ {
-					slashSplit := strings.Split(whiteSpaceSplit[i], "/")
-					for j := 0; j < len(slashSplit); j++ {
-						if s, err := strconv.ParseInt(slashSplit[j], 10, 32); err == nil {
-							values = append(values, int(s))
-						}
-					}
-				}
-
-				//check if the last three values are nil
-				if len(values) == 9 {
-					addFace(
-						&values[0], &values[3], &values[6], nil,
-						&values[1], &values[4], &values[7], nil,
-						&values[2], &values[5], &values[8], nil,
-						&objects[objectCount].Geometry)
-
-				} else {
-					addFace(
-						&values[0], &values[3], &values[6], &values[9],
-						&values[1], &values[4], &values[7], &values[10],
-						&values[2], &values[5], &values[8], &values[11],
+				values := parseFaceValues(line)
+				faceErr = checkFaceValues(values, 3)
+				if faceErr == nil {
+					faceErr = addFace(
+						&values[0], &values[3], &values[6], valueAt(values, 9),
+						&values[1], &values[4], &values[7], valueAt(values, 10),
+						&values[2], &values[5], &values[8], valueAt(values, 11),
 						&objects[objectCount].Geometry)
 				}
+
 				//means we have f vertex/uv vertex/uv vertex/uv
 			} else if result, err := regexp.MatchString(`^f\s+(-?\d+)\/(-?\d+)\s+(-?\d+)\/(-?\d+)\s+(-?\d+)\/(-?\d+)(?:\s+(-?\d+)\/(-?\d+))?`, line); err == nil && result {
-
-				//split on whitespace first
-				whiteSpaceSplit := strings.Split(line, " ")
-				var values []int
-
-				//now iterate through the 3 values and pull the values out
-				for i := 1; i < len(whiteSpaceSplit); i++ {
-					slashSplit := strings.Split(whiteSpaceSplit[i], "/")
-					for j := 0; j < len(slashSplit); j++ {
-						if s, err := strconv.ParseInt(slashSplit[j], 10, 32); err == nil {
-							values = append(values, int(s))
-						}
-					}
+				values := parseFaceValues(line)
+				faceErr = checkFaceValues(values, 2)
+				if faceErr == nil {
+					faceErr = addFace(
+						&values[0], &values[2], &values[4], valueAt(values, 6),
+						&values[1], &values[3], &values[5], valueAt(values, 7),
+						nil, nil, nil, nil,
+						&objects[objectCount].Geometry)
 				}
-				addFace(
-					&values[0], &values[2], &values[4], &values[6],
-					&values[1], &values[3], &values[5], &values[7],
-					nil, nil, nil, nil,
-					&objects[objectCount].Geometry)
 
 				//means we have f vertex//normal vertex//normal vertex//normal
 			} else if result, err := regexp.MatchString(`^f\s+(-?\d+)\/\/(-?\d+)\s+(-?\d+)\/\/(-?\d+)\s+(-?\d+)\/\/(-?\d+)(?:\s+(-?\d+)\/\/(-?\d+))?`, line); err == nil && result {
-
-				//split on whitespace first
-				whiteSpaceSplit := strings.Split(line, " ")
-				var values []int
-
-				//now iterate through the 3 values and pull the values out
-				for i := 1; i < len(whiteSpaceSplit); i++ {
-					slashSplit := strings.Split(whiteSpaceSplit[i], "/")
-					for j := 0; j < len(slashSplit); j++ {
-						if s, err := strconv.ParseInt(slashSplit[j], 10, 32); err == nil {
-							values = append(values, int(s))
-						}
-					}
+				values := parseFaceValues(line)
+				faceErr = checkFaceValues(values, 2)
+				if faceErr == nil {
+					faceErr = addFace(
+						&values[0], &values[2], &values[4], nil,
+						nil, nil, nil, nil,
+						&values[1], &values[3], &values[5], nil,
+						&objects[objectCount].Geometry)
 				}
-				addFace(
-					&values[0], &values[2], &values[4], nil,
-					nil, nil, nil, nil,
-					&values[1], &values[3], &values[5], nil,
-					&objects[objectCount].Geometry)
 
 				//means we have f vertex vertex vertex
 			} else if result, err := regexp.MatchString(`^f\s+(-?\d+)\s+(-?\d+)\s+(-?\d+)(?:\s+(-?\d+))?`, line); err == nil && result {
-
-				whiteSpaceSplit := strings.Split(line, " ")
-				var values []int
-
-				for i := 1; i < len(whiteSpaceSplit); i++ {
-					if s, err := strconv.ParseInt(whiteSpaceSplit[i], 10, 32); err == nil {
-						values = append(values, int(s))
-					}
+				values := parseFaceValues(line)
+				faceErr = checkFaceValues(values, 1)
+				if faceErr == nil {
+					faceErr = addFace(
+						&values[0], &values[1], &values[2], valueAt(values, 3),
+						nil, nil, nil, nil,
+						&values[0], &values[1], &values[2], valueAt(values, 3),
+						&objects[objectCount].Geometry)
 				}
-				addFace(
-					&values[0], &values[1], &values[2], &values[3],
-					nil, nil, nil, nil,
-					&values[0], &values[1], &values[2], &values[3],
-					&objects[objectCount].Geometry)
+			} else {
+				faceErr = fmt.Errorf("unsupported face format %q", line)
+			}
 
-				//check for object
+			if faceErr != nil {
+				return nil, &ParseError{File: filePath, Line: lineNumber, Err: faceErr}
 			}
+
+			//check for object
 		} else if result, err := regexp.MatchString(`^[og]\s*(.+)?`, line); err == nil && result {
 			whiteSpaceSplit := strings.Split(line, " ")
 
@@ -356,9 +348,7 @@ func Parse(filePath string) []OBJObject {
 				objectCount = len(objects) - 1
 				objects[objectCount].Name = whiteSpaceSplit[1]
 			} else {
-				if len(objects[objectCount].Materials) > 0 {
-					objects[objectCount].Materials[materialCount-1].End = len(objects[objectCount].Geometry.Vertices) / 3
-				}
+				closeMaterials(&objects[objectCount], materialCount, mtlLib)
 
 				materialCount = 0
 				//create a new object and increment counters
@@ -417,7 +407,7 @@ func Parse(filePath string) []OBJObject {
 					fmt.Println(whiteSpaceSplit[i])
 					val, err := strconv.ParseFloat(whiteSpaceSplit[i], 32)
 					if err != nil {
-						panic(err)
+						return nil, &ParseError{File: filePath, Line: lineNumber, Err: err}
 					}
 
 					Vertices = append(Vertices, float32(val))
@@ -432,7 +422,72 @@ func Parse(filePath string) []OBJObject {
 			addLineGeometry(Vertices, UVs, &objects[objectCount].Geometry)
 		}
 	}
-	objects[objectCount].Materials[materialCount-1].End = len(objects[objectCount].Geometry.Vertices) / 3
+	if err := scanner.Err(); err != nil {
+		return nil, &ParseError{File: filePath, Line: lineNumber, Err: err}
+	}
+
+	closeMaterials(&objects[objectCount], materialCount, mtlLib)
 
-	return objects
+	return objects, nil
+}
+
+// closeMaterials - ends the last material range of an object, objects without any usemtl get
+// a single unnamed material covering all of their faces so they still get loaded
+func closeMaterials(object *OBJObject, materialCount int, mtlLib string) {
+	if materialCount > 0 && len(object.Materials) >= materialCount {
+		object.Materials[materialCount-1].End = len(object.Geometry.Vertices) / 3
+	} else if len(object.Materials) == 0 && len(object.Geometry.Vertices) > 0 {
+		object.Materials = append(object.Materials, MTLMaterial{
+			MTLLib: mtlLib,
+			Start:  0,
+			End:    len(object.Geometry.Vertices) / 3,
+		})
+	}
+}
+
+// parseFloats - parses the n floats following the keyword of an OBJ or MTL statement such as "v 1 2 3"
+func parseFloats(fields []string, n int) ([]float32, error) {
+	if len(fields) < n+1 {
+		return nil, fmt.Errorf("expected %d values after %q, found %d", n, fields[0], len(fields)-1)
+	}
+
+	values := make([]float32, n)
+	for i := 0; i < n; i++ {
+		f, err := strconv.ParseFloat(fields[i+1], 32)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = float32(f)
+	}
+	return values, nil
+}
+
+// parseFaceValues - pulls every index out of a face statement, "f 1/2/3 4/5/6 7/8/9" gives 1 to 9 in order
+func parseFaceValues(line string) []int {
+	var values []int
+	fields := strings.Fields(line)
+	for i := 1; i < len(fields); i++ {
+		for _, index := range strings.Split(fields[i], "/") {
+			if s, err := strconv.ParseInt(index, 10, 32); err == nil {
+				values = append(values, int(s))
+			}
+		}
+	}
+	return values
+}
+
+// checkFaceValues - makes sure a face has either 3 or 4 corners with perCorner indices each
+func checkFaceValues(values []int, perCorner int) error {
+	if len(values) != 3*perCorner && len(values) != 4*perCorner {
+		return fmt.Errorf("face needs 3 or 4 corners of %d indices, found %d indices", perCorner, len(values))
+	}
+	return nil
+}
+
+// valueAt - pointer to values[i], nil when the face is a triangle and has no fourth corner
+func valueAt(values []int, i int) *int {
+	if i < len(values) {
+		return &values[i]
+	}
+	return nil
 }
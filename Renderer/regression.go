@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"./geometry"
+	"./globals"
+	"./golden"
+	"./headless"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+)
+
+// goldenOptions - settings for a golden image regression run
+type goldenOptions struct {
+	ReferenceDir string
+	OutputDir    string
+	Frames       int
+	Tolerance    uint8
+	MaxBadRatio  float64
+	Update       bool
+	Load         geometry.LoadOptions
+}
+
+// goldenRenderer - the passes a golden run renders every scene with, made once for the whole run
+type goldenRenderer struct {
+	hdr          *geometry.HDRPipeline
+	deferred     *geometry.DeferredRenderer
+	transparency *geometry.TransparencyPass
+	ssao         *geometry.SSAOPass
+	mirrors      *geometry.MirrorPass
+}
+
+// runGolden - renders every scene file offscreen and compares it against the reference PNG of the same name.
+// Failing scenes get <name>.actual.png and <name>.diff.png written to the output directory.
+// Returns the number of scenes that failed.
+func runGolden(scenes []string, opts goldenOptions) (int, error) {
+	ctx, err := headless.NewContext(globals.Width, globals.Height)
+	if err != nil {
+		return 0, err
+	}
+	defer ctx.Destroy()
+
+	renderer, err := newGoldenRenderer()
+	if err != nil {
+		return 0, err
+	}
+	defer renderer.delete()
+
+	failures := 0
+	for _, scenePath := range scenes {
+		message, passed, err := renderer.check(scenePath, opts)
+		if err != nil {
+			return failures, err
+		}
+		fmt.Println(message)
+		if !passed {
+			failures++
+		}
+	}
+
+	return failures, nil
+}
+
+// newGoldenRenderer - makes the passes of a golden run, with the run's context current
+func newGoldenRenderer() (*goldenRenderer, error) {
+	if err := gl.Init(); err != nil {
+		return nil, err
+	}
+	if err := geometry.SetupTextureUnits(); err != nil {
+		return nil, err
+	}
+
+	hdr, err := geometry.NewHDRPipeline(0)
+	if err != nil {
+		return nil, err
+	}
+	return &goldenRenderer{
+		hdr:          hdr,
+		deferred:     geometry.NewDeferredRenderer(),
+		transparency: geometry.NewTransparencyPass(),
+		ssao:         geometry.NewSSAOPass(),
+		mirrors:      geometry.NewMirrorPass(),
+	}, nil
+}
+
+// delete - frees the passes
+func (r *goldenRenderer) delete() {
+	r.mirrors.Delete()
+	r.ssao.Delete()
+	r.transparency.Delete()
+	r.deferred.Delete()
+	r.hdr.Delete()
+}
+
+// check - renders one scene file and compares it against its reference, or replaces the reference with opts.Update.
+// Returns a line saying how it went and whether the scene passed, the error is for output that couldn't be written
+func (r *goldenRenderer) check(scenePath string, opts goldenOptions) (string, bool, error) {
+	name := strings.TrimSuffix(filepath.Base(scenePath), filepath.Ext(scenePath))
+	refPath := filepath.Join(opts.ReferenceDir, name+".png")
+	actualPath := filepath.Join(opts.OutputDir, name+".actual.png")
+
+	img, err := renderSceneImage(scenePath, r.hdr, r.deferred, r.transparency, r.ssao, r.mirrors, opts.Frames, opts.Load)
+	if err != nil {
+		return fmt.Sprintf("FAIL %s: %v", name, err), false, nil
+	}
+
+	if opts.Update {
+		if err := golden.SavePNG(refPath, img); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("UPDATED %s", refPath), true, nil
+	}
+
+	want, err := golden.LoadPNG(refPath)
+	if err != nil {
+		golden.SavePNG(actualPath, img)
+		return fmt.Sprintf("FAIL %s: no reference image (%v), run with -update to create it", name, err), false, nil
+	}
+
+	result, err := golden.Compare(img, want, opts.Tolerance)
+	if err != nil {
+		golden.SavePNG(actualPath, img)
+		return fmt.Sprintf("FAIL %s: %v", name, err), false, nil
+	}
+
+	if result.Passed(opts.MaxBadRatio) {
+		return fmt.Sprintf("PASS %s (max channel diff %d)", name, result.MaxDiff), true, nil
+	}
+
+	if err := golden.SavePNG(actualPath, img); err != nil {
+		return "", false, err
+	}
+	if err := golden.SavePNG(filepath.Join(opts.OutputDir, name+".diff.png"), result.Diff); err != nil {
+		return "", false, err
+	}
+	return fmt.Sprintf("FAIL %s: %d of %d pixels differ by more than %d (max channel diff %d)",
+		name, result.Mismatched, result.Total, opts.Tolerance, result.MaxDiff), false, nil
+}
+
+// renderSceneImage - renders one scene file from its settings camera, turning panics into errors so one broken scene doesn't stop the run
+func renderSceneImage(statePath string, hdr *geometry.HDRPipeline, deferred *geometry.DeferredRenderer, transparency *geometry.TransparencyPass, ssao *geometry.SSAOPass, mirrors *geometry.MirrorPass, frames int, load geometry.LoadOptions) (img *image.RGBA, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("render panicked: %v", r)
+		}
+	}()
+
+	state := newState()
+	defer state.UnloadScene()
+
+	target, err := renderOffscreen(statePath, &state, hdr, deferred, transparency, ssao, mirrors, frames, load)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Delete()
+
+	return target.ReadPixels(), nil
+}
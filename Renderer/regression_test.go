@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"./geometry"
+	"./globals"
+	"./headless"
+)
+
+// size the references in golden/reference are rendered at, by make golden-update
+const (
+	goldenWidth  = 320
+	goldenHeight = 240
+)
+
+// TestGolden - renders every scene in golden/scenes and compares it against its reference, like make golden. The
+// references are llvmpipe renders, so run it with LIBGL_ALWAYS_SOFTWARE=1, and with -tags egl where there is no
+// display. A scene with a model or skybox that doesn't load fails. Skipped when no OpenGL context can be made
+func TestGolden(t *testing.T) {
+	scenes, err := filepath.Glob("golden/scenes/*.json")
+	if err != nil || len(scenes) == 0 {
+		t.Fatalf("no scene files found: %v", err)
+	}
+
+	//the context is current on this thread only, so the scenes aren't run as subtests
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	//models are found next to the binary otherwise, which go test builds in a temporary directory
+	geometry.ModelRoot, err = os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { geometry.ModelRoot = "" }()
+
+	globals.Width, globals.Height = goldenWidth, goldenHeight
+	ctx, err := headless.NewContext(globals.Width, globals.Height)
+	if err != nil {
+		t.Skipf("no OpenGL context: %v", err)
+	}
+	defer ctx.Destroy()
+
+	renderer, err := newGoldenRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.delete()
+
+	opts := goldenOptions{
+		ReferenceDir: "golden/reference",
+		OutputDir:    "golden/output",
+		Frames:       1,
+		Tolerance:    2,
+		Load:         geometry.LoadOptions{Policy: geometry.LoadAbort},
+	}
+	for _, scenePath := range scenes {
+		message, passed, err := renderer.check(scenePath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !passed {
+			t.Error(message)
+		}
+	}
+}
@@ -31,6 +31,7 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	out vec3 oNormal;
 	out vec3 normalInterp;
 	out vec3 oFragPosition;
+	out float oViewDepth;
 	out vec2 oUV;
 	out vec3 oCamPosition;
 	out vec3 oBitangent;
@@ -39,18 +40,18 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	uniform vec3 cameraPosition;
 	uniform mat4 uProjectionMatrix;
 	uniform mat4 uViewMatrix;
-	uniform mat4 uModelMatrix;
+` + instancing + `
 
 	void main() {
-		mat4 normalMatrix = transpose(inverse(uModelMatrix));
-		oNormal = normalize((uModelMatrix * vec4(aNormal, 1.0)).xyz);
-		normalInterp = vec3(normalMatrix * vec4(aNormal, 0.0));
-		oFragPosition = (uModelMatrix * vec4(aPosition, 1.0)).xyz;
+		oNormal = normalize((ModelMatrix() * vec4(aNormal, 1.0)).xyz);
+		normalInterp = NormalMatrix() * aNormal;
+		oFragPosition = (ModelMatrix() * vec4(aPosition, 1.0)).xyz;
+		oViewDepth = -(uViewMatrix * vec4(oFragPosition, 1.0)).z;
 		oUV = -aUV;
 		oCamPosition =  (uViewMatrix * vec4(cameraPosition, 1.0)).xyz;
 		oBitangent = aBitangent;
 		oTangent = aTangent;
-		gl_Position = uProjectionMatrix * uViewMatrix * uModelMatrix * vec4(aPosition, 1.0); 
+		gl_Position = uProjectionMatrix * uViewMatrix * ModelMatrix() * vec4(aPosition, 1.0); 
 	}
 ` + "\x00"
 
@@ -59,21 +60,9 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	s.fragShader = `
 	#version 410
 	precision highp float;
-	#define MAX_LIGHTS 20
-
-	struct PointLight {
-		vec3 position;
-		float strength;
-		float constant;
-		float linear;
-		float quadratic; 
-		float farPlane;
-		int shadow;
-		vec3 color;
-		samplerCube depthMap;
-	};
-
+` + lightsBlock() + shadowFunctions + `
 	in vec3 oFragPosition;
+	in float oViewDepth;
 	in vec3 normalInterp;
 	in vec3 oNormal;
 	in vec3 oCamPosition;
@@ -85,8 +74,6 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	uniform vec3 ambientVal;
 	uniform vec3 specularVal;
 	uniform float nVal;
-	uniform int numPointLights;
-	uniform int numDirLights;
 	uniform float Alpha;
 	uniform int skyboxPresent;
 	uniform int reflective; //0 = nonreflective, 1 = reflective, 2 = refractive
@@ -95,50 +82,24 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	uniform vec3 cameraPosition;
 	uniform sampler2D uDiffuseTexture;
 	uniform sampler2D uNormalTexture;
-	uniform PointLight pointLights[MAX_LIGHTS];
-
-	out vec4 frag_colour;
-
-	// array of offset direction for sampling
-	vec3 gridSamplingDisk[20] = vec3[]
-	(
-		vec3(1, 1,  1), vec3( 1, -1,  1), vec3(-1, -1,  1), vec3(-1, 1,  1), 
-		vec3(1, 1, -1), vec3( 1, -1, -1), vec3(-1, -1, -1), vec3(-1, 1, -1),
-		vec3(1, 1,  0), vec3( 1, -1,  0), vec3(-1, -1,  0), vec3(-1, 1,  0),
-		vec3(1, 0,  1), vec3(-1,  0,  1), vec3( 1,  0, -1), vec3(-1, 0, -1),
-		vec3(0, 1,  1), vec3( 0, -1,  1), vec3( 0, -1, -1), vec3( 0, 1, -1)
-	);
 
-	float ShadowCalculation(vec3 fragPos, PointLight light)
+` + transparencyOutput + ambientOcclusion + environmentLighting + reflectionProbe + planarMirror + `
+	vec3 CalcDirLight(DirectionalLight light, sampler2DArray depthMap, vec3 normal, vec3 viewDir, vec3 textureVal)
 	{
-		vec3 fragToLight = fragPos - light.position;
-		//float far_plane = 50;
-		float currentDepth = length(fragToLight);
-
-		float shadow = 0.0;
-		float bias = 0.5;
-		int samples = 20;
-		float viewDistance = length(oCamPosition - fragPos);
-		float diskRadius = (1.0 + (viewDistance / light.farPlane)) /25.0;
-
-		for(int i = 0; i < samples; ++i)
-		{
-			float closestDepth = texture(light.depthMap, fragToLight + gridSamplingDisk[i] * diskRadius).r;
-			closestDepth *= light.farPlane;   // undo mapping [0;1]
-			if(currentDepth - bias > closestDepth)
-				shadow += 1.0;
-		}
-		shadow /= float(samples);
-
-		return shadow;
+		vec3 lightDir = -light.direction;
+		float shadow = DirShadowCalculation(light, depthMap, oFragPosition, oViewDepth, normalize(normalInterp), lightDir);
+		float diff = max(dot(normal, lightDir), 0.0);
+		vec3 reflectDir = reflect(-lightDir, normal);
+		float spec = pow(max(dot(viewDir, reflectDir), 0.0), nVal);
+		vec3 ambient = light.color * ambientVal * diffuseVal * textureVal * occlusion * LightAmbient();
+		vec3 diffuse = light.color * diff * diffuseVal * textureVal;
+		vec3 specular = light.color * specularVal * spec * textureVal;
+		return light.strength * (ambient + (1.0 - shadow) * (diffuse + specular));
 	}
 
-	vec3 CalcPointLight(PointLight light, vec3 normal, vec3 fragPos, vec3 viewDir, vec3 textureVal) 
+	vec3 CalcPointLight(PointLight light, int shadowSlot, vec3 normal, vec3 fragPos, vec3 viewDir, vec3 textureVal) 
 	{
-		float shadow;
-		if (light.shadow == 1) {
-			shadow = ShadowCalculation(oFragPosition, light);
-		}
+		float shadow = PointShadow(light, shadowSlot, oFragPosition, normalize(normalInterp));
 		
 		vec3 lightDir = normalize(light.position - fragPos);
 		// diffuse shading
@@ -152,7 +113,7 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 					light.quadratic * (distance * distance));    
 		
 		// combine results
-		vec3 ambient  = ambientVal * textureVal * diffuseVal;
+		vec3 ambient  = ambientVal * textureVal * diffuseVal * occlusion * LightAmbient();
 		vec3 diffuse  = light.color  * diff * diffuseVal * textureVal;
 
 		vec3 specular = vec3(0,0,0);
@@ -165,6 +126,7 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 	}
 
 	void main() {
+		occlusion = AmbientOcclusion();
 
 		vec3 regularNormal = normalize(normalInterp);
 		vec3 normal = texture(uNormalTexture, oUV).xyz;
@@ -178,29 +140,44 @@ func (s *BlinnDiffuseAndNormal) Setup() {
 
 		vec4 texColor = texture(uDiffuseTexture, oUV);
 
-		for (int i = 0; i < numPointLights; i++) {
-			result += CalcPointLight(pointLights[i], normal, oFragPosition, viewDir, texColor.xyz);
+		for (int i = 0; i < numShadowedPointLights; i++) {
+			if (InPointLightRange(i, oFragPosition)) {
+				result += CalcPointLight(FetchPointLight(i), i, normal, oFragPosition, viewDir, texColor.xyz);
+			}
+		}
+		//the clustered lights cast no shadows, so they have no shadow map slot
+		uvec2 cluster = LightCluster(gl_FragCoord.xy, oViewDepth);
+		for (uint i = 0u; i < cluster.y; i++) {
+			result += CalcPointLight(FetchPointLight(ClusterLight(cluster, i)), -1, normal, oFragPosition, viewDir, texColor.xyz);
 		}
+		for (int i = 0; i < numDirLights; i++) {
+			result += CalcDirLight(dirLights[i], dirShadowMaps[i], normal, viewDir, texColor.xyz);
+		}
+
+		//with a skybox the sky lights the surface in place of the lights' ambient term
+		result += BlinnEnvironment(normal, normalize(cameraPosition - oFragPosition), diffuseVal * texColor.rgb, specularVal * texColor.rgb, nVal) * occlusion;
 
 		vec3 skyRef;
 
-		if (skyboxPresent == 1 && reflective == 1) {
+		if (HasReflection() && reflective == 1) {
 			vec3 I = normalize(oFragPosition - cameraPosition);
 			vec3 R = reflect(I, normal);
-			skyRef = texture(skybox, R).rgb;
+			skyRef = SceneReflection(oFragPosition, R);
 			result *= skyRef;
-		} else if (skyboxPresent == 1 && reflective == 2 && refractiveIndex != 0) {
+		} else if (HasReflection() && reflective == 2 && refractiveIndex != 0) {
 			float ratio = 1.00 / refractiveIndex;
     		vec3 I = normalize(oFragPosition - cameraPosition);
 			vec3 R = refract(I, normal, ratio);
-			skyRef = texture(skybox, R).rgb;
+			skyRef = SceneReflection(oFragPosition, R);
 			result *= skyRef;
 		}
 
 		if (texColor.w < 0.1) {
 			discard;
 		}
-		frag_colour = vec4(result, Alpha);
+		//the normal map ripples the reflection
+		result = MirrorReflection(result, texture(uNormalTexture, oUV).xy * 2.0 - 1.0);
+		WriteFragment(result, Alpha);
 	}
 	` + "\x00"
 }
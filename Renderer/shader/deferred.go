@@ -0,0 +1,445 @@
+package shader
+
+// gBufferDefines - shading models, kept in the alpha of the albedo target. Pixels no object covered stay at
+// SHADING_NONE and are left to the background
+const gBufferDefines = `
+	#define SHADING_NONE 0
+	#define SHADING_BLINN 1
+	#define SHADING_PBR 2
+`
+
+// normalEncoding - packs a unit normal into two numbers by folding the octahedron around it flat, so one target
+// holds both normals of a pixel
+const normalEncoding = `
+	vec2 SignNotZero(vec2 v)
+	{
+		return vec2(v.x >= 0.0 ? 1.0 : -1.0, v.y >= 0.0 ? 1.0 : -1.0);
+	}
+
+	vec2 EncodeNormal(vec3 n)
+	{
+		n /= abs(n.x) + abs(n.y) + abs(n.z);
+		return n.z >= 0.0 ? n.xy : (1.0 - abs(n.yx)) * SignNotZero(n.xy);
+	}
+
+	vec3 DecodeNormal(vec2 e)
+	{
+		vec3 n = vec3(e, 1.0 - abs(e.x) - abs(e.y));
+		if (n.z < 0.0) {
+			n.xy = (1.0 - abs(n.yx)) * SignNotZero(n.xy);
+		}
+		return normalize(n);
+	}
+`
+
+// GBufferShader - writes the surface of the opaque lit objects into the G-buffer instead of lighting them. One
+// program covers the Blinn shader types and PBR, shadingModel and textureMaps pick what the object has, and each
+// part is worked out the way the forward shader of its type does it
+type GBufferShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s GBufferShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s GBufferShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s GBufferShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *GBufferShader) Setup() {
+	s.vertShader = `
+	#version 410
+` + gBufferDefines + `
+	layout (location = 0) in vec3 aPosition;
+	layout (location = 1) in vec3 aNormal;
+	layout (location = 2) in vec2 aUV;
+	layout (location = 3) in vec3 aTangent;
+	layout (location = 4) in vec3 aBitangent;
+
+	out vec3 oNormal;
+	out vec3 normalInterp;
+	out vec3 oFragPosition;
+	out float oViewDepth;
+	out vec2 oUV;
+	out vec3 oBitangent;
+
+	uniform mat4 uProjectionMatrix;
+	uniform mat4 uViewMatrix;
+` + instancing + `
+	uniform int shadingModel;
+
+	void main() {
+		oNormal = normalize((ModelMatrix() * vec4(aNormal, 1.0)).xyz);
+		normalInterp = NormalMatrix() * aNormal;
+		oFragPosition = (ModelMatrix() * vec4(aPosition, 1.0)).xyz;
+		oViewDepth = -(uViewMatrix * vec4(oFragPosition, 1.0)).z;
+		oUV = shadingModel == SHADING_PBR ? vec2(aUV.x, 1.0 - aUV.y) : -aUV;
+		oBitangent = aBitangent;
+		gl_Position = uProjectionMatrix * uViewMatrix * vec4(oFragPosition, 1.0);
+	}
+` + "\x00"
+
+	s.geoShader = ""
+
+	s.fragShader = `
+	#version 410
+	precision highp float;
+` + gBufferDefines + pbrMapBits + brdfFunctions + normalEncoding + ambientOcclusion + `
+	in vec3 oNormal;
+	in vec3 normalInterp;
+	in vec3 oFragPosition;
+	in float oViewDepth;
+	in vec2 oUV;
+	in vec3 oBitangent;
+
+	uniform int shadingModel;
+	uniform int textureMaps;
+	uniform vec3 diffuseVal;
+	uniform vec3 ambientVal;
+	uniform vec3 specularVal;
+	uniform float nVal;
+	uniform vec3 baseColorVal;
+	uniform float metallicVal;
+	uniform float roughnessVal;
+	uniform float aoVal;
+	uniform vec3 emissiveVal;
+	uniform sampler2D uDiffuseTexture;
+	uniform sampler2D uNormalTexture;
+	uniform sampler2D uMetallicRoughnessTexture;
+	uniform sampler2D uOcclusionTexture;
+	uniform sampler2D uEmissiveTexture;
+	uniform int skyboxPresent;
+	uniform int reflective; //0 = nonreflective, 1 = reflective, 2 = refractive
+	uniform float refractiveIndex;
+	uniform samplerCube skybox;
+	uniform vec3 cameraPosition;
+` + environmentLighting + pbrEnvironment + reflectionProbe + `
+	layout (location = 0) out vec4 gPosition; //world position, view depth
+	layout (location = 1) out vec4 gNormal; //shading normal, geometry normal
+	layout (location = 2) out vec4 gAlbedo; //diffuse or base colour, shading model
+	layout (location = 3) out vec4 gMaterial; //Blinn: specular colour and n, PBR: metallic and roughness
+	layout (location = 4) out vec4 gAmbient; //colour the ambient term of every light is tinted by
+	layout (location = 5) out vec4 gEmission; //light that doesn't come from the scene's lights
+
+	bool HasMap(int bit)
+	{
+		return (textureMaps & bit) != 0;
+	}
+` + perturbNormalFunction + `
+	void WriteBlinn()
+	{
+		vec4 texColor = vec4(1.0);
+		if (HasMap(BASE_COLOR_MAP)) {
+			texColor = texture(uDiffuseTexture, oUV);
+			if (texColor.a < 0.1) {
+				discard;
+			}
+		}
+
+		vec3 geometryNormal = normalize(normalInterp);
+		vec3 normal = geometryNormal;
+		if (HasMap(NORMAL_MAP)) {
+			//the tangent frame of BlinnDiffuseAndNormal
+			normal = normalize(2.0 * texture(uNormalTexture, oUV).xyz - 1.0) * 5.0;
+			vec3 biTangent = normalize(cross(oNormal, oBitangent));
+			normal = normalize(mat3(oBitangent, biTangent, oNormal) * normal);
+		}
+
+		//the forward shaders multiply everything they light by the scene seen in or through the surface
+		vec3 skyRef = vec3(1.0);
+		vec3 I = normalize(oFragPosition - cameraPosition);
+		if (HasReflection() && reflective == 1) {
+			skyRef = SceneReflection(oFragPosition, reflect(I, normal));
+		} else if (HasReflection() && reflective == 2 && refractiveIndex != 0.0) {
+			skyRef = SceneReflection(oFragPosition, refract(I, normal, 1.0 / refractiveIndex));
+		}
+
+		vec3 diffuse = diffuseVal * texColor.rgb * skyRef;
+		gNormal = vec4(EncodeNormal(normal), EncodeNormal(geometryNormal));
+		gAlbedo = vec4(diffuse, SHADING_BLINN);
+		vec3 specular = specularVal * texColor.rgb * skyRef;
+		gMaterial = vec4(specular, nVal);
+		gAmbient = vec4(ambientVal * diffuse * AmbientOcclusion() * LightAmbient(), 0.0);
+		gEmission = vec4(BlinnEnvironment(normal, -I, diffuse, specular, nVal) * AmbientOcclusion(), 0.0);
+	}
+
+	void WritePBR()
+	{
+		vec4 baseColor = vec4(baseColorVal, 1.0);
+		if (HasMap(BASE_COLOR_MAP)) {
+			baseColor *= texture(uDiffuseTexture, oUV);
+			if (baseColor.a < 0.1) {
+				discard;
+			}
+		}
+
+		Surface s;
+		s.albedo = baseColor.rgb;
+		s.metallic = metallicVal;
+		s.roughness = roughnessVal;
+		if (HasMap(METALLIC_ROUGHNESS_MAP)) {
+			vec4 mr = texture(uMetallicRoughnessTexture, oUV);
+			s.roughness *= mr.g;
+			s.metallic *= mr.b;
+		}
+		s.roughness = clamp(s.roughness, MIN_ROUGHNESS, 1.0);
+		s.metallic = clamp(s.metallic, 0.0, 1.0);
+		s.F0 = mix(vec3(0.04), s.albedo, s.metallic);
+
+		float ao = aoVal * AmbientOcclusion();
+		if (HasMap(OCCLUSION_MAP)) {
+			ao *= texture(uOcclusionTexture, oUV).r;
+		}
+
+		s.V = normalize(cameraPosition - oFragPosition);
+		vec3 geometryNormal = normalize(normalInterp);
+		if (dot(geometryNormal, s.V) < 0.0) {
+			geometryNormal = -geometryNormal;
+		}
+		s.N = geometryNormal;
+		if (HasMap(NORMAL_MAP)) {
+			s.N = PerturbNormal(geometryNormal, texture(uNormalTexture, oUV).xyz * 2.0 - 1.0);
+		}
+
+		vec3 emission = emissiveVal;
+		if (HasMap(EMISSIVE_MAP)) {
+			emission *= texture(uEmissiveTexture, oUV).rgb;
+		}
+		emission += PBREnvironment(s) * ao;
+
+		gNormal = vec4(EncodeNormal(s.N), EncodeNormal(geometryNormal));
+		gAlbedo = vec4(s.albedo, SHADING_PBR);
+		gMaterial = vec4(s.metallic, s.roughness, 0.0, 0.0);
+		gAmbient = vec4(ambientVal * s.albedo * ao * LightAmbient(), 0.0);
+		gEmission = vec4(emission, 0.0);
+	}
+
+	void main() {
+		gPosition = vec4(oFragPosition, oViewDepth);
+		if (shadingModel == SHADING_PBR) {
+			WritePBR();
+		} else {
+			WriteBlinn();
+		}
+	}
+` + "\x00"
+}
+
+// deferredLighting - reads the G-buffer and lights a pixel of it. The Blinn terms are the ones of BlinnDiffuseTexture
+// and the PBR ones those of PBR, so a scene looks the same with either renderer
+const deferredLighting = gBufferDefines + normalEncoding + `
+	uniform sampler2D gPosition;
+	uniform sampler2D gNormal;
+	uniform sampler2D gAlbedo;
+	uniform sampler2D gMaterial;
+	uniform sampler2D gAmbient;
+	uniform vec3 cameraPosition;
+
+	struct GSurface {
+		int model;
+		vec3 position;
+		float viewDepth;
+		vec3 normal;
+		vec3 geometryNormal;
+		vec3 albedo;
+		vec4 material;
+		vec3 ambient;
+	};
+
+	GSurface ReadGBuffer(ivec2 pixel)
+	{
+		GSurface g;
+		vec4 albedo = texelFetch(gAlbedo, pixel, 0);
+		g.model = int(albedo.a + 0.5);
+		g.albedo = albedo.rgb;
+		vec4 position = texelFetch(gPosition, pixel, 0);
+		g.position = position.xyz;
+		g.viewDepth = position.w;
+		vec4 normals = texelFetch(gNormal, pixel, 0);
+		g.normal = DecodeNormal(normals.xy);
+		g.geometryNormal = DecodeNormal(normals.zw);
+		g.material = texelFetch(gMaterial, pixel, 0);
+		g.ambient = texelFetch(gAmbient, pixel, 0).rgb;
+		return g;
+	}
+
+	Surface PBRSurface(GSurface g)
+	{
+		Surface s;
+		s.albedo = g.albedo;
+		s.metallic = g.material.r;
+		s.roughness = g.material.g;
+		s.F0 = mix(vec3(0.04), s.albedo, s.metallic);
+		s.N = g.normal;
+		s.V = normalize(cameraPosition - g.position);
+		return s;
+	}
+
+	//the forward Blinn shaders take the view direction from the camera position in view space, the origin
+	vec3 BlinnViewDir(GSurface g)
+	{
+		return normalize(-g.position);
+	}
+
+	vec3 DirLight(DirectionalLight light, sampler2DArray depthMap, GSurface g)
+	{
+		vec3 lightDir = -light.direction;
+		float shadow = DirShadowCalculation(light, depthMap, g.position, g.viewDepth, g.geometryNormal, lightDir);
+		if (g.model == SHADING_PBR) {
+			vec3 radiance = light.color * light.strength;
+			return (1.0 - shadow) * CookTorrance(PBRSurface(g), lightDir, radiance) + radiance * g.ambient;
+		}
+
+		float diff = max(dot(g.normal, lightDir), 0.0);
+		vec3 reflectDir = reflect(-lightDir, g.normal);
+		float spec = pow(max(dot(BlinnViewDir(g), reflectDir), 0.0), g.material.a);
+		vec3 ambient = light.color * g.ambient;
+		vec3 diffuse = light.color * diff * g.albedo;
+		vec3 specular = light.color * g.material.rgb * spec;
+		return light.strength * (ambient + (1.0 - shadow) * (diffuse + specular));
+	}
+
+	vec3 PointLightColor(PointLight light, samplerCube depthMap, GSurface g)
+	{
+		float shadow = 0.0;
+		if (light.shadow == 1) {
+			shadow = PointShadowCalculation(light, depthMap, g.position, g.geometryNormal);
+		}
+
+		vec3 toLight = light.position - g.position;
+		float distance = length(toLight);
+		vec3 lightDir = toLight / distance;
+		float attenuation = light.strength / (light.constant + light.linear * distance +
+			light.quadratic * distance * distance);
+
+		if (g.model == SHADING_PBR) {
+			vec3 radiance = light.color * attenuation;
+			return (1.0 - shadow) * CookTorrance(PBRSurface(g), lightDir, radiance) + radiance * g.ambient;
+		}
+
+		//point lights light Blinn surfaces whichever way they face
+		vec3 reflectDir = reflect(lightDir, g.normal);
+		float spec = pow(max(dot(BlinnViewDir(g), reflectDir), 0.0), g.material.a);
+		vec3 diffuse = light.color * g.albedo;
+		vec3 specular = light.color * g.material.rgb * spec;
+		return attenuation * (g.ambient + (1.0 - shadow) * (diffuse + specular));
+	}
+`
+
+// DeferredDirectionalShader - fullscreen pass lighting the G-buffer with the emission of each pixel and every
+// directional light. It writes every pixel an object covered, the point lights are added on top
+type DeferredDirectionalShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s DeferredDirectionalShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s DeferredDirectionalShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s DeferredDirectionalShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *DeferredDirectionalShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+` + lightsBlock() + shadowFunctions + brdfFunctions + deferredLighting + `
+	in vec2 oUV;
+
+	uniform sampler2D gEmission;
+
+	out vec4 frag_colour;
+
+	void main() {
+		ivec2 pixel = ivec2(gl_FragCoord.xy);
+		GSurface g = ReadGBuffer(pixel);
+		if (g.model == SHADING_NONE) {
+			discard;
+		}
+
+		vec3 result = texelFetch(gEmission, pixel, 0).rgb;
+		for (int i = 0; i < numDirLights; i++) {
+			result += DirLight(dirLights[i], dirShadowMaps[i], g);
+		}
+		frag_colour = vec4(result, 1.0);
+	}
+` + "\x00"
+}
+
+// DeferredPointLightShader - adds one point light to the pixels inside the sphere it reaches. The sphere is drawn
+// around the light, or the whole screen is covered for lights with no falloff
+type DeferredPointLightShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s DeferredPointLightShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s DeferredPointLightShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s DeferredPointLightShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *DeferredPointLightShader) Setup() {
+	s.vertShader = `
+	#version 410
+	layout (location = 0) in vec3 aPosition;
+
+	uniform mat4 uViewProjection;
+	uniform vec3 volumeCenter;
+	uniform float volumeRadius;
+	uniform int fullscreen;
+
+	void main() {
+		if (fullscreen == 1) {
+			vec2 corner = vec2((gl_VertexID << 1) & 2, gl_VertexID & 2);
+			gl_Position = vec4(corner * 2.0 - 1.0, 0.0, 1.0);
+			return;
+		}
+		gl_Position = uViewProjection * vec4(volumeCenter + aPosition * volumeRadius, 1.0);
+	}
+` + "\x00"
+
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+` + lightsBlock() + shadowFunctions + brdfFunctions + deferredLighting + `
+	uniform PointLight light;
+	uniform samplerCube shadowMap;
+	uniform float lightRange;
+
+	out vec4 frag_colour;
+
+	void main() {
+		ivec2 pixel = ivec2(gl_FragCoord.xy);
+		GSurface g = ReadGBuffer(pixel);
+		if (g.model == SHADING_NONE || length(light.position - g.position) > lightRange) {
+			discard;
+		}
+		frag_colour = vec4(PointLightColor(light, shadowMap, g), 0.0);
+	}
+` + "\x00"
+}
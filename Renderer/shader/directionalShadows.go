@@ -25,10 +25,10 @@ func (s *DirectionalShadow) Setup() {
 	layout (location = 0) in vec3 aPosition;
 
 	uniform mat4 lightSpaceMatrix;
-	uniform mat4 uModelMatrix;
+` + instancing + `
 
 	void main() {
-		gl_Position = lightSpaceMatrix * uModelMatrix * vec4(aPosition, 1.0);
+		gl_Position = lightSpaceMatrix * ModelMatrix() * vec4(aPosition, 1.0);
 	}
 ` + "\x00"
 	s.geoShader = ""
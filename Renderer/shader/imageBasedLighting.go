@@ -0,0 +1,360 @@
+package shader
+
+// environmentLighting - the light the skybox throws on the lit shaders, from the maps geometry/imageBasedLighting.go
+// makes of it. Included after the skyboxPresent uniform. With a skybox the environment stands in for the ambient
+// term of the lights, LightAmbient is 0 then
+const environmentLighting = `
+	#define PREFILTER_LEVELS 5
+
+	uniform samplerCube irradianceMap;
+	uniform samplerCube prefilteredMap;
+	uniform sampler2D brdfLUT;
+
+	//how much of the lights' ambient term a surface gets
+	float LightAmbient()
+	{
+		return skyboxPresent == 1 ? 0.0 : 1.0;
+	}
+
+	//the sky's light on a surface facing N, already divided by PI
+	vec3 EnvironmentDiffuse(vec3 N)
+	{
+		return texture(irradianceMap, N).rgb;
+	}
+
+	//the sky seen in direction R blurred by a GGX lobe of the given roughness
+	vec3 EnvironmentSpecular(vec3 R, float roughness)
+	{
+		return textureLod(prefilteredMap, R, roughness * float(PREFILTER_LEVELS - 1)).rgb;
+	}
+
+	//scale and bias of F0 giving the share of the sky a rough surface reflects
+	vec2 EnvironmentBRDF(float NdotV, float roughness)
+	{
+		return texture(brdfLUT, vec2(NdotV, roughness)).rg;
+	}
+
+	//the roughness of the GGX lobe closest to a Blinn-Phong highlight of exponent n
+	float BlinnRoughness(float n)
+	{
+		return clamp(sqrt(sqrt(2.0 / (max(n, 0.0) + 2.0))), 0.045, 1.0);
+	}
+
+	//the sky's light on a Blinn surface, which reflects it like a dielectric tinted by its specular colour
+	vec3 BlinnEnvironment(vec3 N, vec3 V, vec3 diffuse, vec3 specular, float n)
+	{
+		if (skyboxPresent == 0) {
+			return vec3(0.0);
+		}
+		float roughness = BlinnRoughness(n);
+		float NdotV = max(dot(N, V), 1e-4);
+		vec2 brdf = EnvironmentBRDF(NdotV, roughness);
+		vec3 reflection = EnvironmentSpecular(reflect(-V, N), roughness) * (0.04 * brdf.x + brdf.y);
+		return diffuse * EnvironmentDiffuse(N) + specular * reflection;
+	}
+`
+
+// pbrEnvironment - the sky's light on a PBR surface, split into a diffuse part from the irradiance map and a
+// specular part from the prefiltered map and the BRDF LUT. Needs brdfFunctions and environmentLighting
+const pbrEnvironment = `
+	vec3 PBREnvironment(Surface s)
+	{
+		if (skyboxPresent == 0) {
+			return vec3(0.0);
+		}
+		float NdotV = max(dot(s.N, s.V), 1e-4);
+		vec3 F = FresnelSchlickRoughness(NdotV, s.F0, s.roughness);
+		vec3 kD = (1.0 - F) * (1.0 - s.metallic);
+		vec2 brdf = EnvironmentBRDF(NdotV, s.roughness);
+		vec3 specular = EnvironmentSpecular(reflect(-s.V, s.N), s.roughness) * (s.F0 * brdf.x + brdf.y);
+		return kD * s.albedo * EnvironmentDiffuse(s.N) + specular;
+	}
+`
+
+// cubeFaceDirection - direction through a point of a cube map face being rendered into, from the face and oUV
+const cubeFaceDirection = `
+	uniform int face; //0 to 5, +X -X +Y -Y +Z -Z
+
+	vec3 CubeFaceDirection()
+	{
+		vec2 st = oUV * 2.0 - 1.0;
+		if (face == 0) {
+			return normalize(vec3(1.0, -st.y, -st.x));
+		} else if (face == 1) {
+			return normalize(vec3(-1.0, -st.y, st.x));
+		} else if (face == 2) {
+			return normalize(vec3(st.x, 1.0, st.y));
+		} else if (face == 3) {
+			return normalize(vec3(st.x, -1.0, -st.y));
+		} else if (face == 4) {
+			return normalize(vec3(st.x, -st.y, 1.0));
+		}
+		return normalize(vec3(-st.x, -st.y, -1.0));
+	}
+`
+
+// EquirectangularShader - renders a face of a cube map from a latitude-longitude image of the sky, the layout HDRI
+// environments come in
+type EquirectangularShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s EquirectangularShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s EquirectangularShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s EquirectangularShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *EquirectangularShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	#define PI 3.14159265359
+
+	in vec2 oUV;
+
+	uniform sampler2D equirectangular;
+
+	out vec4 frag_colour;
+` + cubeFaceDirection + `
+	void main() {
+		//longitude across from -X through -Z, +X and +Z, latitude down from straight up
+		vec3 direction = CubeFaceDirection();
+		vec2 uv = vec2(atan(direction.z, direction.x) / (2.0 * PI) + 0.5, 0.5 - asin(clamp(direction.y, -1.0, 1.0)) / PI);
+		frag_colour = vec4(textureLod(equirectangular, uv, 0.0).rgb, 1.0);
+	}
+` + "\x00"
+}
+
+// importanceSampling - GGX importance sampling over a Hammersley sequence, for the prefilter and BRDF LUT passes
+const importanceSampling = `
+	vec2 Hammersley(uint i, uint count)
+	{
+		return vec2(float(i) / float(count), float(bitfieldReverse(i)) * 2.3283064365386963e-10);
+	}
+
+	//a half vector around N, more of them where a GGX lobe of the given roughness is strong
+	vec3 ImportanceSampleGGX(vec2 Xi, vec3 N, float roughness)
+	{
+		float a = roughness * roughness;
+		float phi = 2.0 * PI * Xi.x;
+		float cosTheta = sqrt((1.0 - Xi.y) / (1.0 + (a * a - 1.0) * Xi.y));
+		float sinTheta = sqrt(1.0 - cosTheta * cosTheta);
+		vec3 H = vec3(cos(phi) * sinTheta, sin(phi) * sinTheta, cosTheta);
+
+		vec3 up = abs(N.z) < 0.999 ? vec3(0.0, 0.0, 1.0) : vec3(1.0, 0.0, 0.0);
+		vec3 tangent = normalize(cross(up, N));
+		vec3 bitangent = cross(N, tangent);
+		return normalize(tangent * H.x + bitangent * H.y + N * H.z);
+	}
+`
+
+// IrradianceShader - renders a face of the irradiance map, the sky's light on a surface facing each direction. The
+// hemisphere around it is sampled evenly, from a mip level of the sky about as coarse as the steps between samples
+type IrradianceShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s IrradianceShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s IrradianceShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s IrradianceShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *IrradianceShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	#define PI 3.14159265359
+	#define SAMPLE_DELTA 0.1
+
+	in vec2 oUV;
+
+	uniform samplerCube environment;
+
+	out vec4 frag_colour;
+` + cubeFaceDirection + `
+	void main() {
+		vec3 N = CubeFaceDirection();
+		vec3 up = abs(N.y) < 0.999 ? vec3(0.0, 1.0, 0.0) : vec3(0.0, 0.0, 1.0);
+		vec3 right = normalize(cross(up, N));
+		up = cross(N, right);
+
+		//a face of the sky spans PI / 2, the mip level is picked so a texel spans about SAMPLE_DELTA
+		float lod = max(log2(float(textureSize(environment, 0).x) * SAMPLE_DELTA * 2.0 / PI), 0.0);
+
+		vec3 irradiance = vec3(0.0);
+		float count = 0.0;
+		for (float phi = 0.0; phi < 2.0 * PI; phi += SAMPLE_DELTA) {
+			for (float theta = 0.0; theta < 0.5 * PI; theta += SAMPLE_DELTA) {
+				vec3 local = vec3(sin(theta) * cos(phi), sin(theta) * sin(phi), cos(theta));
+				vec3 direction = local.x * right + local.y * up + local.z * N;
+				irradiance += textureLod(environment, direction, lod).rgb * cos(theta) * sin(theta);
+				count++;
+			}
+		}
+		frag_colour = vec4(PI * irradiance / count, 1.0);
+	}
+` + "\x00"
+}
+
+// PrefilterShader - renders a face of one mip level of the prefiltered map, the sky as a surface of the level's
+// roughness reflects it. Samples are importance sampled from the GGX lobe and read from a mip level of the sky
+// matching the area each one stands for, which keeps bright spots from turning into speckles
+type PrefilterShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s PrefilterShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s PrefilterShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s PrefilterShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *PrefilterShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	#define SAMPLE_COUNT 64u
+
+	in vec2 oUV;
+
+	uniform samplerCube environment;
+	uniform float roughness;
+
+	out vec4 frag_colour;
+` + brdfFunctions + cubeFaceDirection + importanceSampling + `
+	void main() {
+		//the view is taken to be along the normal, so the lobe is the same in every direction
+		vec3 N = CubeFaceDirection();
+		vec3 V = N;
+		if (roughness == 0.0) {
+			frag_colour = vec4(textureLod(environment, N, 0.0).rgb, 1.0);
+			return;
+		}
+
+		float resolution = float(textureSize(environment, 0).x);
+		float texelSolidAngle = 4.0 * PI / (6.0 * resolution * resolution);
+
+		vec3 color = vec3(0.0);
+		float weight = 0.0;
+		for (uint i = 0u; i < SAMPLE_COUNT; i++) {
+			vec3 H = ImportanceSampleGGX(Hammersley(i, SAMPLE_COUNT), N, roughness);
+			vec3 L = normalize(2.0 * dot(V, H) * H - V);
+			float NdotL = dot(N, L);
+			if (NdotL <= 0.0) {
+				continue;
+			}
+			float NdotH = max(dot(N, H), 0.0);
+			float HdotV = max(dot(H, V), 0.0);
+			float pdf = DistributionGGX(NdotH, roughness) * NdotH / (4.0 * HdotV) + 1e-4;
+			float sampleSolidAngle = 1.0 / (float(SAMPLE_COUNT) * pdf + 1e-4);
+			float lod = max(0.5 * log2(sampleSolidAngle / texelSolidAngle), 0.0);
+			color += textureLod(environment, L, lod).rgb * NdotL;
+			weight += NdotL;
+		}
+		frag_colour = vec4(color / max(weight, 1e-4), 1.0);
+	}
+` + "\x00"
+}
+
+// BRDFLUTShader - renders the BRDF LUT, the scale and bias to F0 of the share of its environment a surface reflects,
+// by NdotV across and roughness up
+type BRDFLUTShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s BRDFLUTShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s BRDFLUTShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s BRDFLUTShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *BRDFLUTShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	#define SAMPLE_COUNT 128u
+
+	in vec2 oUV;
+
+	out vec4 frag_colour;
+` + brdfFunctions + importanceSampling + `
+	//Smith-Schlick with the k image based lighting uses, which is smaller than the one for lights
+	float GeometrySmithIBL(float NdotV, float NdotL, float roughness)
+	{
+		float k = roughness * roughness / 2.0;
+		return (NdotV / (NdotV * (1.0 - k) + k)) * (NdotL / (NdotL * (1.0 - k) + k));
+	}
+
+	void main() {
+		float NdotV = max(oUV.x, 1e-4);
+		float roughness = oUV.y;
+		vec3 V = vec3(sqrt(1.0 - NdotV * NdotV), 0.0, NdotV);
+		vec3 N = vec3(0.0, 0.0, 1.0);
+
+		float scale = 0.0;
+		float bias = 0.0;
+		for (uint i = 0u; i < SAMPLE_COUNT; i++) {
+			vec3 H = ImportanceSampleGGX(Hammersley(i, SAMPLE_COUNT), N, roughness);
+			vec3 L = normalize(2.0 * dot(V, H) * H - V);
+			float NdotL = max(L.z, 0.0);
+			if (NdotL <= 0.0) {
+				continue;
+			}
+			float NdotH = max(H.z, 0.0);
+			float VdotH = max(dot(V, H), 0.0);
+			float G = GeometrySmithIBL(NdotV, NdotL, roughness);
+			float visibility = G * VdotH / (NdotH * NdotV);
+			float Fc = pow(1.0 - VdotH, 5.0);
+			scale += (1.0 - Fc) * visibility;
+			bias += Fc * visibility;
+		}
+		frag_colour = vec4(scale / float(SAMPLE_COUNT), bias / float(SAMPLE_COUNT), 0.0, 1.0);
+	}
+` + "\x00"
+}
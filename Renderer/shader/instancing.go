@@ -0,0 +1,22 @@
+package shader
+
+// instancing - the model and normal matrix a vertex shader places a vertex with. The copies of a mesh in an instance
+// group are drawn with one call, see geometry/instancing.go, and each reads its matrices from the group's buffer
+// instead of the uniforms
+const instancing = `
+	layout (location = 5) in mat4 aInstanceModel; //takes locations 5 to 8
+	layout (location = 9) in mat3 aInstanceNormal; //takes locations 9 to 11
+	uniform mat4 uModelMatrix;
+	uniform mat3 uNormalMatrix;
+	uniform int instanced;
+
+	mat4 ModelMatrix()
+	{
+		return instanced == 1 ? aInstanceModel : uModelMatrix;
+	}
+
+	mat3 NormalMatrix()
+	{
+		return instanced == 1 ? aInstanceNormal : uNormalMatrix;
+	}
+`
@@ -0,0 +1,119 @@
+package shader
+
+import "strconv"
+
+// MaxPointShadows - size of the pointShadowMaps array, set from the context by geometry.SetupTextureUnits before the
+// lit shaders are set up. With none the array isn't declared and point lights cast no shadows
+var MaxPointShadows int
+
+// lightsBlock - light definitions shared by the Blinn and PBR shaders. The Lights block uses the std140 layout and is
+// filled once per frame by the renderer, so the order and types here must match geometry/lightBuffer.go.
+// Samplers can't live in a uniform block so the shadow maps are separate uniforms indexed like the lights.
+// Point lights are in the pointLightData buffer, any number of them. The ones that cast shadows come first, one per
+// pointShadowMaps slot, and are tried by every fragment. The rest are found through the cluster the fragment is in,
+// see geometry/lightClusters.go
+func lightsBlock() string {
+	return `
+	#define MAX_POINT_SHADOWS ` + strconv.Itoa(MaxPointShadows) + lightDefinitions
+}
+
+const lightDefinitions = `
+	#define MAX_DIR_LIGHTS 4
+	#define MAX_CASCADES 4
+
+	struct ShadowSettings {
+		float bias; //in shadow map texels
+		float normalBias; //in shadow map texels
+		int filterMode; //0 = hard, 1 = pcf, 2 = poisson, 3 = pcss
+		int filterSize; //in shadow map texels
+		float lightSize;
+	};
+
+	struct PointLight {
+		vec3 position;
+		float strength;
+		vec3 color;
+		float farPlane;
+		float constant;
+		float linear;
+		float quadratic;
+		int shadow;
+		ShadowSettings shadowSettings;
+	};
+
+	struct DirectionalLight {
+		vec3 direction; //normalized, the way the light travels
+		float strength;
+		vec3 color;
+		int cascadeCount;
+		vec4 cascadeSplits; //view space depth where each cascade ends
+		mat4 lightSpaceMatrices[MAX_CASCADES];
+		ShadowSettings shadowSettings;
+	};
+
+	layout (std140) uniform Lights {
+		DirectionalLight dirLights[MAX_DIR_LIGHTS];
+		ivec4 clusterGrid; //clusters across, down and deep
+		vec4 clusterScale; //pixels across and down a cluster, and the scale and bias turning log depth into a slice
+		int numPointLights;
+		int numDirLights;
+		int numShadowedPointLights;
+	};
+
+	#if MAX_POINT_SHADOWS > 0
+	uniform samplerCube pointShadowMaps[MAX_POINT_SHADOWS];
+	#endif
+	uniform sampler2DArray dirShadowMaps[MAX_DIR_LIGHTS];
+	uniform samplerBuffer pointLightData; //5 texels a light
+	//where each cluster's lights start and how many there are, two texels a cluster, then the light indices
+	uniform usamplerBuffer lightClusters;
+
+	PointLight FetchPointLight(int index)
+	{
+		int base = index * 5;
+		vec4 t0 = texelFetch(pointLightData, base);
+		vec4 t1 = texelFetch(pointLightData, base + 1);
+		vec4 t2 = texelFetch(pointLightData, base + 2);
+		vec4 t3 = texelFetch(pointLightData, base + 3);
+		vec4 t4 = texelFetch(pointLightData, base + 4);
+
+		PointLight light;
+		light.position = t0.xyz;
+		light.strength = t0.w;
+		light.color = t1.rgb;
+		light.farPlane = t1.w;
+		light.constant = t2.x;
+		light.linear = t2.y;
+		light.quadratic = t2.z;
+		light.shadow = int(t2.w);
+		light.shadowSettings.bias = t3.x;
+		light.shadowSettings.normalBias = t3.y;
+		light.shadowSettings.filterMode = int(t3.z);
+		light.shadowSettings.filterSize = int(t3.w);
+		light.shadowSettings.lightSize = t4.x;
+		return light;
+	}
+
+	//whether a point light reaches a fragment, past its range it gives too little light to see
+	bool InPointLightRange(int index, vec3 fragPos)
+	{
+		vec4 t0 = texelFetch(pointLightData, index * 5);
+		float range = texelFetch(pointLightData, index * 5 + 4).y;
+		return distance(t0.xyz, fragPos) <= range;
+	}
+
+	//where the lights of the cluster a fragment is in start in lightClusters, and how many there are
+	uvec2 LightCluster(vec2 fragCoord, float viewDepth)
+	{
+		int slice = int(log(max(viewDepth, 1e-4)) * clusterScale.z + clusterScale.w);
+		ivec3 cell = ivec3(ivec2(fragCoord / clusterScale.xy), slice);
+		cell = clamp(cell, ivec3(0), clusterGrid.xyz - 1);
+		int index = ((cell.z * clusterGrid.y + cell.y) * clusterGrid.x + cell.x) * 2;
+		return uvec2(texelFetch(lightClusters, index).r, texelFetch(lightClusters, index + 1).r);
+	}
+
+	int ClusterLight(uvec2 cluster, uint i)
+	{
+		return int(texelFetch(lightClusters, int(cluster.x + i)).r);
+	}
+`
@@ -0,0 +1,268 @@
+package shader
+
+// PBR - metallic-roughness Cook-Torrance shader: GGX distribution, Smith-Schlick geometry and Schlick Fresnel. The
+// texture maps follow glTF, roughness is read from the green channel and metallic from the blue channel of the
+// metallic-roughness map and occlusion from the red channel of the occlusion map
+type PBR struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s PBR) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s PBR) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s PBR) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *PBR) Setup() {
+	s.vertShader = `
+	#version 410
+	//needed to add layout location for mac to work properly
+	layout (location = 0) in vec3 aPosition;
+	layout (location = 1) in vec3 aNormal;
+	layout (location = 2) in vec2 aUV;
+
+	out vec3 normalInterp;
+	out vec3 oFragPosition;
+	out float oViewDepth;
+	out vec2 oUV;
+
+	uniform mat4 uProjectionMatrix;
+	uniform mat4 uViewMatrix;
+` + instancing + `
+
+	void main() {
+		normalInterp = NormalMatrix() * aNormal;
+		oFragPosition = (ModelMatrix() * vec4(aPosition, 1.0)).xyz;
+		oViewDepth = -(uViewMatrix * vec4(oFragPosition, 1.0)).z;
+		//images are uploaded top row first while v runs up the image
+		oUV = vec2(aUV.x, 1.0 - aUV.y);
+		gl_Position = uProjectionMatrix * uViewMatrix * vec4(oFragPosition, 1.0);
+	}
+` + "\x00"
+
+	s.geoShader = ""
+
+	s.fragShader = `
+	#version 410
+	precision highp float;
+` + lightsBlock() + shadowFunctions + brdfFunctions + `
+	in vec3 oFragPosition;
+	in float oViewDepth;
+	in vec3 normalInterp;
+	in vec2 oUV;
+
+	uniform vec3 baseColorVal;
+	uniform float metallicVal;
+	uniform float roughnessVal;
+	uniform float aoVal;
+	uniform vec3 emissiveVal;
+	uniform vec3 ambientVal;
+	uniform float Alpha;
+	uniform int textureMaps;
+	uniform sampler2D uDiffuseTexture;
+	uniform sampler2D uNormalTexture;
+	uniform sampler2D uMetallicRoughnessTexture;
+	uniform sampler2D uOcclusionTexture;
+	uniform sampler2D uEmissiveTexture;
+	uniform int skyboxPresent;
+	uniform vec3 cameraPosition;
+
+` + transparencyOutput + ambientOcclusion + environmentLighting + pbrEnvironment + pbrMapBits + planarMirror + `
+	bool HasMap(int bit)
+	{
+		return (textureMaps & bit) != 0;
+	}
+` + perturbNormalFunction + `
+	//adds a point light's share to the lit colour and to the light the ambient fill is scaled by
+	void AddPointLight(PointLight light, int shadowSlot, Surface s, vec3 geometryNormal, inout vec3 result,
+		inout vec3 ambientLight)
+	{
+		vec3 toLight = light.position - oFragPosition;
+		float distance = length(toLight);
+		vec3 L = toLight / distance;
+		float attenuation = light.strength / (light.constant + light.linear * distance +
+			light.quadratic * distance * distance);
+		vec3 radiance = light.color * attenuation;
+
+		float shadow = PointShadow(light, shadowSlot, oFragPosition, geometryNormal);
+		result += (1.0 - shadow) * CookTorrance(s, L, radiance);
+		ambientLight += radiance;
+	}
+
+	void main() {
+		vec4 baseColor = vec4(baseColorVal, Alpha);
+		if (HasMap(BASE_COLOR_MAP)) {
+			baseColor *= texture(uDiffuseTexture, oUV);
+			if (baseColor.a < 0.1) {
+				discard;
+			}
+		}
+
+		Surface s;
+		s.albedo = baseColor.rgb;
+		s.metallic = metallicVal;
+		s.roughness = roughnessVal;
+		if (HasMap(METALLIC_ROUGHNESS_MAP)) {
+			vec4 mr = texture(uMetallicRoughnessTexture, oUV);
+			s.roughness *= mr.g;
+			s.metallic *= mr.b;
+		}
+		s.roughness = clamp(s.roughness, MIN_ROUGHNESS, 1.0);
+		s.metallic = clamp(s.metallic, 0.0, 1.0);
+		s.F0 = mix(vec3(0.04), s.albedo, s.metallic);
+
+		float ao = aoVal * AmbientOcclusion();
+		if (HasMap(OCCLUSION_MAP)) {
+			ao *= texture(uOcclusionTexture, oUV).r;
+		}
+
+		s.V = normalize(cameraPosition - oFragPosition);
+		//a visible face whose normal points away from the camera has its normal the wrong way round
+		vec3 geometryNormal = normalize(normalInterp);
+		if (dot(geometryNormal, s.V) < 0.0) {
+			geometryNormal = -geometryNormal;
+		}
+		s.N = geometryNormal;
+		if (HasMap(NORMAL_MAP)) {
+			s.N = PerturbNormal(geometryNormal, texture(uNormalTexture, oUV).xyz * 2.0 - 1.0);
+		}
+
+		vec3 result = vec3(0.0);
+		vec3 ambientLight = vec3(0.0);
+
+		for (int i = 0; i < numShadowedPointLights; i++) {
+			if (InPointLightRange(i, oFragPosition)) {
+				AddPointLight(FetchPointLight(i), i, s, geometryNormal, result, ambientLight);
+			}
+		}
+		//the clustered lights cast no shadows, so they have no shadow map slot
+		uvec2 cluster = LightCluster(gl_FragCoord.xy, oViewDepth);
+		for (uint i = 0u; i < cluster.y; i++) {
+			AddPointLight(FetchPointLight(ClusterLight(cluster, i)), -1, s, geometryNormal, result,
+				ambientLight);
+		}
+
+		for (int i = 0; i < numDirLights; i++) {
+			vec3 L = -dirLights[i].direction;
+			vec3 radiance = dirLights[i].color * dirLights[i].strength;
+			float shadow = DirShadowCalculation(dirLights[i], dirShadowMaps[i], oFragPosition, oViewDepth, geometryNormal, L);
+			result += (1.0 - shadow) * CookTorrance(s, L, radiance);
+			ambientLight += radiance;
+		}
+
+		//flat fill from every light, scaled by the material's ambient colour, or with a skybox the sky's light
+		result += ambientLight * ambientVal * s.albedo * ao * LightAmbient();
+		result += PBREnvironment(s) * ao;
+
+		vec3 emissive = emissiveVal;
+		if (HasMap(EMISSIVE_MAP)) {
+			emissive *= texture(uEmissiveTexture, oUV).rgb;
+		}
+		result += emissive;
+
+		//a normal map ripples the reflection
+		vec2 ripple = vec2(0.0);
+		if (HasMap(NORMAL_MAP)) {
+			ripple = texture(uNormalTexture, oUV).xy * 2.0 - 1.0;
+		}
+		result = MirrorReflection(result, ripple);
+
+		WriteFragment(result, baseColor.a);
+	}
+	` + "\x00"
+}
+
+// brdfFunctions - Cook-Torrance terms shared by the PBR shader and the deferred lighting passes
+const brdfFunctions = `
+	#define PI 3.14159265359
+	#define MIN_ROUGHNESS 0.045
+
+	struct Surface {
+		vec3 albedo;
+		float metallic;
+		float roughness;
+		vec3 F0; //reflectance looking straight at the surface
+		vec3 N;
+		vec3 V;
+	};
+
+	float DistributionGGX(float NdotH, float roughness)
+	{
+		float a = roughness * roughness;
+		float a2 = a * a;
+		float d = NdotH * NdotH * (a2 - 1.0) + 1.0;
+		return a2 / (PI * d * d);
+	}
+
+	float GeometrySmith(float NdotV, float NdotL, float roughness)
+	{
+		float r = roughness + 1.0;
+		float k = r * r / 8.0;
+		return (NdotV / (NdotV * (1.0 - k) + k)) * (NdotL / (NdotL * (1.0 - k) + k));
+	}
+
+	vec3 FresnelSchlick(float cosTheta, vec3 F0)
+	{
+		return F0 + (1.0 - F0) * pow(clamp(1.0 - cosTheta, 0.0, 1.0), 5.0);
+	}
+
+	vec3 FresnelSchlickRoughness(float cosTheta, vec3 F0, float roughness)
+	{
+		return F0 + (max(vec3(1.0 - roughness), F0) - F0) * pow(clamp(1.0 - cosTheta, 0.0, 1.0), 5.0);
+	}
+
+	//radiance is the light's colour times its strength, times PI so a light lights a white surface facing it as
+	//brightly as it does with the Blinn shaders
+	vec3 CookTorrance(Surface s, vec3 L, vec3 radiance)
+	{
+		vec3 H = normalize(s.V + L);
+		float NdotL = max(dot(s.N, L), 0.0);
+		float NdotV = max(dot(s.N, s.V), 1e-4);
+		float NdotH = max(dot(s.N, H), 0.0);
+
+		float D = DistributionGGX(NdotH, s.roughness);
+		float G = GeometrySmith(NdotV, NdotL, s.roughness);
+		vec3 F = FresnelSchlick(max(dot(H, s.V), 0.0), s.F0);
+
+		vec3 specular = D * G * F / (4.0 * NdotV * NdotL + 1e-4);
+		vec3 kD = (1.0 - F) * (1.0 - s.metallic);
+		return (kD * s.albedo / PI + specular) * radiance * PI * NdotL;
+	}
+`
+
+// pbrMapBits - bits of the textureMaps uniform, see geometry/pbrMaterial.go
+const pbrMapBits = `
+	#define BASE_COLOR_MAP 1
+	#define NORMAL_MAP 2
+	#define METALLIC_ROUGHNESS_MAP 4
+	#define OCCLUSION_MAP 8
+	#define EMISSIVE_MAP 16
+`
+
+// perturbNormalFunction - normal mapping without tangents, for shaders with oFragPosition and oUV inputs
+const perturbNormalFunction = `
+	//the tangent frame comes from screen space derivatives of the position and texture coordinates, so meshes
+	//need no tangents. t runs down the image, the green channel of a normal map points up it
+	vec3 PerturbNormal(vec3 N, vec3 mapNormal)
+	{
+		vec3 dp1 = dFdx(oFragPosition);
+		vec3 dp2 = dFdy(oFragPosition);
+		vec2 duv1 = dFdx(oUV);
+		vec2 duv2 = dFdy(oUV);
+
+		vec3 dp2perp = cross(dp2, N);
+		vec3 dp1perp = cross(N, dp1);
+		vec3 T = dp2perp * duv1.x + dp1perp * duv2.x;
+		vec3 B = dp2perp * duv1.y + dp1perp * duv2.y;
+		float invmax = inversesqrt(max(max(dot(T, T), dot(B, B)), 1e-12));
+		return normalize(mat3(T * invmax, -B * invmax, N) * mapNormal);
+	}
+`
@@ -0,0 +1,22 @@
+package shader
+
+// planarMirror - the reflection a Plane with a mirror material shows, read from the texture main drew the scene
+// into from the camera reflected about the plane, see geometry/planarMirror.go. That texture lines up with the
+// frame, so it is read where the fragment is on screen
+const planarMirror = `
+	uniform sampler2D mirrorMap;
+	uniform int mirrorPresent;
+	uniform vec2 mirrorPixel; //size of a frame pixel in mirrorMap's texture coordinates
+	uniform float mirrorStrength;
+	uniform float mirrorDistortion;
+
+	//the surface colour with the reflection over it, offset bends the reflection, e.g. by the tangent space normal
+	vec3 MirrorReflection(vec3 surface, vec2 offset)
+	{
+		if (mirrorPresent == 0) {
+			return surface;
+		}
+		vec2 uv = gl_FragCoord.xy * mirrorPixel + offset * mirrorDistortion;
+		return mix(surface, texture(mirrorMap, uv).rgb, mirrorStrength);
+	}
+`
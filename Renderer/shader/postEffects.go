@@ -0,0 +1,224 @@
+package shader
+
+// postPreamble - declarations every post effect shader starts with, custom effects included
+const postPreamble = `
+	#version 410
+	precision highp float;
+
+	in vec2 oUV;
+
+	uniform sampler2D sceneTexture; //the frame so far
+	uniform sampler2D depthTexture; //depth buffer of the scene, 0 to 1
+	uniform vec2 texelSize; //one pixel of sceneTexture in texture coordinates
+	uniform float time; //seconds since the first frame
+	uniform float intensity;
+
+	out vec4 frag_colour;
+` + luminanceFunction
+
+// PostEffectShader - one fullscreen pass of the post processing stack. Source is the fragment shader after
+// postPreamble, the built in passes fill it in from postEffectSources by Name
+type PostEffectShader struct {
+	Name       string
+	Source     string
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s PostEffectShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s PostEffectShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s PostEffectShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *PostEffectShader) Setup() {
+	source := s.Source
+	if source == "" {
+		source = postEffectSources[s.Name]
+	}
+
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = postPreamble + source + "\x00"
+}
+
+// postEffectSources - the built in passes, see geometry/postProcess.go for their uniforms
+var postEffectSources = map[string]string{
+	//keeps the part of each pixel brighter than the threshold, with a soft knee so the glow fades in
+	"bloomBright": `
+	uniform float threshold;
+
+	void main() {
+		vec3 color = texture(sceneTexture, oUV).rgb;
+		float brightness = Luminance(color);
+		float knee = threshold * 0.5;
+		float soft = clamp(brightness - threshold + knee, 0.0, 2.0 * knee);
+		soft = soft * soft / (4.0 * knee + 1e-4);
+		float contribution = max(soft, brightness - threshold) / max(brightness, 1e-4);
+		frag_colour = vec4(color * contribution, 1.0);
+	}
+`,
+
+	//9 tap gaussian in one direction, taken as 5 taps by sampling between texels
+	"bloomBlur": `
+	uniform vec2 direction;
+
+	void main() {
+		vec2 offset1 = direction * texelSize * 1.3846153846;
+		vec2 offset2 = direction * texelSize * 3.2307692308;
+		vec3 result = texture(sceneTexture, oUV).rgb * 0.2270270270;
+		result += (texture(sceneTexture, oUV + offset1).rgb + texture(sceneTexture, oUV - offset1).rgb) * 0.3162162162;
+		result += (texture(sceneTexture, oUV + offset2).rgb + texture(sceneTexture, oUV - offset2).rgb) * 0.0702702703;
+		frag_colour = vec4(result, 1.0);
+	}
+`,
+
+	"bloom": `
+	uniform sampler2D bloomTexture;
+
+	void main() {
+		vec4 scene = texture(sceneTexture, oUV);
+		frag_colour = vec4(scene.rgb + texture(bloomTexture, oUV).rgb * intensity, scene.a);
+	}
+`,
+
+	//gathers a disk whose size follows the circle of confusion. Samples are weighted by their own blur so sharp
+	//things in focus don't smear into the blurred background around them
+	"depthOfField": `
+	uniform float focusDistance;
+	uniform float focusRange;
+	uniform float radius; //largest blur in pixels
+	uniform float nearPlane;
+	uniform float farPlane;
+
+	const vec2 disk[16] = vec2[](
+		vec2(-0.94201624, -0.39906216), vec2(0.94558609, -0.76890725),
+		vec2(-0.09418410, -0.92938870), vec2(0.34495938, 0.29387760),
+		vec2(-0.91588581, 0.45771432), vec2(-0.81544232, -0.87912464),
+		vec2(-0.38277543, 0.27676845), vec2(0.97484398, 0.75648379),
+		vec2(0.44323325, -0.97511554), vec2(0.53742981, -0.47373420),
+		vec2(-0.26496911, -0.41893023), vec2(0.79197514, 0.19090188),
+		vec2(-0.24188840, 0.99706507), vec2(-0.81409955, 0.91437590),
+		vec2(0.19984126, 0.78641367), vec2(0.14383161, -0.14100790)
+	);
+
+	float LinearDepth(vec2 uv)
+	{
+		float z = texture(depthTexture, uv).r * 2.0 - 1.0;
+		return 2.0 * nearPlane * farPlane / (farPlane + nearPlane - z * (farPlane - nearPlane));
+	}
+
+	float CircleOfConfusion(vec2 uv)
+	{
+		return clamp(abs(LinearDepth(uv) - focusDistance) / focusRange, 0.0, 1.0);
+	}
+
+	void main() {
+		vec4 center = texture(sceneTexture, oUV);
+		float coc = CircleOfConfusion(oUV);
+		vec3 sum = center.rgb;
+		float weight = 1.0;
+		for (int i = 0; i < 16; i++) {
+			vec2 uv = oUV + disk[i] * coc * radius * texelSize;
+			float w = CircleOfConfusion(uv);
+			sum += texture(sceneTexture, uv).rgb * w;
+			weight += w;
+		}
+		frag_colour = vec4(sum / weight, center.a);
+	}
+`,
+
+	//red and blue are pulled apart towards the edges, by intensity pixels at the corners
+	"chromaticAberration": `
+	void main() {
+		vec2 offset = (oUV - 0.5) * 2.0 * intensity * texelSize;
+		vec4 center = texture(sceneTexture, oUV);
+		float red = texture(sceneTexture, oUV + offset).r;
+		float blue = texture(sceneTexture, oUV - offset).b;
+		frag_colour = vec4(red, center.g, blue, center.a);
+	}
+`,
+
+	//FXAA without the edge search, blurs along the edge direction found from the luminance of the corners
+	"fxaa": `
+	#define FXAA_REDUCE_MIN (1.0 / 128.0)
+	#define FXAA_REDUCE_MUL (1.0 / 8.0)
+	#define FXAA_SPAN_MAX 8.0
+
+	void main() {
+		vec4 center = texture(sceneTexture, oUV);
+		float lumaNW = Luminance(texture(sceneTexture, oUV + vec2(-1.0, -1.0) * texelSize).rgb);
+		float lumaNE = Luminance(texture(sceneTexture, oUV + vec2(1.0, -1.0) * texelSize).rgb);
+		float lumaSW = Luminance(texture(sceneTexture, oUV + vec2(-1.0, 1.0) * texelSize).rgb);
+		float lumaSE = Luminance(texture(sceneTexture, oUV + vec2(1.0, 1.0) * texelSize).rgb);
+		float lumaM = Luminance(center.rgb);
+		float lumaMin = min(lumaM, min(min(lumaNW, lumaNE), min(lumaSW, lumaSE)));
+		float lumaMax = max(lumaM, max(max(lumaNW, lumaNE), max(lumaSW, lumaSE)));
+
+		vec2 dir = vec2(-((lumaNW + lumaNE) - (lumaSW + lumaSE)), (lumaNW + lumaSW) - (lumaNE + lumaSE));
+		float dirReduce = max((lumaNW + lumaNE + lumaSW + lumaSE) * 0.25 * FXAA_REDUCE_MUL, FXAA_REDUCE_MIN);
+		float rcpDirMin = 1.0 / (min(abs(dir.x), abs(dir.y)) + dirReduce);
+		dir = clamp(dir * rcpDirMin, vec2(-FXAA_SPAN_MAX), vec2(FXAA_SPAN_MAX)) * texelSize;
+
+		vec3 rgbA = 0.5 * (texture(sceneTexture, oUV + dir * (1.0 / 3.0 - 0.5)).rgb +
+			texture(sceneTexture, oUV + dir * (2.0 / 3.0 - 0.5)).rgb);
+		vec3 rgbB = rgbA * 0.5 + 0.25 * (texture(sceneTexture, oUV - dir * 0.5).rgb +
+			texture(sceneTexture, oUV + dir * 0.5).rgb);
+		float lumaB = Luminance(rgbB);
+		if (lumaB < lumaMin || lumaB > lumaMax) {
+			frag_colour = vec4(rgbA, center.a);
+		} else {
+			frag_colour = vec4(rgbB, center.a);
+		}
+	}
+`,
+
+	//darkens by up to intensity from radius outwards, 0 being the centre and 1 the corners
+	"vignette": `
+	uniform float radius;
+	uniform float smoothness;
+
+	void main() {
+		vec4 color = texture(sceneTexture, oUV);
+		float distance = length(oUV - 0.5) * sqrt(2.0);
+		float shade = smoothstep(radius - smoothness, radius, distance);
+		frag_colour = vec4(color.rgb * (1.0 - intensity * shade), color.a);
+	}
+`,
+
+	//looks each colour up in the LUT, sampling texel centres so the ends of the table map onto 0 and 1
+	"colorGrading": `
+	uniform sampler3D lut;
+	uniform float lutSize;
+
+	void main() {
+		vec4 color = texture(sceneTexture, oUV);
+		vec3 uvw = clamp(color.rgb, 0.0, 1.0) * ((lutSize - 1.0) / lutSize) + 0.5 / lutSize;
+		frag_colour = vec4(mix(color.rgb, texture(lut, uvw).rgb, intensity), color.a);
+	}
+`,
+
+	//noise that changes 24 times a second
+	"filmGrain": `
+	float Hash(vec2 p)
+	{
+		vec3 p3 = fract(vec3(p.xyx) * 0.1031);
+		p3 += dot(p3, p3.yzx + 33.33);
+		return fract((p3.x + p3.y) * p3.z);
+	}
+
+	void main() {
+		vec4 color = texture(sceneTexture, oUV);
+		float frame = floor(time * 24.0);
+		float grain = Hash(gl_FragCoord.xy + vec2(frame * 37.0, frame * 17.0)) - 0.5;
+		frag_colour = vec4(color.rgb + grain * intensity, color.a);
+	}
+`,
+}
@@ -0,0 +1,37 @@
+package shader
+
+// reflectionProbe - what reflective and refractive Blinn surfaces see, the nearest reflection probe's capture of the
+// scene when main binds one and the skybox otherwise, see geometry/reflectionProbe.go. Included after the skybox
+// uniforms
+const reflectionProbe = `
+	uniform samplerCube probeMap;
+	uniform int probePresent;
+	uniform vec3 probePosition;
+	uniform int probeBoxProjection;
+	uniform vec3 probeBoxMin;
+	uniform vec3 probeBoxMax;
+
+	//whether there is anything to reflect
+	bool HasReflection()
+	{
+		return skyboxPresent == 1 || probePresent == 1;
+	}
+
+	//the scene seen from position along direction
+	vec3 SceneReflection(vec3 position, vec3 direction)
+	{
+		if (probePresent == 0) {
+			return texture(skybox, direction).rgb;
+		}
+		//a probe sees the scene from one point, so for a surface inside the box it stands for, the direction is
+		//corrected to point from the probe to where the ray from the surface leaves the box
+		if (probeBoxProjection == 1 && all(greaterThan(position, probeBoxMin)) && all(lessThan(position, probeBoxMax))) {
+			vec3 toMax = (probeBoxMax - position) / direction;
+			vec3 toMin = (probeBoxMin - position) / direction;
+			vec3 exits = max(toMax, toMin);
+			float distance = min(min(exits.x, exits.y), exits.z);
+			direction = position + direction * distance - probePosition;
+		}
+		return texture(probeMap, direction).rgb;
+	}
+`
@@ -0,0 +1,197 @@
+package shader
+
+// shadowFunctions - shadow lookups shared by the Blinn and PBR shaders, filtered the way each light's ShadowSettings
+// ask. Biases and filter sizes are in shadow map texels so they mean the same in every cascade and cube map face.
+// Directional lights pick their cascade by the fragment's view depth and fade into the next one over the last tenth
+const shadowFunctions = `
+	#define SHADOW_HARD 0
+	#define SHADOW_PCF 1
+	#define SHADOW_POISSON 2
+	#define SHADOW_PCSS 3
+	#define MAX_PENUMBRA 32.0
+
+	const vec2 poissonDisk[16] = vec2[](
+		vec2(-0.94201624, -0.39906216), vec2(0.94558609, -0.76890725), vec2(-0.09418410, -0.92938870), vec2(0.34495938, 0.29387760),
+		vec2(-0.91588581, 0.45771432), vec2(-0.81544232, -0.87912464), vec2(-0.38277543, 0.27676845), vec2(0.97484398, 0.75648379),
+		vec2(0.44323325, -0.97511554), vec2(0.53742981, -0.47373420), vec2(-0.26496911, -0.41893023), vec2(0.79197514, 0.19090188),
+		vec2(-0.24188840, 0.99706507), vec2(-0.81409955, 0.91437590), vec2(0.19984126, 0.78641367), vec2(0.14383161, -0.14100790)
+	);
+
+	//the Poisson disk is turned a different way for every pixel, which trades banding for noise
+	mat2 PoissonRotation()
+	{
+		float angle = 6.2831853 * fract(sin(dot(gl_FragCoord.xy, vec2(12.9898, 78.233))) * 43758.5453);
+		return mat2(cos(angle), sin(angle), -sin(angle), cos(angle));
+	}
+
+	int ShadowTaps(ShadowSettings settings)
+	{
+		if (settings.filterMode == SHADOW_PCF) {
+			return settings.filterSize * settings.filterSize;
+		}
+		if (settings.filterMode == SHADOW_POISSON || settings.filterMode == SHADOW_PCSS) {
+			return 16;
+		}
+		return 1;
+	}
+
+	//offset in texels of tap i, radius is how far the Poisson disk reaches
+	vec2 ShadowTapOffset(ShadowSettings settings, int i, mat2 rotation, float radius)
+	{
+		if (settings.filterMode == SHADOW_PCF) {
+			int n = settings.filterSize;
+			return vec2(float(i % n), float(i / n)) - float(n - 1) / 2.0;
+		}
+		if (settings.filterMode == SHADOW_HARD) {
+			return vec2(0.0);
+		}
+		return rotation * poissonDisk[i] * radius;
+	}
+
+	//bias in texels, growing as the surface turns away from the light
+	float SlopeBias(ShadowSettings settings, float cosTheta)
+	{
+		float slope = min(sqrt(1.0 - cosTheta * cosTheta) / max(cosTheta, 0.01), 5.0);
+		return settings.bias * (1.0 + 2.0 * slope);
+	}
+
+	float CascadeShadow(DirectionalLight light, sampler2DArray depthMap, int cascade, vec3 fragPos, vec3 normal, float cosTheta)
+	{
+		ShadowSettings settings = light.shadowSettings;
+		mat4 lightSpace = light.lightSpaceMatrices[cascade];
+		float resolution = float(textureSize(depthMap, 0).x);
+		//cascades are as deep as they are wide, 2 / the x scale of the light space matrix
+		float texelWorld = 2.0 / length(vec3(lightSpace[0][0], lightSpace[1][0], lightSpace[2][0])) / resolution;
+
+		vec3 offsetPos = fragPos + normal * settings.normalBias * texelWorld * sqrt(1.0 - cosTheta * cosTheta);
+		vec4 fragPosLightSpace = lightSpace * vec4(offsetPos, 1.0);
+		vec3 pos = fragPosLightSpace.xyz / fragPosLightSpace.w * 0.5 + 0.5;
+		//outside the cascade is lit
+		if (pos.z > 1.0 || pos.x < 0.0 || pos.x > 1.0 || pos.y < 0.0 || pos.y > 1.0) {
+			return 0.0;
+		}
+
+		float receiver = pos.z - SlopeBias(settings, cosTheta) / resolution;
+		mat2 rotation = PoissonRotation();
+		float radius = float(settings.filterSize) / 2.0;
+
+		if (settings.filterMode == SHADOW_PCSS) {
+			//lightSize is how far the penumbra spreads for each unit between the caster and the receiver
+			float depthToTexels = resolution * settings.lightSize;
+			float searchRadius = clamp(pos.z * depthToTexels, 1.0, MAX_PENUMBRA);
+			float blockerDepth = 0.0;
+			int blockers = 0;
+			for (int i = 0; i < 16; i++) {
+				vec2 uv = pos.xy + rotation * poissonDisk[i] * searchRadius / resolution;
+				float depth = texture(depthMap, vec3(uv, float(cascade))).r;
+				if (depth < receiver) {
+					blockerDepth += depth;
+					blockers++;
+				}
+			}
+			if (blockers == 0) {
+				return 0.0;
+			}
+			blockerDepth /= float(blockers);
+			radius = clamp((receiver - blockerDepth) * depthToTexels, 1.0, MAX_PENUMBRA);
+		}
+
+		int taps = ShadowTaps(settings);
+		float shadow = 0.0;
+		for (int i = 0; i < taps; i++) {
+			vec2 uv = pos.xy + ShadowTapOffset(settings, i, rotation, radius) / resolution;
+			float closestDepth = texture(depthMap, vec3(uv, float(cascade))).r;
+			shadow += receiver > closestDepth ? 1.0 : 0.0;
+		}
+		return shadow / float(taps);
+	}
+
+	float DirShadowCalculation(DirectionalLight light, sampler2DArray depthMap, vec3 fragPos, float viewDepth, vec3 normal, vec3 lightDir)
+	{
+		int cascade = 0;
+		while (cascade < light.cascadeCount && viewDepth > light.cascadeSplits[cascade]) {
+			cascade++;
+		}
+		//past the last cascade there are no shadows
+		if (cascade == light.cascadeCount) {
+			return 0.0;
+		}
+
+		float cosTheta = clamp(dot(normal, lightDir), 0.0, 1.0);
+		float shadow = CascadeShadow(light, depthMap, cascade, fragPos, normal, cosTheta);
+
+		float start = cascade == 0 ? 0.0 : light.cascadeSplits[cascade - 1];
+		float end = light.cascadeSplits[cascade];
+		float blendStart = end - 0.1 * (end - start);
+		if (viewDepth > blendStart) {
+			float next = 0.0;
+			if (cascade + 1 < light.cascadeCount) {
+				next = CascadeShadow(light, depthMap, cascade + 1, fragPos, normal, cosTheta);
+			}
+			shadow = mix(shadow, next, (viewDepth - blendStart) / (end - blendStart));
+		}
+		return shadow;
+	}
+
+	float PointShadowCalculation(PointLight light, samplerCube depthMap, vec3 fragPos, vec3 normal)
+	{
+		ShadowSettings settings = light.shadowSettings;
+		float resolution = float(textureSize(depthMap, 0).x);
+		vec3 toLight = normalize(light.position - fragPos);
+		float cosTheta = clamp(dot(normal, toLight), 0.0, 1.0);
+		//a 90 degree cube face d away from the light is 2d wide
+		float texelWorld = 2.0 * length(light.position - fragPos) / resolution;
+
+		vec3 offsetPos = fragPos + normal * settings.normalBias * texelWorld * sqrt(1.0 - cosTheta * cosTheta);
+		vec3 fragToLight = offsetPos - light.position;
+		float receiver = length(fragToLight) - SlopeBias(settings, cosTheta) * texelWorld;
+
+		//taps are spread over the plane facing the light
+		vec3 axis = normalize(fragToLight);
+		vec3 tangent = normalize(cross(axis, abs(axis.y) < 0.99 ? vec3(0.0, 1.0, 0.0) : vec3(1.0, 0.0, 0.0)));
+		vec3 bitangent = cross(axis, tangent);
+		mat2 rotation = PoissonRotation();
+		float radius = float(settings.filterSize) / 2.0;
+
+		if (settings.filterMode == SHADOW_PCSS) {
+			//lightSize is the radius of the light in world units
+			float searchRadius = clamp(settings.lightSize / texelWorld, 1.0, MAX_PENUMBRA);
+			float blockerDistance = 0.0;
+			int blockers = 0;
+			for (int i = 0; i < 16; i++) {
+				vec2 offset = rotation * poissonDisk[i] * searchRadius * texelWorld;
+				float distance = texture(depthMap, fragToLight + tangent * offset.x + bitangent * offset.y).r * light.farPlane;
+				if (distance < receiver) {
+					blockerDistance += distance;
+					blockers++;
+				}
+			}
+			if (blockers == 0) {
+				return 0.0;
+			}
+			blockerDistance /= float(blockers);
+			float penumbra = settings.lightSize * (receiver - blockerDistance) / max(blockerDistance, 0.001);
+			radius = clamp(penumbra / texelWorld, 1.0, MAX_PENUMBRA);
+		}
+
+		int taps = ShadowTaps(settings);
+		float shadow = 0.0;
+		for (int i = 0; i < taps; i++) {
+			vec2 offset = ShadowTapOffset(settings, i, rotation, radius) * texelWorld;
+			float closestDepth = texture(depthMap, fragToLight + tangent * offset.x + bitangent * offset.y).r;
+			shadow += receiver > closestDepth * light.farPlane ? 1.0 : 0.0;
+		}
+		return shadow / float(taps);
+	}
+
+	//shadow of the point light whose shadow map is in pointShadowMaps slot, none for a slot of -1
+	float PointShadow(PointLight light, int slot, vec3 fragPos, vec3 normal)
+	{
+	#if MAX_POINT_SHADOWS > 0
+		if (light.shadow == 1 && slot >= 0) {
+			return PointShadowCalculation(light, pointShadowMaps[slot], fragPos, normal);
+		}
+	#endif
+		return 0.0;
+	}
+`
@@ -0,0 +1,206 @@
+package shader
+
+// ambientOcclusion - the occlusion the SSAO pass found, for the lit shaders to scale their ambient term by. main sets
+// occlusion before any light is added, see geometry/ssao.go
+const ambientOcclusion = `
+	uniform sampler2D ssaoTexture;
+	uniform int ssaoEnabled;
+
+	float occlusion = 1.0;
+
+	//how much of the ambient light reaches the fragment
+	float AmbientOcclusion()
+	{
+		if (ssaoEnabled == 0) {
+			return 1.0;
+		}
+		return texelFetch(ssaoTexture, ivec2(gl_FragCoord.xy), 0).r;
+	}
+`
+
+// PositionNormalShader - the prepass SSAO reads, the view space position and normal of the nearest surface at each
+// pixel
+type PositionNormalShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s PositionNormalShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s PositionNormalShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s PositionNormalShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *PositionNormalShader) Setup() {
+	s.vertShader = `
+	#version 410
+	layout (location = 0) in vec3 aPosition;
+	layout (location = 1) in vec3 aNormal;
+
+	out vec3 oViewPosition;
+	out vec3 oViewNormal;
+
+	uniform mat4 uProjectionMatrix;
+	uniform mat4 uViewMatrix;
+` + instancing + `
+
+	void main() {
+		vec4 viewPosition = uViewMatrix * ModelMatrix() * vec4(aPosition, 1.0);
+		oViewPosition = viewPosition.xyz;
+		oViewNormal = mat3(uViewMatrix) * NormalMatrix() * aNormal;
+		gl_Position = uProjectionMatrix * viewPosition;
+	}
+` + "\x00"
+
+	s.geoShader = ""
+
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	in vec3 oViewPosition;
+	in vec3 oViewNormal;
+
+	layout (location = 0) out vec4 position; //w is 1 where there is a surface
+	layout (location = 1) out vec4 normal;
+
+	void main() {
+		//faces seen from behind get their normal turned towards the camera
+		vec3 N = normalize(oViewNormal);
+		if (dot(N, oViewPosition) > 0.0) {
+			N = -N;
+		}
+		position = vec4(oViewPosition, 1.0);
+		normal = vec4(N, 0.0);
+	}
+` + "\x00"
+}
+
+// SSAOShader - fullscreen pass estimating how much of the hemisphere above each pixel is hidden by the surfaces
+// around it. Samples are taken from a kernel in the hemisphere, turned about the normal by a tiled noise texture,
+// and count as occluded when the prepass has a surface in front of them
+type SSAOShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s SSAOShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s SSAOShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s SSAOShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *SSAOShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	#define MAX_SSAO_SAMPLES 64
+
+	in vec2 oUV;
+
+	uniform sampler2D positionTexture;
+	uniform sampler2D normalTexture;
+	uniform sampler2D noiseTexture;
+	uniform vec3 samples[MAX_SSAO_SAMPLES];
+	uniform int sampleCount;
+	uniform float radius;
+	uniform float bias;
+	uniform float power;
+	uniform vec2 noiseScale; //the frame size over the noise texture's
+	uniform mat4 projection;
+
+	out vec4 frag_colour;
+
+	void main() {
+		vec4 position = texture(positionTexture, oUV);
+		if (position.w == 0.0) {
+			frag_colour = vec4(1.0);
+			return;
+		}
+		vec3 N = texture(normalTexture, oUV).xyz;
+		vec3 random = texture(noiseTexture, oUV * noiseScale).xyz;
+		vec3 T = normalize(random - N * dot(random, N));
+		mat3 TBN = mat3(T, cross(N, T), N);
+
+		float occluded = 0.0;
+		for (int i = 0; i < sampleCount; i++) {
+			vec3 samplePosition = position.xyz + TBN * samples[i] * radius;
+			vec4 clip = projection * vec4(samplePosition, 1.0);
+			vec2 uv = clip.xy / clip.w * 0.5 + 0.5;
+			vec4 surface = texture(positionTexture, uv);
+			if (surface.w == 0.0) {
+				continue;
+			}
+			//surfaces far in front of the pixel don't shade it
+			float rangeCheck = smoothstep(0.0, 1.0, radius / abs(position.z - surface.z));
+			occluded += (surface.z >= samplePosition.z + bias ? 1.0 : 0.0) * rangeCheck;
+		}
+		frag_colour = vec4(pow(1.0 - occluded / float(sampleCount), power));
+	}
+` + "\x00"
+}
+
+// SSAOBlurShader - averages the occlusion over a square around each pixel, hiding the pattern of the noise texture
+type SSAOBlurShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s SSAOBlurShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s SSAOBlurShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s SSAOBlurShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *SSAOBlurShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	in vec2 oUV;
+
+	uniform sampler2D occlusionTexture;
+	uniform int blurRadius; //pixels either side
+
+	out vec4 frag_colour;
+
+	void main() {
+		ivec2 pixel = ivec2(gl_FragCoord.xy);
+		ivec2 last = textureSize(occlusionTexture, 0) - 1;
+		float sum = 0.0;
+		for (int y = -blurRadius; y <= blurRadius; y++) {
+			for (int x = -blurRadius; x <= blurRadius; x++) {
+				sum += texelFetch(occlusionTexture, clamp(pixel + ivec2(x, y), ivec2(0), last), 0).r;
+			}
+		}
+		float side = float(2 * blurRadius + 1);
+		frag_colour = vec4(sum / (side * side));
+	}
+` + "\x00"
+}
@@ -0,0 +1,215 @@
+package shader
+
+// fullscreenVertShader - covers the screen with one triangle made from gl_VertexID, so the post passes need no
+// vertex buffers
+const fullscreenVertShader = `
+	#version 410
+
+	out vec2 oUV;
+
+	void main() {
+		vec2 corner = vec2((gl_VertexID << 1) & 2, gl_VertexID & 2);
+		oUV = corner;
+		gl_Position = vec4(corner * 2.0 - 1.0, 0.0, 1.0);
+	}
+` + "\x00"
+
+// luminanceFunction - Rec. 709 luminance of a linear colour
+const luminanceFunction = `
+	float Luminance(vec3 color)
+	{
+		return dot(color, vec3(0.2126, 0.7152, 0.0722));
+	}
+`
+
+// ToneMapShader - resolves the HDR frame: applies the exposure, the tone mapping operator and the output encoding
+type ToneMapShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s ToneMapShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s ToneMapShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s ToneMapShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *ToneMapShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	//operators and outputs, see geometry/toneMapping.go
+	#define TONEMAP_NONE 0
+	#define TONEMAP_REINHARD 1
+	#define TONEMAP_ACES 2
+	#define TONEMAP_FILMIC 3
+	#define OUTPUT_LINEAR 0
+	#define OUTPUT_SRGB 1
+	#define OUTPUT_GAMMA 2
+` + luminanceFunction + `
+	in vec2 oUV;
+
+	uniform sampler2D hdrTexture;
+	uniform sampler2D adaptedLuminance;
+	uniform int toneMapOperator;
+	uniform int outputMode;
+	uniform float exposure;
+	uniform int autoExposure;
+	uniform float keyValue;
+	uniform float gamma;
+
+	out vec4 frag_colour;
+
+	//Narkowicz's fit of the ACES reference rendering transform
+	vec3 ACES(vec3 x)
+	{
+		return clamp((x * (2.51 * x + 0.03)) / (x * (2.43 * x + 0.59) + 0.14), 0.0, 1.0);
+	}
+
+	//Hable's Uncharted 2 curve
+	vec3 HableCurve(vec3 x)
+	{
+		float A = 0.15;
+		float B = 0.50;
+		float C = 0.10;
+		float D = 0.20;
+		float E = 0.02;
+		float F = 0.30;
+		return ((x * (A * x + C * B) + D * E) / (x * (A * x + B) + D * F)) - E / F;
+	}
+
+	vec3 Filmic(vec3 x)
+	{
+		float whitePoint = 11.2;
+		return HableCurve(2.0 * x) / HableCurve(vec3(whitePoint));
+	}
+
+	vec3 LinearToSRGB(vec3 c)
+	{
+		c = clamp(c, 0.0, 1.0);
+		return mix(c * 12.92, 1.055 * pow(c, vec3(1.0 / 2.4)) - 0.055, step(vec3(0.0031308), c));
+	}
+
+	void main() {
+		vec4 hdr = texture(hdrTexture, oUV);
+
+		float scale = exposure;
+		if (autoExposure == 1) {
+			scale *= keyValue / max(texelFetch(adaptedLuminance, ivec2(0), 0).r, 1e-4);
+		}
+		vec3 color = max(hdr.rgb * scale, vec3(0.0));
+
+		if (toneMapOperator == TONEMAP_REINHARD) {
+			color = color / (1.0 + color);
+		} else if (toneMapOperator == TONEMAP_ACES) {
+			color = ACES(color);
+		} else if (toneMapOperator == TONEMAP_FILMIC) {
+			color = Filmic(color);
+		}
+		color = clamp(color, 0.0, 1.0);
+
+		if (outputMode == OUTPUT_SRGB) {
+			color = LinearToSRGB(color);
+		} else if (outputMode == OUTPUT_GAMMA) {
+			color = pow(color, vec3(1.0 / gamma));
+		}
+
+		frag_colour = vec4(color, hdr.a);
+	}
+` + "\x00"
+}
+
+// LuminanceShader - writes the log luminance of the HDR frame into a small texture whose smallest mip level is then
+// the log of the geometric mean luminance
+type LuminanceShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s LuminanceShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s LuminanceShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s LuminanceShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *LuminanceShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+` + luminanceFunction + `
+	in vec2 oUV;
+
+	uniform sampler2D hdrTexture;
+
+	out float logLuminance;
+
+	void main() {
+		logLuminance = log(max(Luminance(texture(hdrTexture, oUV).rgb), 1e-4));
+	}
+` + "\x00"
+}
+
+// AdaptationShader - moves the adapted luminance of the last frame towards the average luminance of this one
+type AdaptationShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s AdaptationShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s AdaptationShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s AdaptationShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *AdaptationShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	uniform sampler2D logLuminance;
+	uniform sampler2D previousLuminance;
+	uniform float lastLevel; //smallest mip level of logLuminance, one texel
+	uniform float rate; //fraction of the way to go this frame, 1 snaps to the current frame
+
+	out float adaptedLuminance;
+
+	void main() {
+		float average = exp(textureLod(logLuminance, vec2(0.5), lastLevel).r);
+		if (rate >= 1.0) {
+			//the previous texture hasn't been written yet
+			adaptedLuminance = average;
+			return;
+		}
+		float previous = texelFetch(previousLuminance, ivec2(0), 0).r;
+		adaptedLuminance = mix(previous, average, rate);
+	}
+` + "\x00"
+}
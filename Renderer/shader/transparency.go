@@ -0,0 +1,74 @@
+package shader
+
+// transparencyOutput - the outputs of the lit shaders and WriteFragment, which they end with. Opaque fragments go to
+// the frame as they are. Transparent ones are drawn by the transparency pass into two targets: their premultiplied
+// colour, weighted so nearer and more opaque fragments count for more, is added up in the first and the second is
+// multiplied by 1 - alpha of each of them, see geometry/transparency.go
+const transparencyOutput = `
+	layout (location = 0) out vec4 frag_colour;
+	layout (location = 1) out float revealage;
+
+	uniform int transparentPass;
+
+	void WriteFragment(vec3 color, float alpha)
+	{
+		if (transparentPass == 0) {
+			frag_colour = vec4(color, alpha);
+			return;
+		}
+		float weight = clamp(pow(min(1.0, alpha * 10.0) + 0.01, 3.0) * 1e8 * pow(1.0 - gl_FragCoord.z * 0.9, 3.0),
+			1e-2, 3e3);
+		frag_colour = vec4(color * alpha, alpha) * weight;
+		revealage = alpha;
+	}
+`
+
+// TransparencyCompositeShader - fullscreen pass putting the accumulated transparent fragments over the frame. The
+// weighted colours are averaged and cover the frame by 1 - revealage
+type TransparencyCompositeShader struct {
+	fragShader string
+	vertShader string
+	geoShader  string
+}
+
+func (s TransparencyCompositeShader) GetFragShader() string {
+	return s.fragShader
+}
+
+func (s TransparencyCompositeShader) GetVertShader() string {
+	return s.vertShader
+}
+
+func (s TransparencyCompositeShader) GetGeometryShader() string {
+	return s.geoShader
+}
+
+func (s *TransparencyCompositeShader) Setup() {
+	s.vertShader = fullscreenVertShader
+	s.geoShader = ""
+	s.fragShader = `
+	#version 410
+	precision highp float;
+
+	in vec2 oUV;
+
+	uniform sampler2D accumTexture;
+	uniform sampler2D revealageTexture;
+
+	out vec4 frag_colour;
+
+	void main() {
+		ivec2 pixel = ivec2(gl_FragCoord.xy);
+		float revealage = texelFetch(revealageTexture, pixel, 0).r;
+		if (revealage >= 1.0) {
+			discard;
+		}
+		vec4 accum = texelFetch(accumTexture, pixel, 0);
+		//a few bright fragments can overflow the half float sum
+		if (isinf(max(max(abs(accum.r), abs(accum.g)), abs(accum.b)))) {
+			accum.rgb = vec3(accum.a);
+		}
+		frag_colour = vec4(accum.rgb / max(accum.a, 1e-5), 1.0 - revealage);
+	}
+` + "\x00"
+}
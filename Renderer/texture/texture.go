@@ -22,21 +22,28 @@ var errUnsupportedStride = errors.New("unsupported stride, only 32-bit colors su
 var errTextureNotBound = errors.New("texture not bound")
 
 func NewTextureFromFile(file string, wrapR, wrapS int32) (*Texture, error) {
-	imgFile, err := os.Open(file)
+	img, err := loadImageFile(file)
 	if err != nil {
 		return nil, err
 	}
-	defer imgFile.Close()
+	return NewTexture(img, wrapR, wrapS)
+}
 
-	// Decode detexts the type of image as long as its image/<type> is imported
-	img, _, err := image.Decode(imgFile)
+// NewLinearTextureFromFile - loads a texture whose texels are data rather than colours, such as a normal, roughness
+// or occlusion map, so they are sampled as stored instead of being decoded from sRGB
+func NewLinearTextureFromFile(file string, wrapR, wrapS int32) (*Texture, error) {
+	img, err := loadImageFile(file)
 	if err != nil {
 		return nil, err
 	}
-	return NewTexture(img, wrapR, wrapS)
+	return newTexture(img, wrapR, wrapS, gl.RGBA8)
 }
 
 func NewTexture(img image.Image, wrapR, wrapS int32) (*Texture, error) {
+	return newTexture(img, wrapR, wrapS, gl.SRGB_ALPHA)
+}
+
+func newTexture(img image.Image, wrapR, wrapS, internalFmt int32) (*Texture, error) {
 	rgba := image.NewRGBA(img.Bounds())
 	draw.Draw(rgba, rgba.Bounds(), img, image.Pt(0, 0), draw.Src)
 	if rgba.Stride != rgba.Rect.Size().X*4 { // TODO-cs: why?
@@ -47,7 +54,6 @@ func NewTexture(img image.Image, wrapR, wrapS int32) (*Texture, error) {
 	gl.GenTextures(1, &handle)
 
 	target := uint32(gl.TEXTURE_2D)
-	internalFmt := int32(gl.SRGB_ALPHA)
 	format := uint32(gl.RGBA)
 	width := int32(rgba.Rect.Size().X)
 	height := int32(rgba.Rect.Size().Y)
@@ -111,3 +117,8 @@ func loadImageFile(file string) (image.Image, error) {
 func (tex *Texture) GetHandle() uint32 {
 	return tex.handle
 }
+
+func (tex *Texture) Delete() {
+	gl.DeleteTextures(1, &tex.handle)
+	tex.handle = 0
+}
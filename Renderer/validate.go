@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"./geometry"
+)
+
+// runValidate - checks each scene file against the current schema without loading any assets, printing
+// every problem found. Returns the number of invalid files
+func runValidate(scenes []string) int {
+	invalid := 0
+	for _, scenePath := range scenes {
+		data, err := ioutil.ReadFile(scenePath)
+		if err == nil {
+			_, err = geometry.DecodeSceneFile(scenePath, data)
+		}
+
+		var schemaErr *geometry.SchemaError
+		switch {
+		case err == nil:
+			fmt.Printf("OK %s\n", scenePath)
+			continue
+		case errors.As(err, &schemaErr):
+			fmt.Println("INVALID", schemaErr)
+		default:
+			fmt.Println("INVALID", err)
+		}
+		invalid++
+	}
+	return invalid
+}